@@ -0,0 +1,14 @@
+package config
+
+import "github.com/kelseyhightower/envconfig"
+
+// ChatHistoryConfig contains the paging settings for the chat history API
+type ChatHistoryConfig struct {
+	DefaultPageSize int64 `envconfig:"CHAT_HISTORY_DEFAULT_PAGE_SIZE" default:"50"`
+	MaxPageSize     int64 `envconfig:"CHAT_HISTORY_MAX_PAGE_SIZE" default:"100"`
+}
+
+func ProvideChatHistoryConfig() (conf ChatHistoryConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/domesama/chat-and-notifications/chatpersistence/service"
@@ -28,3 +29,23 @@ func (c ChatPersistenceHandler) HandleChatPersistence(gctx *gin.Context) {
 
 	gctx.JSON(http.StatusCreated, chatMessage)
 }
+
+func (c ChatPersistenceHandler) HandleChatHistory(gctx *gin.Context) {
+	var query model.ChatHistoryQuery
+	if err := gctx.ShouldBindQuery(&query); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := c.ChatPersistenceService.GetChatHistory(gctx.Request.Context(), query)
+	if errors.Is(err, service.ErrConflictingCursors) || errors.Is(err, service.ErrCursorNotFound) {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		gctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch messages"})
+		return
+	}
+
+	gctx.JSON(http.StatusOK, page)
+}
@@ -18,6 +18,7 @@ func (c ChatPersistenceHandler) RegisterRoutes(engine *gin.Engine) error {
 	chatRouterGroup := engine.Group("/chat")
 	{
 		chatRouterGroup.POST("/persist", c.HandleChatPersistence)
+		chatRouterGroup.GET("/messages", c.HandleChatHistory)
 	}
 	return nil
 }
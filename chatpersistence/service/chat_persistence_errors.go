@@ -0,0 +1,8 @@
+package service
+
+import "errors"
+
+var (
+	ErrConflictingCursors = errors.New("only one of since or before can be specified")
+	ErrCursorNotFound     = errors.New("cursor message not found in stream")
+)
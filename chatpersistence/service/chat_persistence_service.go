@@ -2,19 +2,147 @@ package service
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"time"
 
+	"github.com/domesama/chat-and-notifications/chatpersistence/config"
 	"github.com/domesama/chat-and-notifications/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// @@wire-struct@@
+const chatCollection = "chat"
+
 type ChatPersistenceService struct {
-	DB *mongo.Database
+	DB     *mongo.Database
+	Config config.ChatHistoryConfig
+}
+
+// chatCursorAnchor is the position of the cursor message, _id is kept raw since it can either be a string or an ObjectID
+type chatCursorAnchor struct {
+	ID        bson.RawValue `bson:"_id"`
+	CreatedAt time.Time     `bson:"created_at"`
+}
+
+func ProvideChatPersistenceService(db *mongo.Database, conf config.ChatHistoryConfig) (ChatPersistenceService, error) {
+	svc := ChatPersistenceService{
+		DB:     db,
+		Config: conf,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return svc, svc.ensureIndexes(ctx)
+}
+
+// ensureIndexes creates the index backing the chat history cursors, creating an existing index is a no-op
+func (c ChatPersistenceService) ensureIndexes(ctx context.Context) (err error) {
+	_, err = c.DB.Collection(chatCollection).Indexes().CreateOne(
+		ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "stream_id", Value: 1},
+				{Key: "created_at", Value: 1},
+				{Key: "_id", Value: 1},
+			},
+			Options: options.Index().SetName("stream_id_created_at_id"),
+		},
+	)
+	return
 }
 
 func (c ChatPersistenceService) PersistChatMessage(ctx context.Context, message model.ChatMessage) (err error) {
 	message.CreatedAt = time.Now()
-	_, err = c.DB.Collection("chat").InsertOne(ctx, message)
+	_, err = c.DB.Collection(chatCollection).InsertOne(ctx, message)
+	return
+}
+
+// GetChatHistory returns a page of messages of a stream ordered by (created_at, _id), see model.ChatHistoryQuery for the cursor semantics
+func (c ChatPersistenceService) GetChatHistory(ctx context.Context, query model.ChatHistoryQuery) (
+	page model.ChatHistoryPage, err error,
+) {
+	if query.Since != "" && query.Before != "" {
+		return page, ErrConflictingCursors
+	}
+
+	// Page backward (newest first) by default and reverse the result afterward
+	cursorID, comparator, sortOrder := query.Before, "$lt", -1
+	if query.Since != "" {
+		cursorID, comparator, sortOrder = query.Since, "$gt", 1
+	}
+
+	filter := bson.M{"stream_id": query.StreamID}
+	if cursorID != "" {
+		anchor, err := c.findCursorAnchor(ctx, query.StreamID, cursorID)
+		if err != nil {
+			return page, err
+		}
+
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{comparator: anchor.CreatedAt}},
+			bson.M{"created_at": anchor.CreatedAt, "_id": bson.M{comparator: anchor.ID}},
+		}
+	}
+
+	// Fetch one extra message to know whether there is another page
+	pageSize := c.pageSize(query.Limit)
+	cursor, err := c.DB.Collection(chatCollection).Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: sortOrder}, {Key: "_id", Value: sortOrder}}).
+			SetLimit(pageSize+1),
+	)
+	if err != nil {
+		return
+	}
+
+	messages := make([]model.ChatMessage, 0, pageSize+1)
+	if err = cursor.All(ctx, &messages); err != nil {
+		return
+	}
+
+	if int64(len(messages)) > pageSize {
+		page.HasMore = true
+		messages = messages[:pageSize]
+	}
+
+	if sortOrder < 0 {
+		slices.Reverse(messages)
+	}
+
+	page.Messages = messages
 	return
 }
+
+func (c ChatPersistenceService) findCursorAnchor(ctx context.Context, streamID string, messageID string) (
+	anchor chatCursorAnchor, err error,
+) {
+	// Messages persisted without a message_id get an ObjectID generated by the driver
+	ids := bson.A{messageID}
+	if objectID, err := primitive.ObjectIDFromHex(messageID); err == nil {
+		ids = append(ids, objectID)
+	}
+
+	err = c.DB.Collection(chatCollection).FindOne(
+		ctx,
+		bson.M{"stream_id": streamID, "_id": bson.M{"$in": ids}},
+		options.FindOne().SetProjection(bson.M{"created_at": 1}),
+	).Decode(&anchor)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrCursorNotFound
+	}
+	return
+}
+
+// pageSize falls back to the default page size and caps the requested size to the max page size
+func (c ChatPersistenceService) pageSize(requested int64) int64 {
+	if requested <= 0 {
+		return c.Config.DefaultPageSize
+	}
+	return min(requested, c.Config.MaxPageSize)
+}
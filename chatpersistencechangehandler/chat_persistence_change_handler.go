@@ -22,6 +22,7 @@ func ProvideChatPersistenceChangeHandler(
 		msgHandler,
 		metric,
 		event.WithEventStore(eventStore),
+		event.WithRetriesExhaustedHandler(msgHandler.HandleRetriesExhausted),
 	)
 
 	return connections.NewConsumerGroup(
@@ -29,5 +30,6 @@ func ProvideChatPersistenceChangeHandler(
 		conf.KafkaInfo,
 		server,
 		eventHandler.HandleEvent,
+		connections.WithRetriesExhaustedHandler(eventHandler.HandleRetriesExhausted),
 	)
 }
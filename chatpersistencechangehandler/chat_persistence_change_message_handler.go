@@ -2,6 +2,8 @@ package chatpersistencechangehandler
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 
 	"github.com/domesama/chat-and-notifications/chatpersistencechangehandler/service"
 	"github.com/domesama/chat-and-notifications/event/eventmsg"
@@ -56,3 +58,30 @@ func (c ChatPersistenceChangeMessageHandler) HandleMessage(
 		return
 	}
 }
+
+// HandleRetriesExhausted fails over on the chat messages that could not be forwarded within their retries by closing
+// the connections of their stream, the message itself is already persisted and served by the chat history.
+// Messages that only failed to reach the general notification service keep their stream open
+func (c ChatPersistenceChangeMessageHandler) HandleRetriesExhausted(
+	ctx context.Context,
+	msg eventmsg.Message[eventmodel.ChatMessagePersistenceChangeEvent],
+	err error,
+) {
+	if msg.Value.EventType != eventmodel.EventTypeCreate || !errors.Is(err, service.ErrChatForwardFailed) {
+		return
+	}
+
+	slog.ErrorContext(
+		ctx, "gave up forwarding chat message, closing the connections of its stream",
+		"message_id", msg.Value.ChatMessage.MessageID,
+		"stream_id", msg.Value.ChatMessage.StreamID,
+		"error", err,
+	)
+	if closeErr := c.ChatMessageSyncService.CloseChatWebSocketStream(ctx, msg.Value); closeErr != nil {
+		slog.ErrorContext(
+			ctx, "failed to close the connections of the chat stream",
+			"stream_id", msg.Value.ChatMessage.StreamID,
+			"error", closeErr,
+		)
+	}
+}
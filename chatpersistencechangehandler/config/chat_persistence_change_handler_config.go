@@ -12,4 +12,20 @@ type ChatPersistenceChangeHandlerConfig struct {
 
 	GeneralNotificationOutgoingConfig       outgoinghttp.OutGoingHTTPConfig `envconfig:"GENERAL_NOTIFICATION_OUTGOING_CONFIG" required:"true"`
 	ChatMessageSocketTransferOutgoingConfig outgoinghttp.OutGoingHTTPConfig `envconfig:"CHAT_MESSAGE_SOCKET_TRANSFER_OUTGOING_CONFIG" required:"true"`
+
+	// ChatWebSocketAdminOutgoingConfig reaches the internal admin listener of the chat websocket service, which closes
+	// the streams of the messages that ran out of retries. See WEBSOCKET_ADMIN_LISTEN_ADDR
+	ChatWebSocketAdminOutgoingConfig outgoinghttp.OutGoingHTTPConfig `envconfig:"CHAT_WEBSOCKET_ADMIN_OUTGOING_CONFIG" required:"true"`
+
+	// ChatWebSocketPresenceLookupEnabled forwards chat messages directly to the pods holding the stream_id
+	// according to the presence directory, instead of relying on the load balancer behind CHAT_MESSAGE_SOCKET_TRANSFER_OUTGOING_CONFIG_CLIENT_HOST
+	ChatWebSocketPresenceLookupEnabled bool `envconfig:"CHAT_WEBSOCKET_PRESENCE_LOOKUP_ENABLED" default:"false"`
+
+	// ChatWebSocketAdminPort is the port of the admin listener of each pod found in the presence directory,
+	// which only records the public address of the pods
+	ChatWebSocketAdminPort string `envconfig:"CHAT_WEBSOCKET_ADMIN_PORT" default:"8081"`
+
+	// GeneralNotificationPresenceLookupEnabled forwards chat notifications directly to the pods holding the user_id
+	// of the receiver, instead of relying on the load balancer behind GENERAL_NOTIFICATION_OUTGOING_CONFIG_CLIENT_HOST
+	GeneralNotificationPresenceLookupEnabled bool `envconfig:"GENERAL_NOTIFICATION_PRESENCE_LOOKUP_ENABLED" default:"false"`
 }
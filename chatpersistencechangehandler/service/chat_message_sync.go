@@ -2,18 +2,24 @@ package service
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 
 	"github.com/domesama/chat-and-notifications/chatpersistencechangehandler/config"
 	"github.com/domesama/chat-and-notifications/eventmodel"
+	"github.com/domesama/chat-and-notifications/model"
 	"github.com/domesama/chat-and-notifications/outgoinghttp"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/concurrent"
 )
 
 // @@wire-struct@@
 type ChatMessageSyncService struct {
-	Config config.ChatPersistenceChangeHandlerConfig
+	Config            config.ChatPersistenceChangeHandlerConfig
+	PresenceDirectory presence.Directory
 }
 
 func (c ChatMessageSyncService) ForwardChatMessageToWebsocketServices(
@@ -21,9 +27,11 @@ func (c ChatMessageSyncService) ForwardChatMessageToWebsocketServices(
 	msg eventmodel.ChatMessagePersistenceChangeEvent) error {
 
 	// Concurrently forward chat message to relevant service that holds recipients websockets
+	var chatForwardErr error
 	forwardChatToSubscribedWebSocket := concurrent.NewTask(
 		func(ctx context.Context) error {
-			return c.forwardChatToSubscribedWebSocket(ctx, msg)
+			chatForwardErr = c.forwardChatToSubscribedWebSocket(ctx, msg)
+			return chatForwardErr
 		},
 	)
 
@@ -37,17 +45,93 @@ func (c ChatMessageSyncService) ForwardChatMessageToWebsocketServices(
 	)
 
 	err := concurrent.NewGroup(ctx).Exec(forwardChatToSubscribedWebSocket, forwardChatToGeneralNotificationWebSocket)
+	// Only the failures of the chat forward fail over by closing the stream, see HandleRetriesExhausted
+	if chatForwardErr != nil {
+		return fmt.Errorf("%w: %w", ErrChatForwardFailed, err.ErrorOrNil())
+	}
 	return err.ErrorOrNil()
 }
 
 func (c ChatMessageSyncService) forwardChatToSubscribedWebSocket(
 	ctx context.Context,
 	msg eventmodel.ChatMessagePersistenceChangeEvent) (err error) {
+	hosts := c.lookupChatWebSocketHosts(ctx, msg.ChatMessage.StreamID)
+	if len(hosts) == 1 {
+		return c.forwardChatToWebSocketHost(ctx, hosts[0], msg)
+	}
+
+	// Forward to every pod holding the stream_id, so that connections misrouted after a rebalance still get the message
+	forwardToEachHost := func(ctx context.Context, i int, host string) (struct{}, error) {
+		return struct{}{}, c.forwardChatToWebSocketHost(ctx, host, msg)
+	}
+	useHostAsKey := func(i int, host string) string {
+		return host
+	}
+
+	forwardToEachHostTask := concurrent.NewSliceTask(hosts, map[string]struct{}{}, forwardToEachHost, useHostAsKey)
+	multiError := concurrent.NewGroup(ctx).Exec(forwardToEachHostTask)
+	return multiError.ErrorOrNil()
+}
+
+// lookupChatWebSocketHosts returns the pods holding the stream_id according to the presence directory.
+// Falls back to the configured host when the lookup is disabled, fails or finds no pod
+func (c ChatMessageSyncService) lookupChatWebSocketHosts(ctx context.Context, streamID string) []string {
+	return c.lookupHosts(
+		ctx,
+		c.Config.ChatWebSocketPresenceLookupEnabled,
+		c.Config.ChatMessageSocketTransferOutgoingConfig.Host,
+		presence.NamespaceChat,
+		streamID,
+	)
+}
+
+// lookupGeneralNotificationHosts returns the pods holding the user_id according to the presence directory.
+// Falls back to the configured host when the lookup is disabled, fails or finds no pod
+func (c ChatMessageSyncService) lookupGeneralNotificationHosts(ctx context.Context, userID string) []string {
+	return c.lookupHosts(
+		ctx,
+		c.Config.GeneralNotificationPresenceLookupEnabled,
+		c.Config.GeneralNotificationOutgoingConfig.Host,
+		presence.NamespaceNotifications,
+		userID,
+	)
+}
+
+func (c ChatMessageSyncService) lookupHosts(
+	ctx context.Context,
+	enabled bool,
+	fallbackHost string,
+	namespace presence.Namespace,
+	key string) []string {
+	fallback := []string{fallbackHost}
+	if !enabled {
+		return fallback
+	}
+
+	pods, err := c.PresenceDirectory.LookupPods(ctx, namespace, key)
+	if err != nil {
+		slog.WarnContext(
+			ctx, "failed to look up websocket pods, falling back to the configured host",
+			"namespace", namespace,
+			"error", err,
+		)
+		return fallback
+	}
+	if len(pods) == 0 {
+		return fallback
+	}
+	return pods
+}
+
+func (c ChatMessageSyncService) forwardChatToWebSocketHost(
+	ctx context.Context,
+	host string,
+	msg eventmodel.ChatMessagePersistenceChangeEvent) (err error) {
 	conf := c.Config.ChatMessageSocketTransferOutgoingConfig
 
 	request := outgoinghttp.BuildBasicRequest(
 		http.MethodPost,
-		conf.Host+"/chat/forward-to-websocket",
+		host+"/chat/forward-to-websocket",
 		outgoinghttp.WithAdditionalBody(msg.ChatMessage),
 	)
 
@@ -56,20 +140,126 @@ func (c ChatMessageSyncService) forwardChatToSubscribedWebSocket(
 
 	// This returns 206 when some websockets did not receive the message and kafkawrapper should automatically retry this message
 	if statusCode == http.StatusPartialContent {
-		return errors.New("partial content delivered to chat websocket service")
+		return fmt.Errorf("partial content delivered to chat websocket service %s", host)
 	}
 
 	return
 }
 
+// CloseChatWebSocketStream closes the connections of the stream of a message that could not be delivered, on every pod
+// holding it, so that the clients fall back to polling the chat history. See architecture.md's failover section
+func (c ChatMessageSyncService) CloseChatWebSocketStream(
+	ctx context.Context,
+	msg eventmodel.ChatMessagePersistenceChangeEvent) error {
+	streamClose := model.ChatStreamClose{
+		StreamID: msg.ChatMessage.StreamID,
+		Reason:   "chat message delivery failed",
+	}
+
+	closeOnEachHost := func(ctx context.Context, i int, host string) (struct{}, error) {
+		return struct{}{}, c.closeChatWebSocketStreamOnHost(ctx, host, streamClose)
+	}
+	useHostAsKey := func(i int, host string) string {
+		return host
+	}
+
+	hosts := c.lookupChatWebSocketAdminHosts(ctx, streamClose.StreamID)
+	closeOnEachHostTask := concurrent.NewSliceTask(hosts, map[string]struct{}{}, closeOnEachHost, useHostAsKey)
+	multiError := concurrent.NewGroup(ctx).Exec(closeOnEachHostTask)
+	return multiError.ErrorOrNil()
+}
+
+// lookupChatWebSocketAdminHosts returns the admin listeners of the pods holding the stream_id, the close route is not
+// served publicly. Falls back to the configured admin host when the lookup is disabled, fails or finds no pod
+func (c ChatMessageSyncService) lookupChatWebSocketAdminHosts(ctx context.Context, streamID string) []string {
+	if !c.Config.ChatWebSocketPresenceLookupEnabled {
+		return []string{c.Config.ChatWebSocketAdminOutgoingConfig.Host}
+	}
+
+	pods, err := c.PresenceDirectory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	if err != nil {
+		slog.WarnContext(
+			ctx, "failed to look up websocket pods, falling back to the configured admin host",
+			"namespace", presence.NamespaceChat,
+			"error", err,
+		)
+	}
+
+	var hosts []string
+	for _, pod := range pods {
+		host, err := withPort(pod, c.Config.ChatWebSocketAdminPort)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping websocket pod with an invalid address", "pod", pod, "error", err)
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return []string{c.Config.ChatWebSocketAdminOutgoingConfig.Host}
+	}
+	return hosts
+}
+
+// withPort replaces the port of the address, e.g. http://10.0.0.1:8080 becomes http://10.0.0.1:8081
+func withPort(address string, port string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("missing host in %q", address)
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), port)
+	return u.String(), nil
+}
+
+func (c ChatMessageSyncService) closeChatWebSocketStreamOnHost(
+	ctx context.Context,
+	host string,
+	streamClose model.ChatStreamClose) (err error) {
+	conf := c.Config.ChatWebSocketAdminOutgoingConfig
+
+	request := outgoinghttp.BuildBasicRequest(
+		http.MethodPost,
+		host+"/chat/close-websocket-stream",
+		outgoinghttp.WithAdditionalBody(streamClose),
+	)
+
+	client := &http.Client{Timeout: conf.Timeout}
+	_, _, err = outgoinghttp.CallHTTP[any](ctx, client, request)
+	return
+}
+
 func (c ChatMessageSyncService) forwardChatToGeneralNotificationWebSocket(
 	ctx context.Context,
 	msg eventmodel.ChatMessagePersistenceChangeEvent) (err error) {
+	receiverID := msg.ChatMessage.ReceiverID
+
+	// Forward to every pod holding the user_id of the receiver, as with the chat websockets
+	forwardToEachHost := func(ctx context.Context, i int, host string) (struct{}, error) {
+		return struct{}{}, c.forwardChatToGeneralNotificationHost(ctx, host, receiverID, msg)
+	}
+	useHostAsKey := func(i int, host string) string {
+		return host
+	}
+
+	hosts := c.lookupGeneralNotificationHosts(ctx, receiverID)
+	forwardToEachHostTask := concurrent.NewSliceTask(hosts, map[string]struct{}{}, forwardToEachHost, useHostAsKey)
+	multiError := concurrent.NewGroup(ctx).Exec(forwardToEachHostTask)
+	return multiError.ErrorOrNil()
+}
+
+func (c ChatMessageSyncService) forwardChatToGeneralNotificationHost(
+	ctx context.Context,
+	host string,
+	receiverID string,
+	msg eventmodel.ChatMessagePersistenceChangeEvent) (err error) {
 	conf := c.Config.GeneralNotificationOutgoingConfig
 
 	request := outgoinghttp.BuildBasicRequest(
 		http.MethodPost,
-		conf.Host+"/notifications/chat",
+		host+"/notifications/chat",
+		outgoinghttp.WithAdditionalQuery(url.Values{"user_id": {receiverID}}),
 		outgoinghttp.WithAdditionalBody(msg.ChatMessage),
 	)
 
@@ -0,0 +1,7 @@
+package service
+
+import "errors"
+
+// ErrChatForwardFailed wraps the errors of forwarding a chat message to the chat websocket pods, as opposed to the
+// general notification service whose failures must not close the chat stream
+var ErrChatForwardFailed = errors.New("failed to forward chat message to the chat websockets")
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type ChatWebSocketHandlerConfig struct {
+	Upgrade httpserverwrapper.WebSocketUpgradeConfig `envconfig:"CHAT_WEBSOCKET"`
+
+	// ExcludeSenderEcho skips the connections of the sender when forwarding a message, the sender's other devices
+	// then rely on the chat history to show it
+	ExcludeSenderEcho bool `envconfig:"CHAT_EXCLUDE_SENDER_ECHO" default:"false"`
+
+	// StreamFailoverCloseCode closes the connections of a stream whose messages could not be delivered,
+	// clients then fall back to polling the chat history
+	StreamFailoverCloseCode int `envconfig:"CHAT_STREAM_FAILOVER_CLOSE_CODE" default:"4001"`
+}
+
+func ProvideChatWebSocketHandlerConfig() (conf ChatWebSocketHandlerConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
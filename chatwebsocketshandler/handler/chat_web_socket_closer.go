@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStreamCloseReason is sent with the close frame when the request gives no reason
+const defaultStreamCloseReason = "chat stream delivery failed"
+
+// CloseChatStreamConnections closes the connections of the stream held by this pod with the StreamFailoverCloseCode,
+// so that the clients fall back to polling the chat history instead of missing messages
+func (c ChatWebSocketHandler) CloseChatStreamConnections(gctx *gin.Context) {
+	var req model.ChatStreamClose
+	if err := gctx.ShouldBindJSON(&req); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = defaultStreamCloseReason
+	}
+
+	closeAll := func(*websocket.WebSocketConnection) bool { return true }
+	closed := c.WebSocketManager.CloseConnections(req.StreamID, closeAll, c.Config.StreamFailoverCloseCode, req.Reason)
+	slog.Warn("closed chat stream connections", "stream_id", req.StreamID, "closed", closed, "reason", req.Reason)
+
+	gctx.JSON(http.StatusOK, gin.H{"closed": closed, "stream_id": req.StreamID})
+}
@@ -0,0 +1,8 @@
+package handler
+
+import "errors"
+
+var (
+	ErrMissingReceiverID = errors.New("receiver_id is required to subscribe to a chat stream")
+	ErrStreamNotOwned    = errors.New("chat stream is not between the sender and the receiver")
+)
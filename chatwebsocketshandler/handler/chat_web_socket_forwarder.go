@@ -2,17 +2,25 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/config"
 	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/gin-gonic/gin"
 )
 
+// ChatMessageType is the Envelope type of the chat messages broadcast to the stream
+const ChatMessageType = "chat_message"
+
 // @@wire-struct@@
 type ChatWebSocketHandler struct {
 	WebSocketManager websocket.WebSocketManager
+	PresenceTracker  *presence.Tracker
+	Config           config.ChatWebSocketHandlerConfig
 }
 
 func (c ChatWebSocketHandler) ForwardChatMessageToSubscribers(gctx *gin.Context) {
@@ -32,24 +40,36 @@ func (c ChatWebSocketHandler) ForwardChatMessageToSubscribers(gctx *gin.Context)
 		return
 	}
 
-	// Broadcast to all subscribers
-	deliveredCount, err := c.WebSocketManager.BroadcastPayloadToLocalSubscribers(
+	// Broadcast to all subscribers, except the connections of the sender when they don't want their echo
+	opts := []websocket.BroadcastOptions{
+		websocket.WithMessageType(ChatMessageType),
+		websocket.WithMessageID(chatMessage.MessageID),
+	}
+	if c.Config.ExcludeSenderEcho {
+		opts = append(opts, websocket.WithMetadataExclude("sender_id", chatMessage.SenderID))
+	}
+	result, err := c.WebSocketManager.BroadcastPayloadToLocalSubscribers(
 		ctx,
 		chatMessage.StreamID,
 		messageData,
+		opts...,
 	)
 
-	if err == nil {
-		gctx.JSON(
-			http.StatusOK, gin.H{
-				"delivered": deliveredCount,
-				"stream_id": chatMessage.StreamID,
-			},
-		)
+	// Messages dropped by a rate limit are not retried, the drop is counted by websocket_rate_limited
+	if err == nil || errors.Is(err, websocket.ErrRateLimited) {
+		response := gin.H{
+			"delivered":  result.DeliveredCount,
+			"overflowed": result.OverflowedCount,
+			"stream_id":  chatMessage.StreamID,
+		}
+		if err != nil {
+			response["rate_limited"] = true
+		}
+		gctx.JSON(http.StatusOK, response)
 		return
 	}
 
-	if deliveredCount == 0 {
+	if result.DeliveredCount == 0 {
 		gctx.JSON(
 			http.StatusInternalServerError, gin.H{
 				"error":   err.Error(),
@@ -61,9 +81,12 @@ func (c ChatWebSocketHandler) ForwardChatMessageToSubscribers(gctx *gin.Context)
 
 	gctx.JSON(
 		http.StatusPartialContent, gin.H{
-			"delivered": deliveredCount,
-			"error":     err.Error(),
-			"message":   "message delivered to some connections but encountered errors",
+			"delivered":   result.DeliveredCount,
+			"overflowed":  result.OverflowedCount,
+			"unacked":     result.UnackedCount,
+			"error":       err.Error(),
+			"message":     "message delivered to some connections but encountered errors",
+			"connections": result.Connections,
 		},
 	)
 	return
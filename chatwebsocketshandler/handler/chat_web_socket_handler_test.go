@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/chatstream"
+	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/config"
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/presence"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/domesama/chat-and-notifications/websocket/websockettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(cfg config.ChatWebSocketHandlerConfig) websockettest.CustomizerFunc {
+	return func(manager websocket.WebSocketManager) httpserverwrapper.RouterWithWebSocketCustomizer {
+		// The zero tracker is disabled
+		return ChatWebSocketHandler{WebSocketManager: manager, PresenceTracker: &presence.Tracker{}, Config: cfg}
+	}
+}
+
+func chatQuery(senderID, receiverID string) url.Values {
+	return url.Values{
+		"stream_id":   {chatstream.ComputeStreamID(senderID, receiverID)},
+		"sender_id":   {senderID},
+		"receiver_id": {receiverID},
+	}
+}
+
+func chatMessage(senderID, receiverID, content string) model.ChatMessage {
+	return model.ChatMessage{
+		MessageID: "m1",
+		Content:   content,
+		ChatMetadata: model.ChatMetadata{
+			StreamID:   chatstream.ComputeStreamID(senderID, receiverID),
+			SenderID:   senderID,
+			ReceiverID: receiverID,
+		},
+	}
+}
+
+func TestChatWebSocketHandler(t *testing.T) {
+	t.Run(
+		"forwards messages to the subscribers of the stream", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler(config.ChatWebSocketHandlerConfig{}))
+			sender := s.Dial("/chat/subscribe-websocket", chatQuery("alice", "bob"))
+			receiver := s.Dial("/chat/subscribe-websocket", chatQuery("bob", "alice"))
+			other := s.Dial("/chat/subscribe-websocket", chatQuery("alice", "carol"))
+
+			status, _ := s.PostJSON("/chat/forward-to-websocket", nil, chatMessage("alice", "bob", "hello"))
+			assert.Equal(t, http.StatusOK, status)
+
+			for _, conn := range []*websockettest.Conn{sender, receiver} {
+				messages := websockettest.ExpectMessages[model.ChatMessage](conn, 1, time.Second)
+				assert.Equal(t, "hello", messages[0].Content)
+			}
+			other.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"skips the sender when it excludes its echo", func(t *testing.T) {
+			s := websockettest.NewServer(
+				t, newTestHandler(config.ChatWebSocketHandlerConfig{ExcludeSenderEcho: true}),
+			)
+			sender := s.Dial("/chat/subscribe-websocket", chatQuery("alice", "bob"))
+			receiver := s.Dial("/chat/subscribe-websocket", chatQuery("bob", "alice"))
+
+			status, _ := s.PostJSON("/chat/forward-to-websocket", nil, chatMessage("alice", "bob", "hello"))
+			assert.Equal(t, http.StatusOK, status)
+
+			websockettest.ExpectMessages[model.ChatMessage](receiver, 1, time.Second)
+			sender.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"envelopes chat messages by their message ID", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler(config.ChatWebSocketHandlerConfig{}))
+			conn := s.Dial("/chat/subscribe-websocket", chatQuery("bob", "alice"), websockettest.WithEnvelope())
+
+			s.PostJSON("/chat/forward-to-websocket", nil, chatMessage("alice", "bob", "hello"))
+
+			envelope := websockettest.ExpectEnvelopes(conn, 1, time.Second)[0]
+			assert.Equal(t, ChatMessageType, envelope.Type)
+			assert.Equal(t, "m1", envelope.ID)
+		},
+	)
+
+	t.Run(
+		"refuses subscriptions without the chat metadata", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler(config.ChatWebSocketHandlerConfig{}))
+
+			_, resp, err := s.TryDial("/chat/subscribe-websocket", url.Values{"stream_id": {"stream"}})
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		},
+	)
+
+	t.Run(
+		"answers how far the message was delivered", func(t *testing.T) {
+			errDelivery := errors.New("delivery failed")
+			tests := []struct {
+				name      string
+				delivered int
+				err       error
+				status    int
+			}{
+				{name: "partially", delivered: 1, err: errDelivery, status: http.StatusPartialContent},
+				{name: "not at all", delivered: 0, err: errDelivery, status: http.StatusInternalServerError},
+				// Retrying would only be dropped again
+				{name: "dropped by a rate limit", delivered: 0, err: websocket.ErrRateLimited, status: http.StatusOK},
+			}
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						s := websockettest.NewServer(
+							t, newTestHandler(config.ChatWebSocketHandlerConfig{}), websockettest.WithFakeBroadcast(
+								func(context.Context, string, []byte, ...websocket.BroadcastOptions) (
+									websocket.BroadcastResult, error,
+								) {
+									return websocket.BroadcastResult{DeliveredCount: tt.delivered}, tt.err
+								},
+							),
+						)
+
+						message := chatMessage("alice", "bob", "hello")
+						status, _ := s.PostJSON("/chat/forward-to-websocket", nil, message)
+						assert.Equal(t, tt.status, status)
+						s.ExpectBroadcasts(message.StreamID, 1, time.Second)
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"reports which connections missed a partially delivered message", func(t *testing.T) {
+			reports := []websocket.ConnectionDeliveryReport{
+				{ConnectionID: "phone", Metadata: websocket.Metadata{"sender_id": {"bob"}}},
+				{
+					ConnectionID: "laptop",
+					Metadata:     websocket.Metadata{"sender_id": {"bob"}},
+					Error:        websocket.ErrSendQueueFull.Error(),
+				},
+			}
+			s := websockettest.NewServer(
+				t, newTestHandler(config.ChatWebSocketHandlerConfig{}), websockettest.WithFakeBroadcast(
+					func(context.Context, string, []byte, ...websocket.BroadcastOptions) (
+						websocket.BroadcastResult, error,
+					) {
+						return websocket.BroadcastResult{DeliveredCount: 1, Connections: reports},
+							websocket.ErrSendQueueFull
+					},
+				),
+			)
+
+			status, response := s.PostJSON("/chat/forward-to-websocket", nil, chatMessage("alice", "bob", "hello"))
+			assert.Equal(t, http.StatusPartialContent, status)
+
+			var body struct {
+				Connections []websocket.ConnectionDeliveryReport `json:"connections"`
+			}
+			require.NoError(t, json.Unmarshal(response, &body))
+			assert.Equal(t, reports, body.Connections)
+		},
+	)
+
+	t.Run(
+		"closes the connections of a stream with the failover close code", func(t *testing.T) {
+			s := websockettest.NewServer(
+				t, newTestHandler(config.ChatWebSocketHandlerConfig{StreamFailoverCloseCode: 4001}),
+			)
+			sender := s.Dial("/chat/subscribe-websocket", chatQuery("alice", "bob"))
+			receiver := s.Dial("/chat/subscribe-websocket", chatQuery("bob", "alice"))
+			other := s.Dial("/chat/subscribe-websocket", chatQuery("alice", "carol"))
+
+			streamID := chatstream.ComputeStreamID("alice", "bob")
+
+			// Only the internal admin listener serves the route
+			status, _ := s.PostJSON("/chat/close-websocket-stream", nil, model.ChatStreamClose{StreamID: streamID})
+			assert.Equal(t, http.StatusNotFound, status)
+
+			status, response := s.PostAdminJSON("/chat/close-websocket-stream", model.ChatStreamClose{StreamID: streamID})
+			assert.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, `{"closed":2,"stream_id":"`+streamID+`"}`, string(response))
+
+			sender.ExpectClose(4001, time.Second)
+			receiver.ExpectClose(4001, time.Second)
+			s.ExpectConnections(streamID, 0, time.Second)
+			s.ExpectConnections(chatstream.ComputeStreamID("alice", "carol"), 1, time.Second)
+			other.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"rejects messages without content", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler(config.ChatWebSocketHandlerConfig{}))
+
+			status, _ := s.PostJSON("/chat/forward-to-websocket", nil, chatMessage("alice", "bob", ""))
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Empty(t, s.Manager.Broadcasts(chatstream.ComputeStreamID("alice", "bob")))
+		},
+	)
+}
+
+func TestAuthorizeChatStreamSubscription(t *testing.T) {
+	h := ChatWebSocketHandler{}
+	conn := &websocket.WebSocketConnection{Metadata: websocket.Metadata{"sender_id": {"alice"}}}
+
+	tests := []struct {
+		name    string
+		req     websocket.SubscriptionRequest
+		wantErr error
+	}{
+		{
+			name: "stream of the sender",
+			req: websocket.SubscriptionRequest{
+				Key: chatstream.ComputeStreamID("alice", "carol"), Params: map[string]string{"receiver_id": "carol"},
+			},
+		},
+		{
+			name:    "missing receiver",
+			req:     websocket.SubscriptionRequest{Key: chatstream.ComputeStreamID("alice", "carol")},
+			wantErr: ErrMissingReceiverID,
+		},
+		{
+			name: "stream of another sender",
+			req: websocket.SubscriptionRequest{
+				Key: chatstream.ComputeStreamID("bob", "carol"), Params: map[string]string{"receiver_id": "carol"},
+			},
+			wantErr: ErrStreamNotOwned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.ErrorIs(t, h.AuthorizeChatStreamSubscription(context.Background(), conn, tt.req), tt.wantErr)
+			},
+		)
+	}
+}
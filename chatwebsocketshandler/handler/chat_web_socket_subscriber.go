@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/domesama/chat-and-notifications/chatstream"
 	"github.com/domesama/chat-and-notifications/model"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/gin-gonic/gin"
@@ -24,3 +26,19 @@ func (c ChatWebSocketHandler) SubscribeChatWebSocketByStreamID(gctx *gin.Context
 	metadata = req.ToWebSocketMetadata()
 	return
 }
+
+// AuthorizeChatStreamSubscription lets a connection subscribe to the other chat streams of its sender, e.g. to receive
+// every conversation of the user over one connection. The key must be the stream between the sender and receiver_id
+func (c ChatWebSocketHandler) AuthorizeChatStreamSubscription(_ context.Context, conn *websocket.WebSocketConnection,
+	req websocket.SubscriptionRequest) error {
+	receiverID := req.Params["receiver_id"]
+	if receiverID == "" {
+		return ErrMissingReceiverID
+	}
+
+	senderIDs := conn.Metadata["sender_id"]
+	if len(senderIDs) == 0 || req.Key != chatstream.ComputeStreamID(senderIDs[0], receiverID) {
+		return ErrStreamNotOwned
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,8 +20,48 @@ func (c ChatWebSocketHandler) RegisterRoutes(engine *gin.Engine) error {
 	return nil
 }
 
+// RegisterAdminRoutes serves the routes disconnecting clients on the internal admin listener only,
+// see httpserverwrapper.WebSocketAdminConfig
+func (c ChatWebSocketHandler) RegisterAdminRoutes(engine *gin.Engine) error {
+	engine.POST("/chat/close-websocket-stream", c.CloseChatStreamConnections)
+	return nil
+}
+
 func (c ChatWebSocketHandler) RegisterWebSocketRoutes() httpserverwrapper.WebSocketRoutes {
+	presenceHooks := c.PresenceTracker.Hooks(presence.NamespaceChat)
 	return httpserverwrapper.WebSocketRoutes{
-		"/chat/subscribe-websocket": c.SubscribeChatWebSocketByStreamID,
+		"/chat/subscribe-websocket": {
+			Handler:       c.SubscribeChatWebSocketByStreamID,
+			OnConnect:     presenceHooks.OnConnect,
+			OnDisconnect:  presenceHooks.OnDisconnect,
+			Authorize:     c.AuthorizeChatStreamSubscription,
+			OnSubscribe:   presenceHooks.OnSubscribe,
+			OnUnsubscribe: presenceHooks.OnUnsubscribe,
+			Upgrade:       c.Config.Upgrade,
+		},
+	}
+}
+
+// RegisterSSERoutes serves the chat streams as Server-Sent Events to the clients that can't upgrade to WebSocket
+func (c ChatWebSocketHandler) RegisterSSERoutes() httpserverwrapper.SSERoutes {
+	presenceHooks := c.PresenceTracker.Hooks(presence.NamespaceChat)
+	return httpserverwrapper.SSERoutes{
+		"/chat/subscribe-sse": {
+			Handler:      c.SubscribeChatWebSocketByStreamID,
+			OnConnect:    presenceHooks.OnConnect,
+			OnDisconnect: presenceHooks.OnDisconnect,
+		},
+	}
+}
+
+// RegisterLongPollRoutes serves the chat streams over long-polling to the clients that can use neither WebSocket nor SSE
+func (c ChatWebSocketHandler) RegisterLongPollRoutes() httpserverwrapper.LongPollRoutes {
+	presenceHooks := c.PresenceTracker.Hooks(presence.NamespaceChat)
+	return httpserverwrapper.LongPollRoutes{
+		"/chat/subscribe-poll": {
+			Handler:      c.SubscribeChatWebSocketByStreamID,
+			OnConnect:    presenceHooks.OnConnect,
+			OnDisconnect: presenceHooks.OnDisconnect,
+		},
 	}
 }
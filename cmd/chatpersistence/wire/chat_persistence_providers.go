@@ -5,19 +5,22 @@ package wire
 import (
 	"github.com/google/wire"
 
+	jwvkhconfig "github.com/domesama/chat-and-notifications/chatpersistence/config"
 	jwvkhhandler "github.com/domesama/chat-and-notifications/chatpersistence/handler"
 	jwvkhservice "github.com/domesama/chat-and-notifications/chatpersistence/service"
 	hyhnghttpserverwrapper "github.com/domesama/chat-and-notifications/httpserverwrapper"
 )
 
 var ProviderSet = wire.NewSet(
+	jwvkhconfig.ProvideChatHistoryConfig,
 	wire.Struct(new(jwvkhhandler.ChatPersistenceHandler), "*"),
 	jwvkhhandler.ProvideRouterCustomizer,
-	wire.Struct(new(jwvkhservice.ChatPersistenceService), "*"),
+	jwvkhservice.ProvideChatPersistenceService,
 )
 
 type Locator struct {
+	ChatHistoryConfig      jwvkhconfig.ChatHistoryConfig
 	ChatPersistenceHandler *jwvkhhandler.ChatPersistenceHandler
 	RouterCustomizer       hyhnghttpserverwrapper.RouterCustomizer
-	ChatPersistenceService *jwvkhservice.ChatPersistenceService
+	ChatPersistenceService jwvkhservice.ChatPersistenceService
 }
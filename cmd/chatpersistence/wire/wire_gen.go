@@ -7,6 +7,7 @@
 package wire
 
 import (
+	"github.com/domesama/chat-and-notifications/chatpersistence/config"
 	"github.com/domesama/chat-and-notifications/chatpersistence/handler"
 	"github.com/domesama/chat-and-notifications/chatpersistence/service"
 	"github.com/domesama/chat-and-notifications/connections"
@@ -40,8 +41,12 @@ func StartChatPersistenceContainer() (ChatPersistenceContainer, func(), error) {
 		return ChatPersistenceContainer{}, nil, err
 	}
 	database := connections.ProvideMongoDatabase(client, mongoDBConfig)
-	chatPersistenceService := service.ChatPersistenceService{
-		DB: database,
+	chatHistoryConfig := config.ProvideChatHistoryConfig()
+	chatPersistenceService, err := service.ProvideChatPersistenceService(database, chatHistoryConfig)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return ChatPersistenceContainer{}, nil, err
 	}
 	chatPersistenceHandler := handler.ChatPersistenceHandler{
 		ChatPersistenceService: chatPersistenceService,
@@ -4,6 +4,7 @@ import (
 	"github.com/domesama/chat-and-notifications/chatpersistencechangehandler"
 	"github.com/domesama/chat-and-notifications/connections"
 	"github.com/domesama/chat-and-notifications/eventstore"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/doakes/doakeswire"
 	doakes "github.com/domesama/doakes/server"
 	"github.com/google/wire"
@@ -26,6 +27,7 @@ var MainBindingSet = wire.NewSet(
 
 	connections.RedisSet,
 	eventstore.ProvideRedisEventStoreConfig,
+	presence.ProvidePresenceDirectory,
 
 	wire.Struct(new(ChatPersistenceChangeHandlerContainer), "*"),
 )
@@ -13,6 +13,7 @@ import (
 	"github.com/domesama/chat-and-notifications/connections"
 	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
 	"github.com/domesama/chat-and-notifications/eventstore"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/doakes/doakeswire"
 )
 
@@ -33,19 +34,21 @@ func StartChatPersistenceChangeHandlerContainer(chatPersistenceChangeHandlerConf
 	if err != nil {
 		return ChatPersistenceChangeHandlerContainer{}, nil, err
 	}
-	chatMessageSyncService := service.ChatMessageSyncService{
-		Config: chatPersistenceChangeHandlerConfig,
-	}
-	chatPersistenceChangeMessageHandler := chatpersistencechangehandler.ChatPersistenceChangeMessageHandler{
-		ChatMessageSyncService: chatMessageSyncService,
-	}
-	chatPersistenceChangeEventMetric := chatpersistencechangehandler.ProvideChatPersistenceChangeEventMetric()
 	redisClientConfig := connectionconfig.ProvideRedisClientConfig()
 	client, cleanup2, err := connections.ProvideRedisClient(redisClientConfig)
 	if err != nil {
 		cleanup()
 		return ChatPersistenceChangeHandlerContainer{}, nil, err
 	}
+	directory := presence.ProvidePresenceDirectory(client)
+	chatMessageSyncService := service.ChatMessageSyncService{
+		Config:            chatPersistenceChangeHandlerConfig,
+		PresenceDirectory: directory,
+	}
+	chatPersistenceChangeMessageHandler := chatpersistencechangehandler.ChatPersistenceChangeMessageHandler{
+		ChatMessageSyncService: chatMessageSyncService,
+	}
+	chatPersistenceChangeEventMetric := chatpersistencechangehandler.ProvideChatPersistenceChangeEventMetric()
 	redisEventStoreConfig := eventstore.ProvideRedisEventStoreConfig()
 	chatPersistenceChangeEventStore := chatpersistencechangehandler.ProvideChatPersistenceChangeEventStore(client, redisEventStoreConfig)
 	chatPersistenceChangeHandler, cleanup3, err := chatpersistencechangehandler.ProvideChatPersistenceChangeHandler(chatPersistenceChangeHandlerConfig, telemetryServer, chatPersistenceChangeMessageHandler, chatPersistenceChangeEventMetric, chatPersistenceChangeEventStore)
@@ -2,11 +2,14 @@ package wire
 
 import (
 	"github.com/domesama/chat-and-notifications/connections"
+	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 	doakes "github.com/domesama/doakes/server"
 	"github.com/google/wire"
+	"github.com/redis/go-redis/v9"
 )
 
 //go:generate wireprovider -source_root ../../../chatwebsocketshandler/ -out ../wire/chat_websocket_handler_providers.go -go_module_name "github.com/domesama/chat-and-notifications/chatwebsocketshandler" -out_package "github.com/domesama/chat-and-notifications/cmd/chatwebsocketshandler/wire"
@@ -14,6 +17,9 @@ import (
 type ChatWebSocketHandlerContainer struct {
 	httpserverwrapper.HTTPWithWebSocketServer
 	*doakes.TelemetryServer
+
+	// AdminServer serves the WebSocket admin routes on the internal listener, see WebSocketAdminConfig
+	AdminServer httpserverwrapper.WebSocketAdminServer
 }
 
 func (r *ChatWebSocketHandlerContainer) GetMonitoringServer() *doakes.TelemetryServer {
@@ -27,10 +33,17 @@ var MainBindingSet = wire.NewSet(
 	ProviderSet,
 
 	websocket.ProvideWebSocketConfig,
-	websocket.ProvideDefaultWebSocketManager,
+	websocket.ProvideWebSocketManager,
+	websocket.ProvideWebSocketMetric,
+
+	presence.ProvidePresenceConfig,
+	presence.ProvidePresenceTracker,
 
 	httpserverwrapper.ProvideHTTPConfig,
 	httpserverwrapper.ProvideHTTPWithWebSocketServer,
+	httpserverwrapper.ProvideLongPollConfig,
+	httpserverwrapper.ProvideWebSocketAdminConfig,
+	httpserverwrapper.ProvideWebSocketAdminServer,
 
 	wire.Struct(new(ChatWebSocketHandlerContainer), "*"),
 )
@@ -41,4 +54,18 @@ var LibSet = wire.NewSet(
 
 var ConnectionSet = wire.NewSet(
 	connections.MongoSet,
+	ProvideOptionalRedisClient,
 )
+
+// ProvideOptionalRedisClient connects to Redis with the providers of connections.RedisSet only when the redis_pubsub
+// manager backend or presence needs it, other deployments run without Redis and get a nil client
+func ProvideOptionalRedisClient(wsCfg websocket.WebSocketConfig, presenceCfg presence.PresenceConfig) (
+	*redis.Client, func(), error,
+) {
+	if wsCfg.ManagerBackend != websocket.ManagerBackendRedisPubSub && !presenceCfg.Enabled {
+		return nil, func() {}, nil
+	}
+
+	client, cleanup, err := connections.ProvideRedisClient(connectionconfig.ProvideRedisClientConfig())
+	return &client, cleanup, err
+}
@@ -5,19 +5,22 @@ package wire
 import (
 	"github.com/google/wire"
 
+	cykpkconfig "github.com/domesama/chat-and-notifications/chatwebsocketshandler/config"
 	cykpkhandler "github.com/domesama/chat-and-notifications/chatwebsocketshandler/handler"
 	cykpkservice "github.com/domesama/chat-and-notifications/chatwebsocketshandler/service"
 	hyhnghttpserverwrapper "github.com/domesama/chat-and-notifications/httpserverwrapper"
 )
 
 var ProviderSet = wire.NewSet(
+	cykpkconfig.ProvideChatWebSocketHandlerConfig,
 	wire.Struct(new(cykpkhandler.ChatWebSocketHandler), "*"),
 	cykpkhandler.ProvideRouterCustomizer,
 	wire.Struct(new(cykpkservice.ChatPersistenceService), "*"),
 )
 
 type Locator struct {
-	ChatWebSocketHandler   *cykpkhandler.ChatWebSocketHandler
-	RouterCustomizer       hyhnghttpserverwrapper.RouterWithWebSocketCustomizer
-	ChatPersistenceService *cykpkservice.ChatPersistenceService
+	ChatWebSocketHandlerConfig cykpkconfig.ChatWebSocketHandlerConfig
+	ChatWebSocketHandler       *cykpkhandler.ChatWebSocketHandler
+	RouterCustomizer           hyhnghttpserverwrapper.RouterWithWebSocketCustomizer
+	ChatPersistenceService     *cykpkservice.ChatPersistenceService
 }
@@ -7,8 +7,10 @@
 package wire
 
 import (
+	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/config"
 	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/handler"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 )
@@ -18,37 +20,86 @@ import (
 func StartChatWebSocketHandlerContainer() (ChatWebSocketHandlerContainer, func(), error) {
 	httpServerConfig := httpserverwrapper.ProvideHTTPConfig()
 	webSocketConfig := websocket.ProvideWebSocketConfig()
-	webSocketManager := websocket.ProvideDefaultWebSocketManager(webSocketConfig)
-	chatWebSocketHandler := handler.ChatWebSocketHandler{
-		WebSocketManager: webSocketManager,
+	presenceConfig := presence.ProvidePresenceConfig()
+	client, cleanup, err := ProvideOptionalRedisClient(webSocketConfig, presenceConfig)
+	if err != nil {
+		return ChatWebSocketHandlerContainer{}, nil, err
 	}
-	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(chatWebSocketHandler)
-	httpWithWebSocketServer, cleanup, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager)
+	webSocketMetric, err := websocket.ProvideWebSocketMetric()
+	if err != nil {
+		cleanup()
+		return ChatWebSocketHandlerContainer{}, nil, err
+	}
+	webSocketManager, cleanup2, err := websocket.ProvideWebSocketManager(webSocketConfig, client, webSocketMetric)
+	if err != nil {
+		cleanup()
+		return ChatWebSocketHandlerContainer{}, nil, err
+	}
+	tracker, cleanup3, err := presence.ProvidePresenceTracker(presenceConfig, client)
 	if err != nil {
+		cleanup2()
+		cleanup()
 		return ChatWebSocketHandlerContainer{}, nil, err
 	}
+	chatWebSocketHandlerConfig := config.ProvideChatWebSocketHandlerConfig()
+	chatWebSocketHandler := handler.ChatWebSocketHandler{
+		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           chatWebSocketHandlerConfig,
+	}
+	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(chatWebSocketHandler)
 	resource, err := doakeswire.ProvideResource()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerContainer{}, nil, err
 	}
 	metricsConfig := doakeswire.ProvideMetricsConfig()
 	telemetryServerConfig, err := doakeswire.ProvideTelemetryServerConfig()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerContainer{}, nil, err
 	}
 	options := doakeswire.ProvideServerOptions(resource, metricsConfig, telemetryServerConfig)
-	telemetryServer, cleanup2, err := doakeswire.ProvideServer(options)
+	telemetryServer, cleanup4, err := doakeswire.ProvideServer(options)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return ChatWebSocketHandlerContainer{}, nil, err
+	}
+	longPollConfig := httpserverwrapper.ProvideLongPollConfig()
+	httpWithWebSocketServer, cleanup5, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager, telemetryServer, longPollConfig)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return ChatWebSocketHandlerContainer{}, nil, err
+	}
+	webSocketAdminConfig := httpserverwrapper.ProvideWebSocketAdminConfig()
+	webSocketAdminServer, cleanup6, err := httpserverwrapper.ProvideWebSocketAdminServer(webSocketAdminConfig, httpServerConfig, webSocketManager, routerWithWebSocketCustomizer)
 	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerContainer{}, nil, err
 	}
 	chatWebSocketHandlerContainer := ChatWebSocketHandlerContainer{
 		HTTPWithWebSocketServer: httpWithWebSocketServer,
 		TelemetryServer:         telemetryServer,
+		AdminServer:             webSocketAdminServer,
 	}
 	return chatWebSocketHandlerContainer, func() {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 	}, nil
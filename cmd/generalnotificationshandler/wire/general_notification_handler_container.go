@@ -1,11 +1,15 @@
 package wire
 
 import (
+	"github.com/domesama/chat-and-notifications/connections"
+	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 	doakes "github.com/domesama/doakes/server"
 	"github.com/google/wire"
+	"github.com/redis/go-redis/v9"
 )
 
 //go:generate wireprovider -source_root ../../../generalnotifications/ -out ../wire/general_notification_handler_providers.go -go_module_name "github.com/domesama/chat-and-notifications/generalnotifications" -out_package "github.com/domesama/chat-and-notifications/cmd/generalnotificationshandler/wire"
@@ -13,6 +17,9 @@ import (
 type GeneralNotificationHandlerContainer struct {
 	httpserverwrapper.HTTPWithWebSocketServer
 	*doakes.TelemetryServer
+
+	// AdminServer serves the WebSocket admin routes on the internal listener, see WebSocketAdminConfig
+	AdminServer httpserverwrapper.WebSocketAdminServer
 }
 
 func (r *GeneralNotificationHandlerContainer) GetMonitoringServer() *doakes.TelemetryServer {
@@ -21,14 +28,22 @@ func (r *GeneralNotificationHandlerContainer) GetMonitoringServer() *doakes.Tele
 
 var MainBindingSet = wire.NewSet(
 	LibSet,
+	ConnectionSet,
 
 	ProviderSet,
 
 	websocket.ProvideWebSocketConfig,
-	websocket.ProvideDefaultWebSocketManager,
+	websocket.ProvideWebSocketManager,
+	websocket.ProvideWebSocketMetric,
+
+	presence.ProvidePresenceConfig,
+	presence.ProvidePresenceTracker,
 
 	httpserverwrapper.ProvideHTTPConfig,
 	httpserverwrapper.ProvideHTTPWithWebSocketServer,
+	httpserverwrapper.ProvideLongPollConfig,
+	httpserverwrapper.ProvideWebSocketAdminConfig,
+	httpserverwrapper.ProvideWebSocketAdminServer,
 
 	wire.Struct(new(GeneralNotificationHandlerContainer), "*"),
 )
@@ -36,3 +51,20 @@ var MainBindingSet = wire.NewSet(
 var LibSet = wire.NewSet(
 	doakeswire.TelemetrySetWithAutoStart,
 )
+
+var ConnectionSet = wire.NewSet(
+	ProvideOptionalRedisClient,
+)
+
+// ProvideOptionalRedisClient connects to Redis with the providers of connections.RedisSet only when the redis_pubsub
+// manager backend or presence needs it, other deployments run without Redis and get a nil client
+func ProvideOptionalRedisClient(wsCfg websocket.WebSocketConfig, presenceCfg presence.PresenceConfig) (
+	*redis.Client, func(), error,
+) {
+	if wsCfg.ManagerBackend != websocket.ManagerBackendRedisPubSub && !presenceCfg.Enabled {
+		return nil, func() {}, nil
+	}
+
+	client, cleanup, err := connections.ProvideRedisClient(connectionconfig.ProvideRedisClientConfig())
+	return &client, cleanup, err
+}
@@ -5,16 +5,19 @@ package wire
 import (
 	"github.com/google/wire"
 
+	cxiyrconfig "github.com/domesama/chat-and-notifications/generalnotifications/config"
 	cxiyrhandler "github.com/domesama/chat-and-notifications/generalnotifications/handler"
 	hyhnghttpserverwrapper "github.com/domesama/chat-and-notifications/httpserverwrapper"
 )
 
 var ProviderSet = wire.NewSet(
+	cxiyrconfig.ProvideGeneralNotificationHandlerConfig,
 	wire.Struct(new(cxiyrhandler.GeneralNotificationWebSocketHandler), "*"),
 	cxiyrhandler.ProvideRouterCustomizer,
 )
 
 type Locator struct {
+	GeneralNotificationHandlerConfig    cxiyrconfig.GeneralNotificationHandlerConfig
 	GeneralNotificationWebSocketHandler *cxiyrhandler.GeneralNotificationWebSocketHandler
 	RouterCustomizer                    hyhnghttpserverwrapper.RouterWithWebSocketCustomizer
 }
@@ -7,8 +7,10 @@
 package wire
 
 import (
+	"github.com/domesama/chat-and-notifications/generalnotifications/config"
 	"github.com/domesama/chat-and-notifications/generalnotifications/handler"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 )
@@ -18,37 +20,86 @@ import (
 func StartGeneralNotificationHandlerContainer() (GeneralNotificationHandlerContainer, func(), error) {
 	httpServerConfig := httpserverwrapper.ProvideHTTPConfig()
 	webSocketConfig := websocket.ProvideWebSocketConfig()
-	webSocketManager := websocket.ProvideDefaultWebSocketManager(webSocketConfig)
-	generalNotificationWebSocketHandler := handler.GeneralNotificationWebSocketHandler{
-		WebSocketManager: webSocketManager,
+	presenceConfig := presence.ProvidePresenceConfig()
+	client, cleanup, err := ProvideOptionalRedisClient(webSocketConfig, presenceConfig)
+	if err != nil {
+		return GeneralNotificationHandlerContainer{}, nil, err
 	}
-	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(generalNotificationWebSocketHandler)
-	httpWithWebSocketServer, cleanup, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager)
+	webSocketMetric, err := websocket.ProvideWebSocketMetric()
+	if err != nil {
+		cleanup()
+		return GeneralNotificationHandlerContainer{}, nil, err
+	}
+	webSocketManager, cleanup2, err := websocket.ProvideWebSocketManager(webSocketConfig, client, webSocketMetric)
+	if err != nil {
+		cleanup()
+		return GeneralNotificationHandlerContainer{}, nil, err
+	}
+	tracker, cleanup3, err := presence.ProvidePresenceTracker(presenceConfig, client)
 	if err != nil {
+		cleanup2()
+		cleanup()
 		return GeneralNotificationHandlerContainer{}, nil, err
 	}
+	generalNotificationHandlerConfig := config.ProvideGeneralNotificationHandlerConfig()
+	generalNotificationWebSocketHandler := handler.GeneralNotificationWebSocketHandler{
+		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           generalNotificationHandlerConfig,
+	}
+	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(generalNotificationWebSocketHandler)
 	resource, err := doakeswire.ProvideResource()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerContainer{}, nil, err
 	}
 	metricsConfig := doakeswire.ProvideMetricsConfig()
 	telemetryServerConfig, err := doakeswire.ProvideTelemetryServerConfig()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerContainer{}, nil, err
 	}
 	options := doakeswire.ProvideServerOptions(resource, metricsConfig, telemetryServerConfig)
-	telemetryServer, cleanup2, err := doakeswire.ProvideServer(options)
+	telemetryServer, cleanup4, err := doakeswire.ProvideServer(options)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return GeneralNotificationHandlerContainer{}, nil, err
+	}
+	longPollConfig := httpserverwrapper.ProvideLongPollConfig()
+	httpWithWebSocketServer, cleanup5, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager, telemetryServer, longPollConfig)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return GeneralNotificationHandlerContainer{}, nil, err
+	}
+	webSocketAdminConfig := httpserverwrapper.ProvideWebSocketAdminConfig()
+	webSocketAdminServer, cleanup6, err := httpserverwrapper.ProvideWebSocketAdminServer(webSocketAdminConfig, httpServerConfig, webSocketManager, routerWithWebSocketCustomizer)
 	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerContainer{}, nil, err
 	}
 	generalNotificationHandlerContainer := GeneralNotificationHandlerContainer{
 		HTTPWithWebSocketServer: httpWithWebSocketServer,
 		TelemetryServer:         telemetryServer,
+		AdminServer:             webSocketAdminServer,
 	}
 	return generalNotificationHandlerContainer, func() {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 	}, nil
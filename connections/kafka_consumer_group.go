@@ -1,6 +1,8 @@
 package connections
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/IBM/sarama"
@@ -14,12 +16,26 @@ func NewConsumerGroup(
 	kafkaInfo connectionconfig.KafkaConsumerInfo,
 	monitoringServer *doakes.TelemetryServer,
 	handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+	opts ...ConsumerGroupOptions,
 ) (kafkawrapper.ConsumerGroup, func(), error) {
+	optionalParam := ConsumerGroupOptionalParams{}
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+
 	consumerName := kafkaInfo.ConsumerName
 	topicName := kafkaInfo.TopicName
 	ignoreOldMessage := kafkaInfo.IgnoreOldMessage
 
-	wrappedHandler := kafkawrapper.WrapWithRetryBackoffHandler(handler, kafkaInfo.MessageRetryConfig)
+	var retryBackoff retryBackoffWrapper = func(
+		handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+	) kafkawrapper.MessageHandler[*sarama.ConsumerMessage] {
+		return kafkawrapper.WrapWithRetryBackoffHandler(handler, kafkaInfo.MessageRetryConfig)
+	}
+	wrappedHandler := retryBackoff(handler)
+	if optionalParam.OnRetriesExhausted != nil {
+		wrappedHandler = withRetriesExhaustedHandler(handler, retryBackoff, optionalParam.OnRetriesExhausted)
+	}
 
 	consumer, err := kafkawrapper.NewConsumerGroup(kafkaCfg, consumerName, topicName, ignoreOldMessage, wrappedHandler)
 	if err != nil {
@@ -37,3 +53,51 @@ func NewConsumerGroup(
 
 	return consumer, func() { consumer.Close() }, consumer.Start()
 }
+
+// withRetriesExhaustedHandler wraps the handler with the retry backoff and calls onExhausted when it gives up on a
+// message, i.e. when it returns the error of the last attempt of the handler. Errors caused by the context being done,
+// e.g. on shutdown or rebalance, are not exhaustion: the message is consumed again
+func withRetriesExhaustedHandler(
+	handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+	retryBackoff retryBackoffWrapper,
+	onExhausted RetriesExhaustedHandler,
+) kafkawrapper.MessageHandler[*sarama.ConsumerMessage] {
+	recordedHandler := retryBackoff(
+		func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			err := handler(ctx, msg)
+			if attempt, ok := ctx.Value(lastAttemptKey{}).(*lastAttempt); ok {
+				attempt.err = err
+			}
+			return err
+		},
+	)
+
+	return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		attempt := &lastAttempt{}
+		err := recordedHandler(context.WithValue(ctx, lastAttemptKey{}, attempt), msg)
+		if err == nil || ctx.Err() != nil || isContextError(err) {
+			return err
+		}
+		// The retry backoff may also give up without a last attempt failing, e.g. while waiting for the next one
+		if attempt.err != nil && errors.Is(err, attempt.err) {
+			onExhausted(ctx, msg, err)
+		}
+		return err
+	}
+}
+
+type retryBackoffWrapper func(
+	handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+) kafkawrapper.MessageHandler[*sarama.ConsumerMessage]
+
+// lastAttempt records the error of the last attempt of a message, it is passed through the context of the message
+// since the retry backoff calls the handler sequentially
+type lastAttempt struct {
+	err error
+}
+
+type lastAttemptKey struct{}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
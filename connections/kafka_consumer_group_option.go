@@ -0,0 +1,24 @@
+package connections
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// RetriesExhaustedHandler is called with a message whose handler still failed after its last retry
+type RetriesExhaustedHandler func(ctx context.Context, msg *sarama.ConsumerMessage, err error)
+
+type ConsumerGroupOptionalParams struct {
+	OnRetriesExhausted RetriesExhaustedHandler
+}
+
+type ConsumerGroupOptions func(optionalParam *ConsumerGroupOptionalParams)
+
+// WithRetriesExhaustedHandler lets the consumer fail over on the messages it gives up on, e.g. to tell the clients
+// that they missed a message
+func WithRetriesExhaustedHandler(handler RetriesExhaustedHandler) ConsumerGroupOptions {
+	return func(optionalParam *ConsumerGroupOptionalParams) {
+		optionalParam.OnRetriesExhausted = handler
+	}
+}
@@ -0,0 +1,115 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/domesama/kafkawrapper"
+	"github.com/stretchr/testify/assert"
+)
+
+// retryTimes retries a message up to the given number of attempts, stopping once the context is done
+func retryTimes(attempts int) retryBackoffWrapper {
+	return func(
+		handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+	) kafkawrapper.MessageHandler[*sarama.ConsumerMessage] {
+		return func(ctx context.Context, msg *sarama.ConsumerMessage) (err error) {
+			for range attempts {
+				if err = handler(ctx, msg); err == nil {
+					return nil
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+			return err
+		}
+	}
+}
+
+func TestWithRetriesExhaustedHandler(t *testing.T) {
+	errFailed := errors.New("failed")
+	msg := &sarama.ConsumerMessage{}
+
+	var exhausted []error
+	onExhausted := func(_ context.Context, _ *sarama.ConsumerMessage, err error) {
+		exhausted = append(exhausted, err)
+	}
+
+	t.Run(
+		"the message is given up on once its retries ran out", func(t *testing.T) {
+			exhausted = nil
+			var attempts int
+			handler := withRetriesExhaustedHandler(
+				func(context.Context, *sarama.ConsumerMessage) error {
+					attempts++
+					return errFailed
+				}, retryTimes(3), onExhausted,
+			)
+
+			assert.ErrorIs(t, handler(context.Background(), msg), errFailed)
+			assert.Equal(t, 3, attempts)
+			assert.Equal(t, []error{errFailed}, exhausted)
+		},
+	)
+
+	t.Run(
+		"a message succeeding on a retry is not given up on", func(t *testing.T) {
+			exhausted = nil
+			var attempts int
+			handler := withRetriesExhaustedHandler(
+				func(context.Context, *sarama.ConsumerMessage) error {
+					if attempts++; attempts < 2 {
+						return errFailed
+					}
+					return nil
+				}, retryTimes(3), onExhausted,
+			)
+
+			assert.NoError(t, handler(context.Background(), msg))
+			assert.Empty(t, exhausted)
+		},
+	)
+
+	t.Run(
+		"a message whose context is canceled is not given up on", func(t *testing.T) {
+			exhausted = nil
+			ctx, cancel := context.WithCancel(context.Background())
+			handler := withRetriesExhaustedHandler(
+				func(context.Context, *sarama.ConsumerMessage) error {
+					// e.g. an HTTP call failing on shutdown with an error that doesn't wrap the context error
+					cancel()
+					return errFailed
+				}, retryTimes(3), onExhausted,
+			)
+
+			assert.ErrorIs(t, handler(ctx, msg), context.Canceled)
+			assert.Empty(t, exhausted)
+		},
+	)
+
+	t.Run(
+		"errors not returned by the last attempt are not exhaustion", func(t *testing.T) {
+			exhausted = nil
+			errGaveUp := errors.New("retry backoff stopped")
+			handler := withRetriesExhaustedHandler(
+				func(context.Context, *sarama.ConsumerMessage) error {
+					return errFailed
+				},
+				func(
+					handler kafkawrapper.MessageHandler[*sarama.ConsumerMessage],
+				) kafkawrapper.MessageHandler[*sarama.ConsumerMessage] {
+					return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+						_ = handler(ctx, msg)
+						return errGaveUp
+					}
+				}, onExhausted,
+			)
+
+			assert.ErrorIs(t, handler(context.Background(), msg), errGaveUp)
+			assert.Empty(t, exhausted)
+		},
+	)
+}
@@ -37,6 +37,14 @@ func (m EventMetric) IncrementDropDueToFailedEventStoreValidation(ctx context.Co
 	)
 }
 
+func (m EventMetric) IncrementDropDueToExhaustedRetries(ctx context.Context) {
+	slog.Error("[HandleEvent] Event dropped due to", "reason", EventReasonRetriesExhausted)
+	m.DroppedEventMetric.Add(
+		ctx, 1,
+		CreateMetricLabel(EventAttributeDropReason, EventReasonRetriesExhausted),
+	)
+}
+
 func (m EventMetric) IncrementDropWithCustomReason(ctx context.Context, reason string) {
 	slog.Warn("[HandleEvent] Event dropped due to", "reason", reason)
 	m.DroppedEventMetric.Add(
@@ -22,6 +22,7 @@ const (
 const (
 	EventReasonInvalidEvent                    MetricLabelValue = "invalid_format"
 	EventReasonDroppedFromEventStoreValidation MetricLabelValue = "dropped_from_event_store_validation"
+	EventReasonRetriesExhausted                MetricLabelValue = "retries_exhausted"
 )
 
 func (m MetricType) GetMetricName(name string) string {
@@ -23,6 +23,9 @@ type BatchMessageHandler[MsgValue any] interface {
 	HandleMessages(ctx context.Context, eventType string, messageValue ...eventmsg.Message[MsgValue]) error
 }
 
+// RetriesExhaustedHandler fails over on a message that could not be handled within its retries
+type RetriesExhaustedHandler[MsgValue any] func(ctx context.Context, msg eventmsg.Message[MsgValue], err error)
+
 func covertSaramaMessagePayload[MsgValue any](handler BaseMessageHandler[MsgValue], msg *sarama.ConsumerMessage) (
 	res eventmsg.Message[MsgValue], shouldDrop bool,
 ) {
@@ -11,9 +11,10 @@ import (
 )
 
 type SingleEventHandler[MsgValue any] struct {
-	MessageHandler SingleMessageHandler[MsgValue]
-	EventMetric    *EventMetric
-	EventStore     eventstore.EventStore[MsgValue]
+	MessageHandler     SingleMessageHandler[MsgValue]
+	EventMetric        *EventMetric
+	EventStore         eventstore.EventStore[MsgValue]
+	OnRetriesExhausted RetriesExhaustedHandler[MsgValue]
 }
 
 func NewSingleEventHandler[MsgValue any](
@@ -24,9 +25,10 @@ func NewSingleEventHandler[MsgValue any](
 
 	optionalParam := bindEventHandlerOptions[MsgValue](options...)
 	return SingleEventHandler[MsgValue]{
-		MessageHandler: handler,
-		EventMetric:    metric,
-		EventStore:     optionalParam.EventStore,
+		MessageHandler:     handler,
+		EventMetric:        metric,
+		EventStore:         optionalParam.EventStore,
+		OnRetriesExhausted: optionalParam.OnRetriesExhausted,
 	}
 }
 
@@ -63,3 +65,18 @@ func (e SingleEventHandler[MsgValue]) HandleEvent(ctx context.Context, msg *sara
 	e.EventMetric.SuccessEventMetric.Add(ctx, 1, CreateEventTypeLabel(e.MessageHandler, message))
 	return nil
 }
+
+// HandleRetriesExhausted counts the message as dropped and passes it to the OnRetriesExhausted handler,
+// see connections.WithRetriesExhaustedHandler
+func (e SingleEventHandler[MsgValue]) HandleRetriesExhausted(ctx context.Context, msg *sarama.ConsumerMessage,
+	err error) {
+	message, shouldDrop := covertSaramaMessagePayload(e.MessageHandler, msg)
+	if shouldDrop {
+		return
+	}
+
+	e.EventMetric.IncrementDropDueToExhaustedRetries(ctx)
+	if e.OnRetriesExhausted != nil {
+		e.OnRetriesExhausted(ctx, message, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 type SingleEventHandlerOptionalParams[MsgValue any] struct {
 	EventStore         eventstore.EventStore[MsgValue]
 	ShouldRetryMessage func(ctx context.Context, name string, msg MsgValue)
+	OnRetriesExhausted RetriesExhaustedHandler[MsgValue]
 }
 
 type SingleEventHandlerOptions[MsgValue any] func(optionalParam *SingleEventHandlerOptionalParams[MsgValue])
@@ -19,6 +20,13 @@ func WithEventStore[MsgValue any](eventStore eventstore.EventStore[MsgValue]) Si
 	}
 }
 
+// WithRetriesExhaustedHandler is called by HandleRetriesExhausted with the messages the consumer gave up on
+func WithRetriesExhaustedHandler[MsgValue any](handler RetriesExhaustedHandler[MsgValue]) SingleEventHandlerOptions[MsgValue] {
+	return func(optionalParam *SingleEventHandlerOptionalParams[MsgValue]) {
+		optionalParam.OnRetriesExhausted = handler
+	}
+}
+
 func bindEventHandlerOptions[MsgValue any](opts ...SingleEventHandlerOptions[MsgValue]) SingleEventHandlerOptionalParams[MsgValue] {
 	optionalParam := SingleEventHandlerOptionalParams[MsgValue]{
 		EventStore: eventstore.NoOpEventStore[MsgValue]{},
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type GeneralNotificationHandlerConfig struct {
+	Upgrade httpserverwrapper.WebSocketUpgradeConfig `envconfig:"NOTIFICATION_WEBSOCKET"`
+
+	// MulticastMaxUsers is the number of users a multicast notification can be sent to, 0 for no limit
+	MulticastMaxUsers int `envconfig:"NOTIFICATION_MULTICAST_MAX_USERS" default:"1000"`
+}
+
+func ProvideGeneralNotificationHandlerConfig() (conf GeneralNotificationHandlerConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
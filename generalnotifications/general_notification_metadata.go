@@ -1,6 +1,8 @@
 package generalnotifications
 
 import (
+	"encoding/json"
+
 	"github.com/domesama/chat-and-notifications/websocket"
 )
 
@@ -14,3 +16,10 @@ func (n NotificationMetadata) ToWebSocketMetadata() websocket.Metadata {
 		"user_id": {n.UserID},
 	}
 }
+
+// NotificationMulticastRequest is the body of a multicast notification, the payload is bound to the model of the
+// notification type, e.g. {"user_ids": ["u1", "u2"], "payload": {...}}
+type NotificationMulticastRequest struct {
+	UserIDs []string        `json:"user_ids" binding:"required,min=1,dive,required"`
+	Payload json.RawMessage `json:"payload" binding:"required"`
+}
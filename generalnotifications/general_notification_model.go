@@ -2,11 +2,14 @@ package generalnotifications
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // NotificationEnvelope is the wrapper structure sent over WebSocket
 // Frontend can parse the payload field based on notification_type
 type NotificationEnvelope struct {
+	ID               string           `json:"id"`
 	NotificationType NotificationType `json:"notification_type"`
 	Timestamp        time.Time        `json:"timestamp"`
 	Payload          any              `json:"payload"`
@@ -16,6 +19,7 @@ type NotificationEnvelope struct {
 func NewNotificationEnvelope(notificationType NotificationType,
 	payload interface{}) NotificationEnvelope {
 	return NotificationEnvelope{
+		ID:               uuid.NewString(),
 		NotificationType: notificationType,
 		Timestamp:        time.Now(),
 		Payload:          payload,
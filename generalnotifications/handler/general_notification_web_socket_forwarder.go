@@ -2,11 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/domesama/chat-and-notifications/generalnotifications"
+	"github.com/domesama/chat-and-notifications/generalnotifications/config"
 	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/gin-gonic/gin"
 )
@@ -14,46 +17,40 @@ import (
 // @@wire-struct@@
 type GeneralNotificationWebSocketHandler struct {
 	WebSocketManager websocket.WebSocketManager
+	PresenceTracker  *presence.Tracker
+	Config           config.GeneralNotificationHandlerConfig
 }
 
 func (g GeneralNotificationWebSocketHandler) ForwardChatNotification(gctx *gin.Context) {
-	g.forwardNotification(
-		gctx,
-		generalnotifications.ChatNotification,
-		&model.ChatMessage{},
-	)
+	g.forwardNotification(gctx, generalnotifications.ChatNotification)
 }
 
 func (g GeneralNotificationWebSocketHandler) ForwardPurchaseNotification(gctx *gin.Context) {
-	g.forwardNotification(
-		gctx,
-		generalnotifications.PurchaseNotification,
-		&model.PurchaseUpdate{},
-	)
+	g.forwardNotification(gctx, generalnotifications.PurchaseNotification)
 }
 
 func (g GeneralNotificationWebSocketHandler) ForwardPaymentReminderNotification(gctx *gin.Context) {
-	g.forwardNotification(
-		gctx,
-		generalnotifications.PaymentReminderNotification,
-		&model.PaymentReminder{},
-	)
+	g.forwardNotification(gctx, generalnotifications.PaymentReminderNotification)
 }
 
 func (g GeneralNotificationWebSocketHandler) ForwardShippingUpdateNotification(gctx *gin.Context) {
-	g.forwardNotification(
-		gctx,
-		generalnotifications.ShippingUpdateNotification,
-		&model.ShippingUpdate{},
-	)
+	g.forwardNotification(gctx, generalnotifications.ShippingUpdateNotification)
+}
+
+// notificationPayloads maps each notification type to the model its payload is bound to
+var notificationPayloads = map[generalnotifications.NotificationType]func() any{
+	generalnotifications.ChatNotification:            func() any { return &model.ChatMessage{} },
+	generalnotifications.PurchaseNotification:        func() any { return &model.PurchaseUpdate{} },
+	generalnotifications.PaymentReminderNotification: func() any { return &model.PaymentReminder{} },
+	generalnotifications.ShippingUpdateNotification:  func() any { return &model.ShippingUpdate{} },
 }
 
 // forwardNotification is a generic handler that binds JSON payload and forwards to subscribers
 func (g GeneralNotificationWebSocketHandler) forwardNotification(
 	gctx *gin.Context,
 	notificationType generalnotifications.NotificationType,
-	payload any,
 ) {
+	payload := notificationPayloads[notificationType]()
 	if err := gctx.ShouldBindJSON(payload); err != nil {
 		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -86,24 +83,30 @@ func (g GeneralNotificationWebSocketHandler) forwardNotificationToSubscribers(
 		return
 	}
 
-	deliveredCount, err := g.WebSocketManager.BroadcastPayloadToLocalSubscribers(
+	result, err := g.WebSocketManager.BroadcastPayloadToLocalSubscribers(
 		ctx,
 		userID,
 		messageData,
+		websocket.WithMessageID(envelope.ID),
+		websocket.WithMessageType(string(envelope.NotificationType)),
 	)
 
-	if err == nil {
-		gctx.JSON(
-			http.StatusOK, gin.H{
-				"delivered":         deliveredCount,
-				"user_id":           userID,
-				"notification_type": envelope.NotificationType,
-			},
-		)
+	// Notifications dropped by a rate limit are not retried, the drop is counted by websocket_rate_limited
+	if err == nil || errors.Is(err, websocket.ErrRateLimited) {
+		response := gin.H{
+			"delivered":         result.DeliveredCount,
+			"overflowed":        result.OverflowedCount,
+			"user_id":           userID,
+			"notification_type": envelope.NotificationType,
+		}
+		if err != nil {
+			response["rate_limited"] = true
+		}
+		gctx.JSON(http.StatusOK, response)
 		return
 	}
 
-	if deliveredCount == 0 {
+	if result.DeliveredCount == 0 {
 		gctx.JSON(
 			http.StatusInternalServerError, gin.H{
 				"error":   err.Error(),
@@ -115,9 +118,12 @@ func (g GeneralNotificationWebSocketHandler) forwardNotificationToSubscribers(
 
 	gctx.JSON(
 		http.StatusPartialContent, gin.H{
-			"delivered": deliveredCount,
-			"error":     err.Error(),
-			"message":   "notification delivered to some connections but encountered errors",
+			"delivered":   result.DeliveredCount,
+			"overflowed":  result.OverflowedCount,
+			"unacked":     result.UnackedCount,
+			"error":       err.Error(),
+			"message":     "notification delivered to some connections but encountered errors",
+			"connections": result.Connections,
 		},
 	)
 }
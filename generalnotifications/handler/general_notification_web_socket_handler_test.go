@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/generalnotifications"
+	"github.com/domesama/chat-and-notifications/generalnotifications/config"
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/presence"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/domesama/chat-and-notifications/websocket/websockettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(manager websocket.WebSocketManager) httpserverwrapper.RouterWithWebSocketCustomizer {
+	return newTestHandlerWithConfig(config.GeneralNotificationHandlerConfig{})(manager)
+}
+
+func newTestHandlerWithConfig(cfg config.GeneralNotificationHandlerConfig) websockettest.CustomizerFunc {
+	return func(manager websocket.WebSocketManager) httpserverwrapper.RouterWithWebSocketCustomizer {
+		// The zero tracker is disabled
+		return GeneralNotificationWebSocketHandler{
+			WebSocketManager: manager,
+			PresenceTracker:  &presence.Tracker{},
+			Config:           cfg,
+		}
+	}
+}
+
+func multicastBody(userIDs []string, payload any) map[string]any {
+	return map[string]any{"user_ids": userIDs, "payload": payload}
+}
+
+type receivedNotification struct {
+	ID               string                                `json:"id"`
+	NotificationType generalnotifications.NotificationType `json:"notification_type"`
+	Payload          json.RawMessage                       `json:"payload"`
+}
+
+func TestGeneralNotificationWebSocketHandler(t *testing.T) {
+	purchase := model.PurchaseUpdate{
+		OrderID:     "o1",
+		BuyerID:     "u1",
+		ShopOwnerID: "u2",
+		ProductName: "Keyboard",
+		Amount:      49.9,
+		Currency:    "EUR",
+		Status:      "paid",
+	}
+	userQuery := url.Values{"user_id": {"u1"}}
+
+	t.Run(
+		"forwards notifications to the subscribers of the user", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler)
+			conn := s.Dial("/notifications/subscribe", userQuery)
+			other := s.Dial("/notifications/subscribe", url.Values{"user_id": {"u2"}})
+
+			status, _ := s.PostJSON("/notifications/purchase", userQuery, purchase)
+			assert.Equal(t, http.StatusOK, status)
+
+			notification := websockettest.ExpectMessages[receivedNotification](conn, 1, time.Second)[0]
+			assert.NotEmpty(t, notification.ID)
+			assert.Equal(t, generalnotifications.PurchaseNotification, notification.NotificationType)
+
+			var payload model.PurchaseUpdate
+			require.NoError(t, json.Unmarshal(notification.Payload, &payload))
+			assert.Equal(t, purchase, payload)
+			other.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"envelopes notifications by their ID and type", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler)
+			conn := s.Dial("/notifications/subscribe", userQuery, websockettest.WithEnvelope())
+
+			s.PostJSON("/notifications/purchase", userQuery, purchase)
+
+			envelope := websockettest.ExpectEnvelopes(conn, 1, time.Second)[0]
+			assert.Equal(t, string(generalnotifications.PurchaseNotification), envelope.Type)
+
+			var notification receivedNotification
+			require.NoError(t, json.Unmarshal(envelope.Payload, &notification))
+			assert.Equal(t, notification.ID, envelope.ID)
+		},
+	)
+
+	t.Run(
+		"rejects notifications without a user", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler)
+
+			status, _ := s.PostJSON("/notifications/purchase", nil, purchase)
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			_, resp, err := s.TryDial("/notifications/subscribe", nil)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		},
+	)
+
+	t.Run(
+		"succeeds without subscribers", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler)
+
+			status, response := s.PostJSON("/notifications/purchase", userQuery, purchase)
+			assert.Equal(t, http.StatusOK, status)
+			assert.JSONEq(
+				t, `{"delivered":0,"overflowed":0,"user_id":"u1","notification_type":"purchase_notification"}`, string(response),
+			)
+			s.ExpectBroadcasts("u1", 1, time.Second)
+		},
+	)
+
+	t.Run(
+		"does not fail notifications dropped by a rate limit", func(t *testing.T) {
+			s := websockettest.NewServer(
+				t, newTestHandler, websockettest.WithFakeBroadcast(
+					func(context.Context, string, []byte, ...websocket.BroadcastOptions) (
+						websocket.BroadcastResult, error,
+					) {
+						return websocket.BroadcastResult{}, websocket.ErrRateLimited
+					},
+				),
+			)
+
+			status, response := s.PostJSON("/notifications/purchase", userQuery, purchase)
+			assert.Equal(t, http.StatusOK, status)
+
+			var body struct {
+				RateLimited bool `json:"rate_limited"`
+			}
+			require.NoError(t, json.Unmarshal(response, &body))
+			assert.True(t, body.RateLimited)
+		},
+	)
+
+	t.Run(
+		"multicasts a notification to the subscribers of every user", func(t *testing.T) {
+			s := websockettest.NewServer(t, newTestHandler)
+			first := s.Dial("/notifications/subscribe", url.Values{"user_id": {"u1"}})
+			second := s.Dial("/notifications/subscribe", url.Values{"user_id": {"u2"}})
+			other := s.Dial("/notifications/subscribe", url.Values{"user_id": {"u4"}})
+
+			status, response := s.PostJSON(
+				"/notifications/purchase/multicast", nil, multicastBody([]string{"u1", "u2", "u3"}, purchase),
+			)
+			assert.Equal(t, http.StatusOK, status)
+
+			var body struct {
+				Delivered int                            `json:"delivered"`
+				Users     []websocket.KeyBroadcastResult `json:"users"`
+			}
+			require.NoError(t, json.Unmarshal(response, &body))
+			assert.Equal(t, 2, body.Delivered)
+			require.Len(t, body.Users, 3)
+			for i, userID := range []string{"u1", "u2", "u3"} {
+				assert.Equal(t, userID, body.Users[i].Key)
+			}
+			assert.Equal(t, 0, body.Users[2].DeliveredCount)
+
+			// Every user receives the same notification
+			firstNotification := websockettest.ExpectMessages[receivedNotification](first, 1, time.Second)[0]
+			secondNotification := websockettest.ExpectMessages[receivedNotification](second, 1, time.Second)[0]
+			assert.Equal(t, firstNotification.ID, secondNotification.ID)
+			assert.Equal(t, generalnotifications.PurchaseNotification, firstNotification.NotificationType)
+			other.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"answers which users a multicast failed for", func(t *testing.T) {
+			errDelivery := errors.New("delivery failed")
+			s := websockettest.NewServer(
+				t, newTestHandler, websockettest.WithFakeBroadcast(
+					func(_ context.Context, key string, _ []byte, _ ...websocket.BroadcastOptions) (
+						websocket.BroadcastResult, error,
+					) {
+						if key == "u2" {
+							return websocket.BroadcastResult{}, errDelivery
+						}
+						return websocket.BroadcastResult{DeliveredCount: 1}, nil
+					},
+				),
+			)
+
+			status, response := s.PostJSON(
+				"/notifications/purchase/multicast", nil, multicastBody([]string{"u1", "u2"}, purchase),
+			)
+			assert.Equal(t, http.StatusPartialContent, status)
+
+			var body struct {
+				Users []websocket.KeyBroadcastResult `json:"users"`
+			}
+			require.NoError(t, json.Unmarshal(response, &body))
+			require.Len(t, body.Users, 2)
+			assert.Empty(t, body.Users[0].Error)
+			assert.Equal(t, errDelivery.Error(), body.Users[1].Error)
+			s.ExpectBroadcasts("u1", 1, time.Second)
+			s.ExpectBroadcasts("u2", 1, time.Second)
+		},
+	)
+
+	t.Run(
+		"rejects multicasts without users, above the limit or with an invalid payload", func(t *testing.T) {
+			s := websockettest.NewServer(
+				t, newTestHandlerWithConfig(config.GeneralNotificationHandlerConfig{MulticastMaxUsers: 2}),
+			)
+
+			status, _ := s.PostJSON("/notifications/purchase/multicast", nil, multicastBody(nil, purchase))
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			status, _ = s.PostJSON(
+				"/notifications/purchase/multicast", nil, multicastBody([]string{"u1", "u2", "u3"}, purchase),
+			)
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			status, _ = s.PostJSON(
+				"/notifications/purchase/multicast", nil, multicastBody([]string{"u1"}, map[string]any{"order_id": 1}),
+			)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Empty(t, s.Manager.Broadcasts("u1"))
+		},
+	)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/domesama/chat-and-notifications/generalnotifications"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MulticastNotification returns the handler sending one notification of the type to every user of the body,
+// the payload is bound to the same model as the Forward handler of the type
+func (g GeneralNotificationWebSocketHandler) MulticastNotification(
+	notificationType generalnotifications.NotificationType,
+) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		g.multicastNotification(gctx, notificationType)
+	}
+}
+
+// multicastNotification binds the users and the payload of the body and forwards a single notification to the
+// subscribers of every user
+func (g GeneralNotificationWebSocketHandler) multicastNotification(
+	gctx *gin.Context,
+	notificationType generalnotifications.NotificationType,
+) {
+	var request generalnotifications.NotificationMulticastRequest
+	if err := gctx.ShouldBindJSON(&request); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if g.Config.MulticastMaxUsers > 0 && len(request.UserIDs) > g.Config.MulticastMaxUsers {
+		gctx.JSON(
+			http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("at most %d users can be notified at once", g.Config.MulticastMaxUsers),
+			},
+		)
+		return
+	}
+
+	payload := notificationPayloads[notificationType]()
+	if err := binding.JSON.BindBody(request.Payload, payload); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	envelope := generalnotifications.NewNotificationEnvelope(notificationType, payload)
+
+	messageData, err := json.Marshal(envelope)
+	if err != nil {
+		slog.Error("failed to marshal notification envelope", "error", err)
+		gctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to serialize notification"})
+		return
+	}
+
+	result, err := g.WebSocketManager.MulticastPayloadToLocalSubscribers(
+		gctx.Request.Context(),
+		request.UserIDs,
+		messageData,
+		websocket.WithMessageID(envelope.ID),
+		websocket.WithMessageType(string(envelope.NotificationType)),
+	)
+
+	// Notifications dropped by a rate limit are not retried, see forwardNotificationToSubscribers
+	if err == nil || errors.Is(err, websocket.ErrRateLimited) {
+		response := gin.H{
+			"delivered":         result.DeliveredCount,
+			"notification_type": envelope.NotificationType,
+			"users":             result.Keys,
+		}
+		if err != nil {
+			response["rate_limited"] = true
+		}
+		gctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	status, message := http.StatusPartialContent, "notification delivered to some connections but encountered errors"
+	if result.DeliveredCount == 0 {
+		status, message = http.StatusInternalServerError, "failed to deliver notification to any connections"
+	}
+	gctx.JSON(
+		status, gin.H{
+			"delivered": result.DeliveredCount,
+			"error":     err.Error(),
+			"message":   message,
+			"users":     result.Keys,
+		},
+	)
+}
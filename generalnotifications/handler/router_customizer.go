@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"github.com/domesama/chat-and-notifications/generalnotifications"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,13 +23,56 @@ func (g GeneralNotificationWebSocketHandler) RegisterRoutes(engine *gin.Engine)
 		notificationGrouo.POST("purchase", g.ForwardPurchaseNotification)
 		notificationGrouo.POST("payment-reminder", g.ForwardPaymentReminderNotification)
 		notificationGrouo.POST("shipping-update", g.ForwardShippingUpdateNotification)
+
+		notificationGrouo.POST(
+			"chat/multicast", g.MulticastNotification(generalnotifications.ChatNotification),
+		)
+		notificationGrouo.POST(
+			"purchase/multicast", g.MulticastNotification(generalnotifications.PurchaseNotification),
+		)
+		notificationGrouo.POST(
+			"payment-reminder/multicast", g.MulticastNotification(generalnotifications.PaymentReminderNotification),
+		)
+		notificationGrouo.POST(
+			"shipping-update/multicast", g.MulticastNotification(generalnotifications.ShippingUpdateNotification),
+		)
 	}
 
 	return nil
 }
 
 func (g GeneralNotificationWebSocketHandler) RegisterWebSocketRoutes() httpserverwrapper.WebSocketRoutes {
+	presenceHooks := g.PresenceTracker.Hooks(presence.NamespaceNotifications)
 	return httpserverwrapper.WebSocketRoutes{
-		"/notifications/subscribe": g.SubscribeNotificationWebSocketByUserID,
+		"/notifications/subscribe": {
+			Handler:      g.SubscribeNotificationWebSocketByUserID,
+			OnConnect:    presenceHooks.OnConnect,
+			OnDisconnect: presenceHooks.OnDisconnect,
+			Upgrade:      g.Config.Upgrade,
+		},
+	}
+}
+
+// RegisterSSERoutes serves the notifications as Server-Sent Events to the clients that can't upgrade to WebSocket
+func (g GeneralNotificationWebSocketHandler) RegisterSSERoutes() httpserverwrapper.SSERoutes {
+	presenceHooks := g.PresenceTracker.Hooks(presence.NamespaceNotifications)
+	return httpserverwrapper.SSERoutes{
+		"/notifications/subscribe-sse": {
+			Handler:      g.SubscribeNotificationWebSocketByUserID,
+			OnConnect:    presenceHooks.OnConnect,
+			OnDisconnect: presenceHooks.OnDisconnect,
+		},
+	}
+}
+
+// RegisterLongPollRoutes serves the notifications over long-polling to the clients that can use neither WebSocket nor SSE
+func (g GeneralNotificationWebSocketHandler) RegisterLongPollRoutes() httpserverwrapper.LongPollRoutes {
+	presenceHooks := g.PresenceTracker.Hooks(presence.NamespaceNotifications)
+	return httpserverwrapper.LongPollRoutes{
+		"/notifications/subscribe-poll": {
+			Handler:      g.SubscribeNotificationWebSocketByUserID,
+			OnConnect:    presenceHooks.OnConnect,
+			OnDisconnect: presenceHooks.OnDisconnect,
+		},
 	}
 }
@@ -76,10 +76,14 @@ func newHTTPServer(
 
 // Shutdown gracefully shuts down the HTTP server
 func (s HTTPServer) Shutdown() {
-	// Shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 	defer cancel()
 
+	s.shutdown(ctx)
+}
+
+// shutdown shuts down the HTTP server, the connections still active once ctx is done are closed
+func (s HTTPServer) shutdown(ctx context.Context) {
 	if err := s.server.Shutdown(ctx); err != nil {
 		slog.Error("HTTP server shutdown error", "error", err)
 	}
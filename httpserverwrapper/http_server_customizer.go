@@ -1,6 +1,8 @@
 package httpserverwrapper
 
 import (
+	"net/http"
+
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/gin-gonic/gin"
 )
@@ -20,8 +22,88 @@ type RouterWithWebSocketCustomizer interface {
 	RegisterWebSocketRoutes() WebSocketRoutes
 }
 
-// WebSocketRoutes are maps between the route path to the route handler
+// WebSocketRoutes are maps between the route path to the route definition
 type (
-	WebSocketRoutes  map[string]WebsocketHandler
+	WebSocketRoutes  map[string]WebSocketRoute
 	WebsocketHandler func(gctx *gin.Context) (key string, metadata websocket.Metadata)
 )
+
+// WebSocketRoute defines how a websocket route subscribes its connections
+type WebSocketRoute struct {
+	// Handler resolves the grouping key and metadata of the connection from the upgrade request
+	Handler WebsocketHandler
+
+	// InboundHandlers receives the frames sent by the clients of this route, frames are discarded when empty
+	InboundHandlers websocket.InboundHandlers
+
+	// OnConnect is called once a connection of this route is registered, optional
+	OnConnect websocket.OnConnectHook
+
+	// OnDisconnect is called once a connection of this route is closed and removed from the manager, optional
+	OnDisconnect websocket.OnDisconnectHook
+
+	// Authorize lets the clients of this route subscribe to additional keys over the same connection with
+	// subscribe and unsubscribe control frames, subscriptions are disabled when nil. See websocket.SubscribeFrameType
+	Authorize websocket.SubscriptionAuthorizer
+
+	// OnSubscribe and OnUnsubscribe are called once a connection of this route subscribed to or unsubscribed from
+	// an additional key, optional. OnUnsubscribe is also called for the remaining subscriptions of a closed connection
+	OnSubscribe   websocket.SubscriptionHook
+	OnUnsubscribe websocket.SubscriptionHook
+
+	// Upgrade configures the upgrader of this route, the zero value only accepts same-origin requests
+	Upgrade WebSocketUpgradeConfig
+
+	// CheckOrigin overrides Upgrade.AllowedOrigins when set, optional
+	CheckOrigin func(r *http.Request) bool
+}
+
+// RouterWithAdminCustomizer is implemented by the customizers with routes that must not be reachable publicly,
+// e.g. routes disconnecting clients. They are served on the internal admin listener, see ProvideWebSocketAdminServer
+type RouterWithAdminCustomizer interface {
+	RegisterAdminRoutes(engine *gin.Engine) error
+}
+
+// RouterWithSSECustomizer is implemented by the customizers also serving their subscriptions as Server-Sent Events,
+// for clients whose proxies drop WebSocket upgrades. It is optional, see ProvideHTTPWithWebSocketServer
+type RouterWithSSECustomizer interface {
+	RegisterSSERoutes() SSERoutes
+}
+
+// SSERoutes are maps between the route path to the route definition
+type SSERoutes map[string]SSERoute
+
+// SSERoute defines how a Server-Sent Events route subscribes its connections, they share the WebSocketManager of the
+// WebSocket routes. Clients resume with the Last-Event-ID header, or the last_seq query parameter
+type SSERoute struct {
+	// Handler resolves the grouping key and metadata of the connection from the request
+	Handler WebsocketHandler
+
+	// OnConnect is called once a connection of this route is registered, optional
+	OnConnect websocket.OnConnectHook
+
+	// OnDisconnect is called once a connection of this route is closed and removed from the manager, optional
+	OnDisconnect websocket.OnDisconnectHook
+}
+
+// RouterWithLongPollCustomizer is implemented by the customizers also serving their subscriptions over HTTP
+// long-polling, for clients that can use neither WebSocket nor SSE. It is optional, see ProvideHTTPWithWebSocketServer
+type RouterWithLongPollCustomizer interface {
+	RegisterLongPollRoutes() LongPollRoutes
+}
+
+// LongPollRoutes are maps between the route path to the route definition
+type LongPollRoutes map[string]LongPollRoute
+
+// LongPollRoute defines how a long-poll route subscribes its connections, they share the WebSocketManager of the
+// WebSocket routes. Each response carries a cursor the next poll must send back, see LongPollResponse
+type LongPollRoute struct {
+	// Handler resolves the grouping key and metadata of the connection from the request
+	Handler WebsocketHandler
+
+	// OnConnect is called once a connection of this route is registered, optional
+	OnConnect websocket.OnConnectHook
+
+	// OnDisconnect is called once a connection of this route is closed and removed from the manager, optional
+	OnDisconnect websocket.OnDisconnectHook
+}
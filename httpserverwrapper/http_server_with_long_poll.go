@@ -0,0 +1,199 @@
+package httpserverwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// LongPollResponse is the response of a poll, Messages are the broadcasts received since the previous poll.
+// Cursor must be sent back as the cursor query parameter of the next poll, it acknowledges the returned messages.
+// Closed is set once the server closed the connection and every message was polled, the next poll with the cursor
+// opens a new connection resuming after the last polled message
+type LongPollResponse struct {
+	Cursor   string                  `json:"cursor"`
+	Messages []json.RawMessage       `json:"messages"`
+	Closed   *websocket.ClosePayload `json:"closed,omitempty"`
+}
+
+// longPollCursor identifies the connection of a client and the offset of the next frame to poll.
+// LastSeq is the sequence number of the last polled broadcast, used to resume on another pod or after expiration
+type longPollCursor struct {
+	ConnectionID string
+	Offset       uint64
+	LastSeq      uint64
+}
+
+func (c longPollCursor) String() string {
+	return fmt.Sprintf("%s.%d.%d", c.ConnectionID, c.Offset, c.LastSeq)
+}
+
+func parseLongPollCursor(raw string) (cursor longPollCursor, err error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return cursor, errors.New("malformed cursor")
+	}
+
+	cursor.ConnectionID = parts[0]
+	if cursor.Offset, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return cursor, fmt.Errorf("malformed cursor offset: %w", err)
+	}
+	if cursor.LastSeq, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+		return cursor, fmt.Errorf("malformed cursor sequence: %w", err)
+	}
+	return cursor, nil
+}
+
+// longPollSessions are the long-poll connections of this pod by connection ID
+type longPollSessions struct {
+	mu       sync.Mutex
+	sessions map[string]longPollSession
+}
+
+type longPollSession struct {
+	key       string
+	transport *websocket.LongPollTransport
+}
+
+func newLongPollSessions() *longPollSessions {
+	return &longPollSessions{sessions: map[string]longPollSession{}}
+}
+
+// get returns the transport of the connection, nil when it is unknown or belongs to another key
+func (s *longPollSessions) get(connectionID string, key string) *websocket.LongPollTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[connectionID]
+	if !ok || session.key != key {
+		return nil
+	}
+	return session.transport
+}
+
+// add keeps the transport until linger after it is closed, so that the client can still poll its last frames
+func (s *longPollSessions) add(key string, transport *websocket.LongPollTransport, linger time.Duration) {
+	s.mu.Lock()
+	s.sessions[transport.ID] = longPollSession{key: key, transport: transport}
+	s.mu.Unlock()
+
+	go func() {
+		<-transport.Done()
+		time.AfterFunc(linger, func() { s.remove(transport.ID) })
+	}()
+}
+
+func (s *longPollSessions) remove(connectionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, connectionID)
+}
+
+func (s HTTPWithWebSocketServer) registerLongPollRoutes(engine *gin.Engine, customizer RouterWithLongPollCustomizer) {
+	for routePath, route := range customizer.RegisterLongPollRoutes() {
+		currentHandler := func(gctx *gin.Context) {
+			key, metadata := route.Handler(gctx)
+			// The handler rejected the request, e.g. with 400 on invalid query parameters
+			if gctx.IsAborted() || gctx.Writer.Written() {
+				return
+			}
+
+			var cursor longPollCursor
+			if raw, ok := gctx.GetQuery("cursor"); ok {
+				var err error
+				if cursor, err = parseLongPollCursor(raw); err != nil {
+					gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+
+			transport := s.longPolls.get(cursor.ConnectionID, key)
+			if transport == nil {
+				// First poll, or the connection expired or lives on another pod: resume from the last polled broadcast
+				if transport = s.registerLongPoll(gctx, routePath, route, key, metadata, cursor.LastSeq); transport == nil {
+					return
+				}
+				cursor = longPollCursor{ConnectionID: transport.ID, LastSeq: cursor.LastSeq}
+			}
+
+			batch, err := transport.Poll(gctx.Request.Context(), cursor.Offset, s.longPollCfg.Wait)
+			switch {
+			case errors.Is(err, websocket.ErrInvalidPollOffset):
+				gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			case err != nil:
+				// The client is gone, its frames stay buffered for its next poll
+				return
+			}
+
+			if batch.Closed != nil {
+				s.longPolls.remove(transport.ID)
+			}
+			gctx.JSON(http.StatusOK, newLongPollResponse(cursor, batch))
+		}
+
+		engine.GET(routePath, func(gctx *gin.Context) { currentHandler(gctx) })
+	}
+}
+
+// registerLongPoll registers a new long-poll connection, returns nil once the request has been answered with an error
+func (s HTTPWithWebSocketServer) registerLongPoll(gctx *gin.Context, routePath string, route LongPollRoute,
+	key string, metadata websocket.Metadata, lastSeq uint64) *websocket.LongPollTransport {
+	opts := []websocket.ConnectionOptions{
+		websocket.WithRoute(routePath),
+		websocket.WithOnConnect(route.OnConnect),
+		websocket.WithOnDisconnect(route.OnDisconnect),
+	}
+	if lastSeq > 0 {
+		opts = append(opts, websocket.WithResumeFrom(lastSeq))
+	} else if rawLastSeq, ok := gctx.GetQuery("last_seq"); ok {
+		resumeOpt, ok := parseResumeFrom(gctx, "last_seq", rawLastSeq)
+		if !ok {
+			return nil
+		}
+		opts = append(opts, resumeOpt)
+	}
+
+	if !s.admitConnection(gctx, key, metadata) {
+		return nil
+	}
+
+	transport := websocket.NewLongPollTransport(s.longPollCfg.IdleTimeout, s.longPollCfg.BufferSize)
+	s.wsManager.RegisterTransport(key, metadata, transport, opts...)
+	s.longPolls.add(key, transport, s.longPollCfg.IdleTimeout)
+	slog.Info("registered long-poll route", "path", routePath, "key", key, "metadata", metadata)
+
+	return transport
+}
+
+func newLongPollResponse(cursor longPollCursor, batch websocket.LongPollBatch) LongPollResponse {
+	res := LongPollResponse{
+		Messages: make([]json.RawMessage, 0, len(batch.Frames)),
+		Closed:   batch.Closed,
+	}
+
+	for _, frame := range batch.Frames {
+		if seq := websocket.SequenceOf(frame); seq > cursor.LastSeq {
+			cursor.LastSeq = seq
+		}
+		if !json.Valid(frame) {
+			// Broadcasts are expected to be JSON, anything else is sent as a JSON string
+			frame, _ = json.Marshal(string(frame))
+		}
+		res.Messages = append(res.Messages, frame)
+	}
+
+	cursor.Offset = batch.NextOffset()
+	res.Cursor = cursor.String()
+	return res
+}
@@ -0,0 +1,91 @@
+package httpserverwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type longPollTestCustomizer struct{}
+
+func (longPollTestCustomizer) RegisterLongPollRoutes() LongPollRoutes {
+	return LongPollRoutes{
+		"/poll": {
+			Handler: func(gctx *gin.Context) (string, websocket.Metadata) {
+				return gctx.Query("key"), websocket.Metadata{}
+			},
+		},
+	}
+}
+
+func TestLongPollRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := websocket.ProvideDefaultWebSocketManager(
+		websocket.WebSocketConfig{
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueueSize:    8,
+			ReplayBufferSize: 10,
+			ReplayBufferTTL:  time.Minute,
+		},
+	)
+	server := HTTPWithWebSocketServer{
+		wsManager:   manager,
+		longPollCfg: LongPollConfig{Wait: 50 * time.Millisecond, IdleTimeout: time.Minute, BufferSize: 8},
+		longPolls:   newLongPollSessions(),
+	}
+	engine := gin.New()
+	server.registerLongPollRoutes(engine, longPollTestCustomizer{})
+
+	poll := func(query string) (res LongPollResponse) {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/poll?key=key"+query, nil)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return
+	}
+	broadcast := func(payload string) {
+		_, err := manager.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(payload))
+		require.NoError(t, err)
+	}
+
+	// The first poll registers the connection and times out without messages
+	res := poll("")
+	assert.Empty(t, res.Messages)
+	first, err := parseLongPollCursor(res.Cursor)
+	require.NoError(t, err)
+
+	broadcast(`{"content":"hello"}`)
+	res = poll("&cursor=" + res.Cursor)
+	require.Len(t, res.Messages, 1)
+	assert.Contains(t, string(res.Messages[0]), `"content":"hello"`)
+	cursor, err := parseLongPollCursor(res.Cursor)
+	require.NoError(t, err)
+	assert.Equal(t, first.ConnectionID, cursor.ConnectionID)
+	assert.Equal(t, uint64(1), cursor.Offset)
+	assert.Equal(t, websocket.SequenceOf(res.Messages[0]), cursor.LastSeq)
+
+	// A cursor of an unknown connection, e.g. from another pod, resumes after its last polled broadcast
+	broadcast(`{"content":"missed"}`)
+	cursor.ConnectionID = "unknown"
+	res = poll("&cursor=" + cursor.String())
+	require.Len(t, res.Messages, 1)
+	assert.Contains(t, string(res.Messages[0]), `"content":"missed"`)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/poll?key=key&cursor=malformed", nil)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
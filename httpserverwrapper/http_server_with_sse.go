@@ -0,0 +1,64 @@
+package httpserverwrapper
+
+import (
+	"log/slog"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// LastEventIDHeader is sent by reconnecting EventSource clients with the ID of the last event they received
+const LastEventIDHeader = "Last-Event-ID"
+
+func (s HTTPWithWebSocketServer) registerSSERoutes(engine *gin.Engine, customizer RouterWithSSECustomizer) {
+	for routePath, route := range customizer.RegisterSSERoutes() {
+		currentHandler := func(gctx *gin.Context) {
+			key, metadata := route.Handler(gctx)
+			// The handler rejected the request, e.g. with 400 on invalid query parameters
+			if gctx.IsAborted() || gctx.Writer.Written() {
+				return
+			}
+
+			opts := []websocket.ConnectionOptions{
+				websocket.WithRoute(routePath),
+				websocket.WithOnConnect(route.OnConnect),
+				websocket.WithOnDisconnect(route.OnDisconnect),
+			}
+
+			// EventSource sends the ID of the last event on reconnect, which is the sequence number of the broadcast
+			if lastEventID := gctx.GetHeader(LastEventIDHeader); lastEventID != "" {
+				resumeOpt, ok := parseResumeFrom(gctx, LastEventIDHeader, lastEventID)
+				if !ok {
+					return
+				}
+				opts = append(opts, resumeOpt)
+			} else if lastSeq, ok := gctx.GetQuery("last_seq"); ok {
+				resumeOpt, ok := parseResumeFrom(gctx, "last_seq", lastSeq)
+				if !ok {
+					return
+				}
+				opts = append(opts, resumeOpt)
+			}
+
+			if !s.admitConnection(gctx, key, metadata) {
+				return
+			}
+
+			transport, err := websocket.NewSSETransport(gctx.Writer, gctx.Request)
+			if err != nil {
+				// The 200 header is already written, the client is most likely gone
+				slog.ErrorContext(gctx.Request.Context(), "failed to start SSE stream", "error", err)
+				return
+			}
+
+			s.wsManager.RegisterTransport(key, metadata, transport, opts...)
+			slog.Info("registered SSE route", "path", routePath, "key", key, "metadata", metadata)
+
+			// The response must not be written once the handler returned, wait for the transport to close.
+			// The manager closes it once the client is gone, on ping failure or when the server closes the connection
+			<-transport.Done()
+		}
+
+		engine.GET(routePath, func(gctx *gin.Context) { currentHandler(gctx) })
+	}
+}
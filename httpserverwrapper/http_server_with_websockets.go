@@ -1,11 +1,14 @@
 package httpserverwrapper
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/domesama/chat-and-notifications/websocket"
+	doakes "github.com/domesama/doakes/server"
 	gorillaws "github.com/gorilla/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -14,49 +17,121 @@ import (
 // HTTPWithWebSocketServer extends the HTTPServer to support WebSocket routes
 type HTTPWithWebSocketServer struct {
 	HTTPServer
-	wsManager websocket.WebSocketManager
+	wsManager   websocket.WebSocketManager
+	longPollCfg LongPollConfig
+	longPolls   *longPollSessions
 }
 
+// WebSocketDrainHealthCheckName is the health check failing once the server drains its connections on shutdown
+const WebSocketDrainHealthCheckName = "websocket_drain"
+
 func ProvideHTTPWithWebSocketServer(
 	cfg HTTPServerConfig,
 	customizer RouterWithWebSocketCustomizer,
 	wsManager websocket.WebSocketManager,
+	monitoringServer *doakes.TelemetryServer,
+	longPollCfg LongPollConfig,
+) (srv HTTPWithWebSocketServer, cleanUp func(), err error) {
+	// Mark the pod as not ready while draining so that reconnecting clients are routed to the other pods
+	monitoringServer.RegisterHealthCheck(
+		WebSocketDrainHealthCheckName, func() error {
+			if wsManager.IsDraining() {
+				return websocket.ErrDraining
+			}
+			return nil
+		},
+	)
+
+	return NewHTTPWithWebSocketServer(cfg, customizer, wsManager, longPollCfg)
+}
+
+// NewHTTPWithWebSocketServer starts the server without registering its drain health check,
+// e.g. in-process in tests, see websockettest.NewServer
+func NewHTTPWithWebSocketServer(
+	cfg HTTPServerConfig,
+	customizer RouterWithWebSocketCustomizer,
+	wsManager websocket.WebSocketManager,
+	longPollCfg LongPollConfig,
 ) (srv HTTPWithWebSocketServer, cleanUp func(), err error) {
-	baseHTTPServer, cleanUp, err := newHTTPServer(cfg, customizer)
+	baseHTTPServer, _, err := newHTTPServer(cfg, customizer)
 	if err != nil {
 		return
 	}
 
 	webSocketServer := &HTTPWithWebSocketServer{
-		HTTPServer: baseHTTPServer,
-		wsManager:  wsManager,
+		HTTPServer:  baseHTTPServer,
+		wsManager:   wsManager,
+		longPollCfg: longPollCfg,
+		longPolls:   newLongPollSessions(),
 	}
 
 	err = webSocketServer.registerWebSocketRoutes(baseHTTPServer.engine, customizer)
 	if err != nil {
 		return
 	}
+	if sseCustomizer, ok := customizer.(RouterWithSSECustomizer); ok {
+		webSocketServer.registerSSERoutes(baseHTTPServer.engine, sseCustomizer)
+	}
+	if longPollCustomizer, ok := customizer.(RouterWithLongPollCustomizer); ok {
+		webSocketServer.registerLongPollRoutes(baseHTTPServer.engine, longPollCustomizer)
+	}
 
 	if err = startHTTPServerWithListener(&webSocketServer.HTTPServer); err != nil {
 		return
 	}
 
-	return *webSocketServer, cleanUp, nil
+	return *webSocketServer, webSocketServer.Shutdown, nil
 }
 
 func (s HTTPWithWebSocketServer) registerWebSocketRoutes(engine *gin.Engine,
 	customizer RouterWithWebSocketCustomizer) error {
 
-	for routePath, routeFunc := range customizer.RegisterWebSocketRoutes() {
+	for routePath, route := range customizer.RegisterWebSocketRoutes() {
+		upgrader := route.Upgrade.newUpgrader(route.CheckOrigin)
 
 		currentHandler := func(gctx *gin.Context) {
-			key, metadata := routeFunc(gctx)
-			websocketCon := s.upgradeToWebSocket(gctx)
-			managedWebSocketCon := s.wsManager.RegisterConnection(key, metadata, websocketCon)
+			key, metadata := route.Handler(gctx)
+			// The handler rejected the request, e.g. with 400 on invalid query parameters
+			if gctx.IsAborted() || gctx.Writer.Written() {
+				return
+			}
+
+			opts := []websocket.ConnectionOptions{
+				websocket.WithRoute(routePath),
+				websocket.WithInboundHandlers(route.InboundHandlers),
+				websocket.WithOnConnect(route.OnConnect),
+				websocket.WithOnDisconnect(route.OnDisconnect),
+				websocket.WithSubscriptionAuthorizer(route.Authorize),
+				websocket.WithOnSubscribe(route.OnSubscribe),
+				websocket.WithOnUnsubscribe(route.OnUnsubscribe),
+			}
+
+			// Reconnecting clients pass the last sequence number they received to get the missed broadcasts replayed
+			if lastSeq, ok := gctx.GetQuery("last_seq"); ok {
+				resumeOpt, ok := parseResumeFrom(gctx, "last_seq", lastSeq)
+				if !ok {
+					return
+				}
+				opts = append(opts, resumeOpt)
+			}
+
+			if !s.admitConnection(gctx, key, metadata) {
+				return
+			}
+
+			websocketCon := s.upgradeToWebSocket(gctx, upgrader)
+			if websocketCon == nil {
+				return
+			}
+			if route.Upgrade.MaxMessageSize > 0 {
+				websocketCon.SetReadLimit(route.Upgrade.MaxMessageSize)
+			}
+
+			managedWebSocketCon := s.wsManager.RegisterConnection(key, metadata, websocketCon, opts...)
 			slog.Info("registered WebSocket route", "path", routePath, "key", key, "metadata", metadata)
 
 			// Wait for managedWebSocketCon to close
-			// The manager handles heartbeat and cleanup
+			// The manager handles heartbeat and removes the connection once it is closed
 			<-managedWebSocketCon.CloseChan
 		}
 
@@ -65,25 +140,52 @@ func (s HTTPWithWebSocketServer) registerWebSocketRoutes(engine *gin.Engine,
 	return nil
 }
 
-func (s HTTPWithWebSocketServer) upgradeToWebSocket(gctx *gin.Context) (conn *gorillaws.Conn) {
-	// TODO: In the future allow implementor to add config for each socket handlers
-	upgrader := gorillaws.Upgrader{}
+// parseResumeFrom answers 400 when the last received sequence number is invalid
+func parseResumeFrom(gctx *gin.Context, name string, lastSeq string) (websocket.ConnectionOptions, bool) {
+	seq, err := strconv.ParseUint(lastSeq, 10, 64)
+	if err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a non-negative integer"})
+		return nil, false
+	}
+	return websocket.WithResumeFrom(seq), true
+}
+
+// admitConnection answers 429 when the connection limits are reached and 503 while draining
+func (s HTTPWithWebSocketServer) admitConnection(gctx *gin.Context, key string, metadata websocket.Metadata) bool {
+	err := s.wsManager.AdmitConnection(key, metadata)
+	if err == nil {
+		return true
+	}
+
+	slog.WarnContext(gctx.Request.Context(), "rejected WebSocket connection", "error", err, "key", key)
+	status := http.StatusTooManyRequests
+	if errors.Is(err, websocket.ErrDraining) {
+		status = http.StatusServiceUnavailable
+	}
+	gctx.JSON(status, gin.H{"error": err.Error()})
+	return false
+}
+
+func (s HTTPWithWebSocketServer) upgradeToWebSocket(gctx *gin.Context,
+	upgrader *gorillaws.Upgrader) (conn *gorillaws.Conn) {
 	conn, err := upgrader.Upgrade(gctx.Writer, gctx.Request, nil)
 
 	if err != nil {
 		slog.ErrorContext(gctx.Request.Context(), "failed to upgrade WebSocket connection", "error", err)
-		_ = gctx.AbortWithError(http.StatusInternalServerError, err)
+		// The upgrader already answered with the matching status, e.g. 403 for a rejected origin
+		gctx.Abort()
 		return
 	}
 	return conn
 }
 
+// Shutdown drains the WebSocket connections before shutting down the HTTP server,
+// spreading the reconnects of the clients over the drain window instead of closing every connection at once.
+// Both share the shutdown timeout, the connections still open once it elapses are closed right away
 func (s HTTPWithWebSocketServer) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
 
-	// Close all WebSocket connections gracefully
-	s.wsManager.CloseAll(1001, "server shutting down")
-
-	// Give clients time to reconnect
-	time.Sleep(5 * time.Second)
-	s.HTTPServer.Shutdown()
+	s.wsManager.Drain(ctx)
+	s.HTTPServer.shutdown(ctx)
 }
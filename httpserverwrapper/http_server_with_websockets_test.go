@@ -0,0 +1,58 @@
+package httpserverwrapper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPWithWebSocketServerShutdown(t *testing.T) {
+	manager := websocket.ProvideDefaultWebSocketManager(
+		websocket.WebSocketConfig{
+			PingInterval:  time.Minute,
+			PongWait:      time.Minute,
+			WriteWait:     time.Second,
+			SendQueueSize: 8,
+			DrainWindow:   time.Minute,
+		},
+	)
+	upgrades := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				conn, err := (&gorillaws.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				manager.RegisterConnection("key", websocket.Metadata{}, conn)
+			},
+		),
+	)
+	t.Cleanup(upgrades.Close)
+
+	clientConn, _, err := gorillaws.DefaultDialer.Dial("ws"+strings.TrimPrefix(upgrades.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = clientConn.Close() })
+	require.Eventually(
+		t, func() bool { return len(manager.ListKeys()) == 1 }, time.Second, 10*time.Millisecond,
+	)
+
+	server := HTTPWithWebSocketServer{
+		HTTPServer: HTTPServer{server: &http.Server{}, cfg: HTTPServerConfig{ShutdownTimeout: 100 * time.Millisecond}},
+		wsManager:  manager,
+	}
+	startedAt := time.Now()
+	server.Shutdown()
+
+	// The drain window is longer than the shutdown timeout, the remaining connections are closed once it elapses
+	assert.Less(t, time.Since(startedAt), time.Second)
+	assert.Eventually(
+		t, func() bool { return len(manager.ListKeys()) == 0 }, time.Second, 10*time.Millisecond,
+	)
+}
@@ -0,0 +1,23 @@
+package httpserverwrapper
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// LongPollConfig contains the settings of the long-poll routes, see RouterWithLongPollCustomizer
+type LongPollConfig struct {
+	// Wait is how long a poll is held when no frame is buffered, it must stay below WRITE_TIMEOUT
+	// and the idle timeouts of the proxies in front of the pods
+	Wait time.Duration `envconfig:"LONG_POLL_WAIT" default:"25s"`
+	// IdleTimeout closes the connection of a client that stopped polling
+	IdleTimeout time.Duration `envconfig:"LONG_POLL_IDLE_TIMEOUT" default:"30s"`
+	// BufferSize is the number of frames buffered between two polls, the connection is closed once it overflows
+	BufferSize int `envconfig:"LONG_POLL_BUFFER_SIZE" default:"256"`
+}
+
+func ProvideLongPollConfig() (conf LongPollConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
@@ -0,0 +1,17 @@
+package httpserverwrapper
+
+import (
+	"github.com/kelseyhightower/envconfig"
+)
+
+// WebSocketAdminConfig contains the settings of the internal WebSocket admin listener
+type WebSocketAdminConfig struct {
+	Enabled bool `envconfig:"WEBSOCKET_ADMIN_ENABLED" default:"false"`
+	// ListenAddr must not be exposed publicly, the admin routes can disconnect any client
+	ListenAddr string `envconfig:"WEBSOCKET_ADMIN_LISTEN_ADDR" default:":8081"`
+}
+
+func ProvideWebSocketAdminConfig() (conf WebSocketAdminConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
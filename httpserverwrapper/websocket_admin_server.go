@@ -0,0 +1,118 @@
+package httpserverwrapper
+
+import (
+	"net/http"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// WebSocketAdminBasePath is the route group of the admin routes on the internal listener
+const WebSocketAdminBasePath = "/admin/websocket"
+
+// WebSocketAdminServer serves the WebSocket admin routes on an internal listener separate from the public server,
+// along with the admin routes of the customizer when it implements RouterWithAdminCustomizer
+type WebSocketAdminServer struct {
+	server *HTTPServer // nil when disabled
+}
+
+func ProvideWebSocketAdminServer(
+	cfg WebSocketAdminConfig,
+	httpCfg HTTPServerConfig,
+	wsManager websocket.WebSocketManager,
+	customizer RouterWithWebSocketCustomizer,
+) (srv WebSocketAdminServer, cleanUp func(), err error) {
+	if !cfg.Enabled {
+		return WebSocketAdminServer{}, func() {}, nil
+	}
+
+	// Same timeouts as the public server, on the internal address
+	httpCfg.ListenAddr = cfg.ListenAddr
+	server, cleanUp, err := ProvideHTTPServer(
+		httpCfg, webSocketAdminRouter{wsManager: wsManager, customizer: customizer},
+	)
+	if err != nil {
+		return
+	}
+
+	return WebSocketAdminServer{server: &server}, cleanUp, nil
+}
+
+// GetRunningPort returns the port of the admin listener, empty when disabled
+func (s WebSocketAdminServer) GetRunningPort() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.GetRunningPort()
+}
+
+type webSocketAdminRouter struct {
+	wsManager  websocket.WebSocketManager
+	customizer RouterWithWebSocketCustomizer
+}
+
+func (r webSocketAdminRouter) Configure(b *HTTPServerBuilder) error {
+	b.WithMiddleware(gin.Recovery())
+	return nil
+}
+
+func (r webSocketAdminRouter) RegisterRoutes(engine *gin.Engine) error {
+	RegisterWebSocketAdminRoutes(engine.Group(WebSocketAdminBasePath), r.wsManager)
+
+	if adminCustomizer, ok := r.customizer.(RouterWithAdminCustomizer); ok {
+		return adminCustomizer.RegisterAdminRoutes(engine)
+	}
+	return nil
+}
+
+// RegisterWebSocketAdminRoutes mounts the admin routes of the manager on the router, which must only be reachable
+// internally. The routes only see the connections of the pod serving the request
+func RegisterWebSocketAdminRoutes(router gin.IRouter, wsManager websocket.WebSocketManager) {
+	h := webSocketAdminHandler{wsManager: wsManager}
+	router.GET("/keys", h.listKeys)
+	router.GET("/keys/:key/connections", h.listConnections)
+	router.POST("/keys/:key/close", h.closeConnections)
+}
+
+type webSocketAdminHandler struct {
+	wsManager websocket.WebSocketManager
+}
+
+// closeConnectionsRequest closes every connection of the key unless ConnectionID is set
+type closeConnectionsRequest struct {
+	ConnectionID string `json:"connection_id"`
+	// 1004 is reserved, 1005, 1006 and 1015 must not be sent in a close frame
+	Code int `json:"code" binding:"omitempty,min=1000,max=4999,ne=1004,ne=1005,ne=1006,ne=1015"`
+	// The close frame payload is limited to 125 bytes, 2 of which hold the code
+	Reason string `json:"reason" binding:"max=123"`
+}
+
+func (h webSocketAdminHandler) listKeys(gctx *gin.Context) {
+	gctx.JSON(http.StatusOK, gin.H{"keys": h.wsManager.ListKeys()})
+}
+
+func (h webSocketAdminHandler) listConnections(gctx *gin.Context) {
+	key := gctx.Param("key")
+	gctx.JSON(http.StatusOK, gin.H{"key": key, "connections": h.wsManager.ListConnections(key)})
+}
+
+func (h webSocketAdminHandler) closeConnections(gctx *gin.Context) {
+	key := gctx.Param("key")
+
+	var req closeConnectionsRequest
+	if err := gctx.ShouldBindJSON(&req); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == 0 {
+		req.Code = gorillaws.CloseNormalClosure
+	}
+
+	predicate := func(c *websocket.WebSocketConnection) bool {
+		return req.ConnectionID == "" || c.ID == req.ConnectionID
+	}
+	closed := h.wsManager.CloseConnections(key, predicate, req.Code, req.Reason)
+
+	gctx.JSON(http.StatusOK, gin.H{"key": key, "closed": closed})
+}
@@ -0,0 +1,121 @@
+package httpserverwrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminTestManager records the calls of the admin routes
+type adminTestManager struct {
+	websocket.WebSocketManager
+	connections []*websocket.WebSocketConnection
+	closeCode   int
+	closeReason string
+}
+
+func (m *adminTestManager) ListKeys() []websocket.KeyConnections {
+	return []websocket.KeyConnections{{Key: "key", ConnectionCount: len(m.connections)}}
+}
+
+func (m *adminTestManager) ListConnections(key string) []websocket.ConnectionInfo {
+	return []websocket.ConnectionInfo{{ID: "id-1", Key: key, Metadata: websocket.Metadata{"user_id": {"user-1"}}}}
+}
+
+func (m *adminTestManager) CloseConnections(key string, predicate websocket.ConnectionPredicate, code int,
+	reason string) (closed int) {
+	m.closeCode, m.closeReason = code, reason
+	for _, c := range m.connections {
+		if c.Key == key && predicate(c) {
+			closed++
+		}
+	}
+	return
+}
+
+func TestWebSocketAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := &adminTestManager{
+		connections: []*websocket.WebSocketConnection{{ID: "id-1", Key: "key"}, {ID: "id-2", Key: "key"}},
+	}
+	engine := gin.New()
+	RegisterWebSocketAdminRoutes(engine.Group(WebSocketAdminBasePath), manager)
+
+	serve := func(method string, path string, body any) *httptest.ResponseRecorder {
+		var reqBody bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+		}
+		req, err := http.NewRequestWithContext(context.Background(), method, WebSocketAdminBasePath+path, &reqBody)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run(
+		"list keys", func(t *testing.T) {
+			w := serve(http.MethodGet, "/keys", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"keys":[{"key":"key","connections":2}]}`, w.Body.String())
+		},
+	)
+
+	t.Run(
+		"list connections", func(t *testing.T) {
+			w := serve(http.MethodGet, "/keys/key/connections", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var res struct {
+				Connections []websocket.ConnectionInfo `json:"connections"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(
+				t, []websocket.ConnectionInfo{
+					{ID: "id-1", Key: "key", Metadata: websocket.Metadata{"user_id": {"user-1"}}},
+				}, res.Connections,
+			)
+		},
+	)
+
+	t.Run(
+		"close a single connection", func(t *testing.T) {
+			w := serve(
+				http.MethodPost, "/keys/key/close",
+				closeConnectionsRequest{ConnectionID: "id-2", Code: 4001, Reason: "debugging"},
+			)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"key":"key","closed":1}`, w.Body.String())
+			assert.Equal(t, 4001, manager.closeCode)
+			assert.Equal(t, "debugging", manager.closeReason)
+		},
+	)
+
+	t.Run(
+		"close every connection with the default code", func(t *testing.T) {
+			w := serve(http.MethodPost, "/keys/key/close", closeConnectionsRequest{})
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"key":"key","closed":2}`, w.Body.String())
+			assert.Equal(t, gorillaws.CloseNormalClosure, manager.closeCode)
+		},
+	)
+
+	t.Run(
+		"reject invalid close codes", func(t *testing.T) {
+			for _, code := range []int{999, 1004, 1005, 1006, 1015, 5000} {
+				w := serve(http.MethodPost, "/keys/key/close", closeConnectionsRequest{Code: code})
+				assert.Equal(t, http.StatusBadRequest, w.Code, "code %d", code)
+			}
+		},
+	)
+}
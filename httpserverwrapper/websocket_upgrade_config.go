@@ -0,0 +1,65 @@
+package httpserverwrapper
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// WebSocketUpgradeConfig contains the upgrade settings of a WebSocket route.
+// Services embed it in their config with their own prefix, e.g. CHAT_WEBSOCKET_ALLOWED_ORIGINS
+type WebSocketUpgradeConfig struct {
+	// AllowedOrigins lists the browser origins allowed to connect, "*" allows any origin.
+	// When empty only same-origin requests are accepted
+	AllowedOrigins []string `envconfig:"ALLOWED_ORIGINS"`
+	// Subprotocols are negotiated before websocket.EnvelopeSubprotocol, which is always supported
+	Subprotocols      []string      `envconfig:"SUBPROTOCOLS"`
+	ReadBufferSize    int           `envconfig:"READ_BUFFER_SIZE" default:"1024"`
+	WriteBufferSize   int           `envconfig:"WRITE_BUFFER_SIZE" default:"1024"`
+	EnableCompression bool          `envconfig:"ENABLE_COMPRESSION" default:"false"`
+	HandshakeTimeout  time.Duration `envconfig:"HANDSHAKE_TIMEOUT" default:"10s"`
+	// MaxMessageSize is the maximum size in bytes of a message read from the client, the connection is closed above it
+	MaxMessageSize int64 `envconfig:"MAX_MESSAGE_SIZE" default:"65536"`
+}
+
+// newUpgrader builds the upgrader of a route, checkOrigin overrides AllowedOrigins when set
+func (c WebSocketUpgradeConfig) newUpgrader(checkOrigin func(r *http.Request) bool) *gorillaws.Upgrader {
+	if checkOrigin == nil {
+		checkOrigin = c.checkAllowedOrigins()
+	}
+
+	return &gorillaws.Upgrader{
+		HandshakeTimeout:  c.HandshakeTimeout,
+		ReadBufferSize:    c.ReadBufferSize,
+		WriteBufferSize:   c.WriteBufferSize,
+		Subprotocols:      append(slices.Clip(c.Subprotocols), websocket.EnvelopeSubprotocol),
+		CheckOrigin:       checkOrigin,
+		EnableCompression: c.EnableCompression,
+	}
+}
+
+// checkAllowedOrigins returns nil when no origin is configured, which keeps the same-origin check of gorilla
+func (c WebSocketUpgradeConfig) checkAllowedOrigins() func(r *http.Request) bool {
+	if len(c.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		// Non-browser clients don't send an origin
+		if origin == "" {
+			return true
+		}
+
+		for _, allowed := range c.AllowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
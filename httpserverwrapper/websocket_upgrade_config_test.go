@@ -0,0 +1,61 @@
+package httpserverwrapper
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketUpgradeConfigCheckOrigin(t *testing.T) {
+	testCases := []struct {
+		name           string
+		allowedOrigins []string
+		origin         string
+		expected       bool
+	}{
+		{
+			name:           "allowed origin",
+			allowedOrigins: []string{"https://app.example.com"},
+			origin:         "https://APP.example.com",
+			expected:       true,
+		},
+		{
+			name:           "origin not in the allowed list",
+			allowedOrigins: []string{"https://app.example.com"},
+			origin:         "https://evil.example.com",
+		},
+		{
+			name:           "wildcard",
+			allowedOrigins: []string{"*"},
+			origin:         "https://any.example.com",
+			expected:       true,
+		},
+		{
+			name:           "non-browser client without origin",
+			allowedOrigins: []string{"https://app.example.com"},
+			expected:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.name, func(t *testing.T) {
+				upgrader := WebSocketUpgradeConfig{AllowedOrigins: tc.allowedOrigins}.newUpgrader(nil)
+
+				r := httptest.NewRequest("GET", "http://chat.example.com/chat/subscribe-websocket", nil)
+				if tc.origin != "" {
+					r.Header.Set("Origin", tc.origin)
+				}
+
+				assert.Equal(t, tc.expected, upgrader.CheckOrigin(r))
+			},
+		)
+	}
+}
+
+func TestWebSocketUpgradeConfigDefaultsToSameOrigin(t *testing.T) {
+	// A nil CheckOrigin makes gorilla reject cross-origin requests
+	upgrader := WebSocketUpgradeConfig{}.newUpgrader(nil)
+	assert.Nil(t, upgrader.CheckOrigin)
+}
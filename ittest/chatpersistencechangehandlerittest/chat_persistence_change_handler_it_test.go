@@ -2,12 +2,16 @@ package ittest
 
 import (
 	"context"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/domesama/chat-and-notifications/event"
 	"github.com/domesama/chat-and-notifications/eventmodel"
 	"github.com/domesama/chat-and-notifications/ittest/ittesthelper"
 	"github.com/domesama/chat-and-notifications/ittest/stub"
+	"github.com/domesama/chat-and-notifications/ittest/stub/chatwebsockethandlerstub"
+	"github.com/domesama/chat-and-notifications/ittest/stub/generalnotificationhandlerstub"
 	"github.com/domesama/chat-and-notifications/model"
 	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
@@ -76,6 +80,92 @@ func (t *ChatPersistenceChangeHandlerITTestSuite) TestConsumingChange() {
 	)
 }
 
+func (t *ChatPersistenceChangeHandlerITTestSuite) TestClosingStreamWhenRetriesAreExhausted() {
+	ctx := context.Background()
+	t.metricHelper.ResetEventMetric()
+
+	chatMessages := stub.CreateChatMessages("sender-c", "sender-d", "Should fail over on this message")
+	chatMessages[0].MessageID = "fail-over-msg-id"
+
+	t.externalDependencies.ChatWebSocketForwarderStub.AddForwardChatMessageToWebSocketStub(
+		chatwebsockethandlerstub.ChatWebSocketForwardAPIStub{
+			Predicates:     stub.NewPredicates(stub.WithContainingChatContent(chatMessages[0].Content)),
+			StubStatusCode: http.StatusInternalServerError,
+		},
+	)
+	t.publishChatPersistenceChangeEvents(ctx, eventmodel.EventTypeCreate, chatMessages...)
+
+	// Once the retries ran out, the connections of the stream are closed so that its clients poll the chat history
+	t.Eventually(
+		func() bool {
+			for _, streamClose := range t.externalDependencies.ChatWebSocketForwarderStub.ClosedStreams() {
+				if streamClose.StreamID == chatMessages[0].StreamID {
+					return true
+				}
+			}
+			return false
+		}, 20*time.Second, 100*time.Millisecond, "the chat stream was not closed",
+	)
+
+	t.metricHelper.EventuallyAssertSelectedCounterMetrics(
+		map[string][]ittesthelper.Label{
+			event.DroppedEventMetricType.GetMetricTotalName(): {
+				{
+					LabelName:     "dropped_reason",
+					LabelValue:    event.EventReasonRetriesExhausted.ToString(),
+					ExpectedValue: 1,
+				},
+			},
+		}, 1,
+	)
+}
+
+func (t *ChatPersistenceChangeHandlerITTestSuite) TestClosingStreamIgnoresNotificationFailures() {
+	ctx := context.Background()
+	t.metricHelper.ResetEventMetric()
+
+	chatMessages := stub.CreateChatMessages("sender-e", "sender-f", "Should only fail to notify on this message")
+	chatMessages[0].MessageID = "notification-failure-msg-id"
+
+	t.externalDependencies.ChatWebSocketForwarderStub.AddForwardChatMessageToWebSocketStub(
+		chatwebsockethandlerstub.ChatWebSocketForwardAPIStub{
+			Predicates:     stub.NewPredicates(stub.WithContainingChatContent(chatMessages[0].Content)),
+			StubStatusCode: http.StatusOK,
+		},
+	)
+	t.externalDependencies.ChatNotificationStub.AddForwardChatMessageToWebSocketStub(
+		generalnotificationhandlerstub.ChatNotificationStub{
+			Predicates:     stub.NewPredicates(stub.WithContainingChatContent(chatMessages[0].Content)),
+			StubStatusCode: http.StatusInternalServerError,
+		},
+	)
+	t.publishChatPersistenceChangeEvents(ctx, eventmodel.EventTypeCreate, chatMessages...)
+
+	t.metricHelper.EventuallyAssertSelectedCounterMetrics(
+		map[string][]ittesthelper.Label{
+			event.DroppedEventMetricType.GetMetricTotalName(): {
+				{
+					LabelName:     "dropped_reason",
+					LabelValue:    event.EventReasonRetriesExhausted.ToString(),
+					ExpectedValue: 1,
+				},
+			},
+		}, 1,
+	)
+
+	// The chat connections got the message, an outage of the general notification service doesn't close the stream
+	t.Never(
+		func() bool {
+			for _, streamClose := range t.externalDependencies.ChatWebSocketForwarderStub.ClosedStreams() {
+				if streamClose.StreamID == chatMessages[0].StreamID {
+					return true
+				}
+			}
+			return false
+		}, time.Second, 100*time.Millisecond, "the chat stream was closed",
+	)
+}
+
 func addDuplicatedMessage() []model.ChatMessage {
 	duplicatedMessage := stub.CreateChatMessages(
 		"sender-a", " sender-b", "Duplicated message from kafka",
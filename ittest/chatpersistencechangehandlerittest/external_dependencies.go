@@ -31,9 +31,19 @@ func (t *BaseChatPersistenceChangeHandlerITTestSuite) StartHTTPStubServers(
 		},
 	)
 
+	// The stream close route is only served on the internal admin listener of the chat websocket service
+	startedAdminPort := ittesthelper.StartHTTPServer(
+		t.T(), func(engine *gin.Engine) error {
+			chatwebsockethandlerstub.ChatWebSocketAdminRouterStub(engine, extDeps.ChatWebSocketForwarderStub)
+			return nil
+		},
+	)
+
 	startedHost := "http://localhost:" + strconv.Itoa(startedPort)
+	startedAdminHost := "http://localhost:" + strconv.Itoa(startedAdminPort)
 
 	appConf.ChatMessageSocketTransferOutgoingConfig = outgoinghttp.OutGoingHTTPConfig{Host: startedHost}
+	appConf.ChatWebSocketAdminOutgoingConfig = outgoinghttp.OutGoingHTTPConfig{Host: startedAdminHost}
 	appConf.GeneralNotificationOutgoingConfig = outgoinghttp.OutGoingHTTPConfig{Host: startedHost}
 
 	return extDeps
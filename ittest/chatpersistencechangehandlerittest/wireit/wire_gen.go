@@ -14,6 +14,7 @@ import (
 	"github.com/domesama/chat-and-notifications/connections"
 	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
 	"github.com/domesama/chat-and-notifications/eventstore"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/doakes/doakeswire"
 )
 
@@ -34,19 +35,21 @@ func InitChatPersistenceChangeHandlerITTestContainer(chatPersistenceChangeHandle
 	if err != nil {
 		return ChatPersistenceChangeHandlerITTestContainer{}, nil, err
 	}
-	chatMessageSyncService := service.ChatMessageSyncService{
-		Config: chatPersistenceChangeHandlerConfig,
-	}
-	chatPersistenceChangeMessageHandler := chatpersistencechangehandler.ChatPersistenceChangeMessageHandler{
-		ChatMessageSyncService: chatMessageSyncService,
-	}
-	chatPersistenceChangeEventMetric := chatpersistencechangehandler.ProvideChatPersistenceChangeEventMetric()
 	redisClientConfig := connectionconfig.ProvideRedisClientConfig()
 	client, cleanup2, err := connections.ProvideRedisClient(redisClientConfig)
 	if err != nil {
 		cleanup()
 		return ChatPersistenceChangeHandlerITTestContainer{}, nil, err
 	}
+	directory := presence.ProvidePresenceDirectory(client)
+	chatMessageSyncService := service.ChatMessageSyncService{
+		Config:            chatPersistenceChangeHandlerConfig,
+		PresenceDirectory: directory,
+	}
+	chatPersistenceChangeMessageHandler := chatpersistencechangehandler.ChatPersistenceChangeMessageHandler{
+		ChatMessageSyncService: chatMessageSyncService,
+	}
+	chatPersistenceChangeEventMetric := chatpersistencechangehandler.ProvideChatPersistenceChangeEventMetric()
 	redisEventStoreConfig := eventstore.ProvideRedisEventStoreConfig()
 	chatPersistenceChangeEventStore := chatpersistencechangehandler.ProvideChatPersistenceChangeEventStore(client, redisEventStoreConfig)
 	chatPersistenceChangeHandler, cleanup3, err := chatpersistencechangehandler.ProvideChatPersistenceChangeHandler(chatPersistenceChangeHandlerConfig, telemetryServer, chatPersistenceChangeMessageHandler, chatPersistenceChangeEventMetric, chatPersistenceChangeEventStore)
@@ -63,7 +66,8 @@ func InitChatPersistenceChangeHandlerITTestContainer(chatPersistenceChangeHandle
 		ChatMessageSyncService: chatMessageSyncService,
 	}
 	serviceChatMessageSyncService := &service.ChatMessageSyncService{
-		Config: chatPersistenceChangeHandlerConfig,
+		Config:            chatPersistenceChangeHandlerConfig,
+		PresenceDirectory: directory,
 	}
 	locator := wire.Locator{
 		ChatPersistenceChangeEventMetric:    chatPersistenceChangeEventMetric,
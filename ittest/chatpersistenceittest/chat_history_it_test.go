@@ -0,0 +1,131 @@
+package ittest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/domesama/chat-and-notifications/chatstream"
+	"github.com/domesama/chat-and-notifications/model"
+	"github.com/domesama/chat-and-notifications/outgoinghttp"
+)
+
+func (t *ChatPersistenceITTestSuite) TestChatHistoryPagination() {
+	ctx := context.Background()
+	streamID := chatstream.ComputeStreamID("history-sender", "history-receiver")
+
+	// Persist without message_id so the cursors go through the generated ObjectIDs
+	contents := []string{"first", "second", "third", "fourth", "fifth"}
+	for _, content := range contents {
+		_, statusCode := t.callChatPersistenceAPI(
+			ctx, model.ChatMessage{
+				Content: content,
+				ChatMetadata: model.ChatMetadata{
+					StreamID:   streamID,
+					SenderID:   "history-sender",
+					ReceiverID: "history-receiver",
+				},
+			},
+		)
+		t.Equal(http.StatusCreated, statusCode)
+	}
+
+	latestPage, statusCode := t.callChatHistoryAPI(ctx, url.Values{"stream_id": {streamID}, "limit": {"2"}})
+	t.Equal(http.StatusOK, statusCode)
+	t.True(latestPage.HasMore)
+	t.Equal([]string{"fourth", "fifth"}, chatContents(latestPage))
+
+	olderPage, statusCode := t.callChatHistoryAPI(
+		ctx, url.Values{
+			"stream_id": {streamID},
+			"before":    {latestPage.Messages[0].MessageID},
+			"limit":     {"2"},
+		},
+	)
+	t.Equal(http.StatusOK, statusCode)
+	t.True(olderPage.HasMore)
+	t.Equal([]string{"second", "third"}, chatContents(olderPage))
+
+	oldestPage, statusCode := t.callChatHistoryAPI(
+		ctx, url.Values{
+			"stream_id": {streamID},
+			"before":    {olderPage.Messages[0].MessageID},
+			"limit":     {"2"},
+		},
+	)
+	t.Equal(http.StatusOK, statusCode)
+	t.False(oldestPage.HasMore)
+	t.Equal([]string{"first"}, chatContents(oldestPage))
+
+	catchUpPage, statusCode := t.callChatHistoryAPI(
+		ctx, url.Values{
+			"stream_id": {streamID},
+			"since":     {olderPage.Messages[0].MessageID},
+		},
+	)
+	t.Equal(http.StatusOK, statusCode)
+	t.False(catchUpPage.HasMore)
+	t.Equal([]string{"third", "fourth", "fifth"}, chatContents(catchUpPage))
+}
+
+func (t *ChatPersistenceITTestSuite) TestChatHistoryInvalidQueries() {
+	ctx := context.Background()
+	streamID := chatstream.ComputeStreamID("history-sender-2", "history-receiver-2")
+
+	testCases := []struct {
+		name  string
+		query url.Values
+	}{
+		{
+			name:  "MissingStreamID",
+			query: url.Values{},
+		},
+		{
+			name:  "NegativeLimit",
+			query: url.Values{"stream_id": {streamID}, "limit": {"-1"}},
+		},
+		{
+			name:  "ConflictingCursors",
+			query: url.Values{"stream_id": {streamID}, "since": {"a"}, "before": {"b"}},
+		},
+		{
+			name:  "UnknownCursor",
+			query: url.Values{"stream_id": {streamID}, "since": {"unknown_message_id"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.name, func() {
+				_, statusCode := t.callChatHistoryAPI(ctx, tc.query)
+				t.Equal(http.StatusBadRequest, statusCode)
+			},
+		)
+	}
+}
+
+func (t *ChatPersistenceITTestSuite) callChatHistoryAPI(ctx context.Context, query url.Values) (
+	model.ChatHistoryPage, int,
+) {
+	port := t.cnt.HTTPServer.GetRunningPort()
+
+	req := outgoinghttp.BuildBasicRequest(
+		http.MethodGet,
+		fmt.Sprintf("http://localhost%s/chat/messages", port),
+		outgoinghttp.WithAdditionalQuery(query),
+	)
+
+	client := &http.Client{}
+	resp, statusCode, _ := outgoinghttp.CallHTTP[model.ChatHistoryPage](ctx, client, req)
+
+	return resp, statusCode
+}
+
+func chatContents(page model.ChatHistoryPage) []string {
+	contents := make([]string, len(page.Messages))
+	for i, msg := range page.Messages {
+		contents[i] = msg.Content
+	}
+	return contents
+}
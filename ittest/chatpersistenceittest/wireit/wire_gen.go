@@ -7,6 +7,7 @@
 package wireit
 
 import (
+	"github.com/domesama/chat-and-notifications/chatpersistence/config"
 	"github.com/domesama/chat-and-notifications/chatpersistence/handler"
 	"github.com/domesama/chat-and-notifications/chatpersistence/service"
 	"github.com/domesama/chat-and-notifications/cmd/chatpersistence/wire"
@@ -19,14 +20,17 @@ import (
 // Injectors from di.go:
 
 func InitChatPersistenceITTestContainer() (ChatPersistenceITTestContainer, func(), error) {
+	chatHistoryConfig := config.ProvideChatHistoryConfig()
 	mongoDBConfig := connectionconfig.ProvideMongoDBConfig()
 	client, cleanup, err := connections.ProvideMongoClient(mongoDBConfig)
 	if err != nil {
 		return ChatPersistenceITTestContainer{}, nil, err
 	}
 	database := connections.ProvideMongoDatabase(client, mongoDBConfig)
-	chatPersistenceService := service.ChatPersistenceService{
-		DB: database,
+	chatPersistenceService, err := service.ProvideChatPersistenceService(database, chatHistoryConfig)
+	if err != nil {
+		cleanup()
+		return ChatPersistenceITTestContainer{}, nil, err
 	}
 	chatPersistenceHandler := &handler.ChatPersistenceHandler{
 		ChatPersistenceService: chatPersistenceService,
@@ -35,13 +39,11 @@ func InitChatPersistenceITTestContainer() (ChatPersistenceITTestContainer, func(
 		ChatPersistenceService: chatPersistenceService,
 	}
 	routerCustomizer := handler.ProvideRouterCustomizer(handlerChatPersistenceHandler)
-	serviceChatPersistenceService := &service.ChatPersistenceService{
-		DB: database,
-	}
 	locator := wire.Locator{
+		ChatHistoryConfig:      chatHistoryConfig,
 		ChatPersistenceHandler: chatPersistenceHandler,
 		RouterCustomizer:       routerCustomizer,
-		ChatPersistenceService: serviceChatPersistenceService,
+		ChatPersistenceService: chatPersistenceService,
 	}
 	resource, err := doakeswire.ProvideResource()
 	if err != nil {
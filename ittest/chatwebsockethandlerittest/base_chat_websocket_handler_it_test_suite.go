@@ -2,21 +2,26 @@ package ittest
 
 import (
 	"github.com/domesama/chat-and-notifications/ittest/chatwebsockethandlerittest/wireit"
+	"github.com/domesama/chat-and-notifications/ittest/ittesthelper"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/suite"
 )
 
 type BaseChatWebSocketHandlerITTestSuite struct {
 	suite.Suite
-	cnt wireit.ChatWebSocketHandlerITTestContainer
+	cnt          wireit.ChatWebSocketHandlerITTestContainer
+	metricHelper ittesthelper.EventMetricHelper
 }
 
 func (t *BaseChatWebSocketHandlerITTestSuite) SetupSuite() {
 	t.NoError(godotenv.Load("../../.env.integration"))
+	// Replay is opt-in, the resume tests need the broadcasts to be sequenced
+	t.T().Setenv("REPLAY_BUFFER_SIZE", "100")
 
 	cnt, cleanUp, err := wireit.InitChatWebSocketHandlerITTestContainer()
 	t.NoError(err)
 	t.T().Cleanup(cleanUp)
 
 	t.cnt = cnt
+	t.metricHelper = ittesthelper.NewWebSocketMetricHelper(t.T(), cnt.GetMonitoringServer(), cnt.WebSocketMetric)
 }
@@ -1,16 +1,22 @@
 package ittest
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/domesama/chat-and-notifications/chatstream"
+	"github.com/domesama/chat-and-notifications/ittest/ittesthelper"
 	"github.com/domesama/chat-and-notifications/ittest/stub"
 	"github.com/domesama/chat-and-notifications/model"
 	"github.com/domesama/chat-and-notifications/outgoinghttp"
 	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -55,6 +61,143 @@ func (t *ChatWebSocketHandlerITTestSuite) TestChatWebSocketCommunications() {
 	<-doneAssertionAOtherDeviceToB
 }
 
+func (t *ChatWebSocketHandlerITTestSuite) TestChatWebSocketResumeFromLastSeq() {
+	ctx := context.Background()
+
+	chatMessages := stub.CreateChatMessages(
+		"Mr.C", "Mr.D",
+		"Received before dropping",
+		"Missed 1",
+		"Missed 2",
+	)
+	streamID := chatstream.ComputeStreamID("Mr.C", "Mr.D")
+
+	msgChan, unsubscribe := t.subscribeToChatWebSocketWithQuery(ctx, streamID, "Mr.C", "Mr.D", "")
+	t.callChatSocketForwardingAPI(ctx, chatMessages[0])
+	received := <-msgChan
+	t.Equal(chatMessages[0], received.ChatMessage)
+	unsubscribe()
+
+	// Messages broadcast while the client is reconnecting
+	t.callChatSocketForwardingAPI(ctx, chatMessages[1:]...)
+
+	resumedMsgChan, _ := t.subscribeToChatWebSocketWithQuery(
+		ctx, streamID, "Mr.C", "Mr.D", fmt.Sprintf("&last_seq=%d", received.Seq),
+	)
+	for i, expected := range chatMessages[1:] {
+		replayed := <-resumedMsgChan
+		t.Equal(expected, replayed.ChatMessage)
+		t.Equal(received.Seq+uint64(i+1), replayed.Seq)
+	}
+}
+
+func (t *ChatWebSocketHandlerITTestSuite) TestChatWebSocketMetrics() {
+	ctx := context.Background()
+	t.metricHelper.ResetEventMetric()
+
+	chatMessages := stub.CreateChatMessages("Mr.E", "Mr.F", "Hello")
+
+	msgChanEToF := t.subscribeToChatWebSocket(ctx, "Mr.E", "Mr.F")
+	msgChanFToE := t.subscribeToChatWebSocket(ctx, "Mr.F", "Mr.E")
+
+	t.callChatSocketForwardingAPI(ctx, chatMessages...)
+	<-t.assertChatMessages(msgChanEToF, chatMessages...)
+	<-t.assertChatMessages(msgChanFToE, chatMessages...)
+
+	// Both connections registered on the chat route, and a single broadcast fanned out to both of them
+	route := websocket.MetricAttributeRoute.ToString()
+	t.metricHelper.EventuallyAssertSelectedCounterMetrics(
+		map[string][]ittesthelper.Label{
+			websocket.RegistrationsMetricType.GetMetricTotalName(): {
+				{LabelName: route, LabelValue: "/chat/subscribe-websocket", ExpectedValue: 2},
+			},
+			string(websocket.BroadcastFanOutMetricType): {
+				{LabelName: route, LabelValue: "/chat/subscribe-websocket", ExpectedValue: 1},
+			},
+		}, 3,
+	)
+}
+
+func (t *ChatWebSocketHandlerITTestSuite) TestChatSSEAndWebSocketShareBroadcasts() {
+	ctx := context.Background()
+
+	chatMessages := stub.CreateChatMessages("Mr.G", "Mr.H", "Hello", "Over SSE too")
+
+	msgChanGToH := t.subscribeToChatWebSocket(ctx, "Mr.G", "Mr.H")
+	// Mr.H is behind a proxy dropping WebSocket upgrades
+	msgChanHToG := t.subscribeToChatSSE(ctx, "Mr.H", "Mr.G")
+
+	t.callChatSocketForwardingAPI(ctx, chatMessages...)
+	<-t.assertChatMessages(msgChanGToH, chatMessages...)
+	<-t.assertChatMessages(msgChanHToG, chatMessages...)
+}
+
+func (t *ChatWebSocketHandlerITTestSuite) TestChatWebSocketCloseStream() {
+	ctx := context.Background()
+	port := t.cnt.HTTPServer.GetRunningPort()
+	streamID := chatstream.ComputeStreamID("Mr.I", "Mr.J")
+
+	conn, _, err := gorillaws.DefaultDialer.DialContext(
+		ctx,
+		fmt.Sprintf(
+			"ws://localhost%s/chat/subscribe-websocket?stream_id=%s&sender_id=Mr.I&receiver_id=Mr.J", port, streamID,
+		),
+		nil,
+	)
+	t.Require().NoError(err)
+	t.T().Cleanup(func() { _ = conn.Close() })
+
+	// The connection is registered right after the upgrade
+	t.Eventually(
+		func() bool {
+			return len(t.cnt.ChatWebSocketHandler.WebSocketManager.ListConnections(streamID)) == 1
+		}, 5*time.Second, 10*time.Millisecond,
+	)
+
+	req := outgoinghttp.BuildBasicRequest(
+		http.MethodPost,
+		fmt.Sprintf("http://localhost%s/chat/close-websocket-stream", port),
+		outgoinghttp.WithAdditionalBody(model.ChatStreamClose{StreamID: streamID}),
+	)
+	response, statusCode, err := outgoinghttp.CallHTTP[map[string]any](ctx, &http.Client{}, req)
+	t.Require().NoError(err)
+	t.Equal(http.StatusOK, statusCode)
+	t.EqualValues(1, response["closed"])
+
+	t.Require().NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, _, err = conn.ReadMessage()
+	t.True(
+		gorillaws.IsCloseError(err, t.cnt.ChatWebSocketHandlerConfig.StreamFailoverCloseCode),
+		"expected the failover close code, got %v", err,
+	)
+}
+
+type sequencedChatMessage struct {
+	Seq uint64 `json:"seq"`
+	model.ChatMessage
+}
+
+func (t *ChatWebSocketHandlerITTestSuite) subscribeToChatWebSocketWithQuery(
+	ctx context.Context,
+	streamID string,
+	senderID string,
+	receiverID string,
+	extraQuery string,
+) (chan sequencedChatMessage, func()) {
+	port := t.cnt.HTTPServer.GetRunningPort()
+
+	wsURL := fmt.Sprintf(
+		"ws://localhost%s/chat/subscribe-websocket?stream_id=%s&sender_id=%s&receiver_id=%s%s",
+		port, streamID, senderID, receiverID, extraQuery,
+	)
+
+	msgChan, cleanup, err := websocket.SubscribeToWebSocket[sequencedChatMessage](ctx, wsURL)
+	t.Require().NoError(err)
+	t.T().Cleanup(cleanup)
+
+	return msgChan, cleanup
+}
+
 func (t *ChatWebSocketHandlerITTestSuite) subscribeToChatWebSocket(
 	ctx context.Context,
 	senderID string,
@@ -80,6 +223,47 @@ func (t *ChatWebSocketHandlerITTestSuite) subscribeToChatWebSocket(
 	return msgChan
 }
 
+// subscribeToChatSSE streams the chat messages of the stream as Server-Sent Events, the data of each event is a message
+func (t *ChatWebSocketHandlerITTestSuite) subscribeToChatSSE(
+	ctx context.Context,
+	senderID string,
+	receiverID string,
+) chan model.ChatMessage {
+	port := t.cnt.HTTPServer.GetRunningPort()
+
+	sseURL := fmt.Sprintf(
+		"http://localhost%s/chat/subscribe-sse?stream_id=%s&sender_id=%s&receiver_id=%s",
+		port, chatstream.ComputeStreamID(senderID, receiverID), senderID, receiverID,
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sseURL, nil)
+	t.Require().NoError(err)
+
+	resp, err := http.DefaultClient.Do(req)
+	t.Require().NoError(err)
+	t.Require().Equal(http.StatusOK, resp.StatusCode)
+	t.T().Cleanup(func() { _ = resp.Body.Close() })
+
+	msgChan := make(chan model.ChatMessage, 10)
+	go func() {
+		defer close(msgChan)
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+
+			var msg model.ChatMessage
+			if err := json.Unmarshal([]byte(data), &msg); err == nil {
+				msgChan <- msg
+			}
+		}
+	}()
+
+	return msgChan
+}
+
 func (t *ChatWebSocketHandlerITTestSuite) callChatSocketForwardingAPI(ctx context.Context,
 	message ...model.ChatMessage) {
 	port := t.cnt.HTTPServer.GetRunningPort()
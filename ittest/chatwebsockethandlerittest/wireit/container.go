@@ -2,12 +2,16 @@ package wireit
 
 import (
 	applicationwire "github.com/domesama/chat-and-notifications/cmd/chatwebsocketshandler/wire"
+	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/google/wire"
 )
 
 type ChatWebSocketHandlerITTestContainer struct {
 	applicationwire.Locator
 	applicationwire.ChatWebSocketHandlerContainer
+
+	// WebSocketMetric is exposed to assert the WebSocket metrics, see ittesthelper.NewWebSocketMetricHelper
+	WebSocketMetric *websocket.WebSocketMetric
 }
 
 var ITTestBindingSet = wire.NewSet(
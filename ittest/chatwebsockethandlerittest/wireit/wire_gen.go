@@ -7,12 +7,14 @@
 package wireit
 
 import (
+	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/config"
 	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/handler"
 	"github.com/domesama/chat-and-notifications/chatwebsocketshandler/service"
 	"github.com/domesama/chat-and-notifications/cmd/chatwebsocketshandler/wire"
 	"github.com/domesama/chat-and-notifications/connections"
 	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 )
@@ -20,37 +22,63 @@ import (
 // Injectors from di.go:
 
 func InitChatWebSocketHandlerITTestContainer() (ChatWebSocketHandlerITTestContainer, func(), error) {
+	chatWebSocketHandlerConfig := config.ProvideChatWebSocketHandlerConfig()
 	webSocketConfig := websocket.ProvideWebSocketConfig()
-	webSocketManager := websocket.ProvideDefaultWebSocketManager(webSocketConfig)
+	presenceConfig := presence.ProvidePresenceConfig()
+	client, cleanup, err := wire.ProvideOptionalRedisClient(webSocketConfig, presenceConfig)
+	if err != nil {
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
+	webSocketMetric, err := websocket.ProvideWebSocketMetric()
+	if err != nil {
+		cleanup()
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
+	webSocketManager, cleanup2, err := websocket.ProvideWebSocketManager(webSocketConfig, client, webSocketMetric)
+	if err != nil {
+		cleanup()
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
+	tracker, cleanup3, err := presence.ProvidePresenceTracker(presenceConfig, client)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
 	chatWebSocketHandler := &handler.ChatWebSocketHandler{
 		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           chatWebSocketHandlerConfig,
 	}
 	handlerChatWebSocketHandler := handler.ChatWebSocketHandler{
 		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           chatWebSocketHandlerConfig,
 	}
 	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(handlerChatWebSocketHandler)
 	mongoDBConfig := connectionconfig.ProvideMongoDBConfig()
-	client, cleanup, err := connections.ProvideMongoClient(mongoDBConfig)
+	mongoClient, cleanup4, err := connections.ProvideMongoClient(mongoDBConfig)
 	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
 		return ChatWebSocketHandlerITTestContainer{}, nil, err
 	}
-	database := connections.ProvideMongoDatabase(client, mongoDBConfig)
+	database := connections.ProvideMongoDatabase(mongoClient, mongoDBConfig)
 	chatPersistenceService := &service.ChatPersistenceService{
 		DB: database,
 	}
 	locator := wire.Locator{
-		ChatWebSocketHandler:   chatWebSocketHandler,
-		RouterCustomizer:       routerWithWebSocketCustomizer,
-		ChatPersistenceService: chatPersistenceService,
+		ChatWebSocketHandlerConfig: chatWebSocketHandlerConfig,
+		ChatWebSocketHandler:       chatWebSocketHandler,
+		RouterCustomizer:           routerWithWebSocketCustomizer,
+		ChatPersistenceService:     chatPersistenceService,
 	}
 	httpServerConfig := httpserverwrapper.ProvideHTTPConfig()
-	httpWithWebSocketServer, cleanup2, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager)
-	if err != nil {
-		cleanup()
-		return ChatWebSocketHandlerITTestContainer{}, nil, err
-	}
 	resource, err := doakeswire.ProvideResource()
 	if err != nil {
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerITTestContainer{}, nil, err
@@ -58,13 +86,38 @@ func InitChatWebSocketHandlerITTestContainer() (ChatWebSocketHandlerITTestContai
 	metricsConfig := doakeswire.ProvideMetricsConfig()
 	telemetryServerConfig, err := doakeswire.ProvideTelemetryServerConfig()
 	if err != nil {
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerITTestContainer{}, nil, err
 	}
 	options := doakeswire.ProvideServerOptions(resource, metricsConfig, telemetryServerConfig)
-	telemetryServer, cleanup3, err := doakeswire.ProvideServer(options)
+	telemetryServer, cleanup5, err := doakeswire.ProvideServer(options)
 	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
+	longPollConfig := httpserverwrapper.ProvideLongPollConfig()
+	httpWithWebSocketServer, cleanup6, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager, telemetryServer, longPollConfig)
+	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return ChatWebSocketHandlerITTestContainer{}, nil, err
+	}
+	webSocketAdminConfig := httpserverwrapper.ProvideWebSocketAdminConfig()
+	webSocketAdminServer, cleanup7, err := httpserverwrapper.ProvideWebSocketAdminServer(webSocketAdminConfig, httpServerConfig, webSocketManager, routerWithWebSocketCustomizer)
+	if err != nil {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 		return ChatWebSocketHandlerITTestContainer{}, nil, err
@@ -72,12 +125,18 @@ func InitChatWebSocketHandlerITTestContainer() (ChatWebSocketHandlerITTestContai
 	chatWebSocketHandlerContainer := wire.ChatWebSocketHandlerContainer{
 		HTTPWithWebSocketServer: httpWithWebSocketServer,
 		TelemetryServer:         telemetryServer,
+		AdminServer:             webSocketAdminServer,
 	}
 	chatWebSocketHandlerITTestContainer := ChatWebSocketHandlerITTestContainer{
 		Locator:                       locator,
 		ChatWebSocketHandlerContainer: chatWebSocketHandlerContainer,
+		WebSocketMetric:               webSocketMetric,
 	}
 	return chatWebSocketHandlerITTestContainer, func() {
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
 		cleanup3()
 		cleanup2()
 		cleanup()
@@ -2,12 +2,16 @@ package wireit
 
 import (
 	applicationwire "github.com/domesama/chat-and-notifications/cmd/generalnotificationshandler/wire"
+	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/google/wire"
 )
 
 type GeneralNotificationHandlerITTestContainer struct {
 	applicationwire.Locator
 	applicationwire.GeneralNotificationHandlerContainer
+
+	// WebSocketMetric is exposed to assert the WebSocket metrics, see ittesthelper.NewWebSocketMetricHelper
+	WebSocketMetric *websocket.WebSocketMetric
 }
 
 var ITTestBindingSet = wire.NewSet(
@@ -8,8 +8,10 @@ package wireit
 
 import (
 	"github.com/domesama/chat-and-notifications/cmd/generalnotificationshandler/wire"
+	"github.com/domesama/chat-and-notifications/generalnotifications/config"
 	"github.com/domesama/chat-and-notifications/generalnotifications/handler"
 	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/presence"
 	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/doakeswire"
 )
@@ -17,50 +19,103 @@ import (
 // Injectors from di.go:
 
 func InitGeneralNotificationHandlerITTestContainer() (GeneralNotificationHandlerITTestContainer, func(), error) {
+	generalNotificationHandlerConfig := config.ProvideGeneralNotificationHandlerConfig()
 	webSocketConfig := websocket.ProvideWebSocketConfig()
-	webSocketManager := websocket.ProvideDefaultWebSocketManager(webSocketConfig)
+	presenceConfig := presence.ProvidePresenceConfig()
+	client, cleanup, err := wire.ProvideOptionalRedisClient(webSocketConfig, presenceConfig)
+	if err != nil {
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
+	webSocketMetric, err := websocket.ProvideWebSocketMetric()
+	if err != nil {
+		cleanup()
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
+	webSocketManager, cleanup2, err := websocket.ProvideWebSocketManager(webSocketConfig, client, webSocketMetric)
+	if err != nil {
+		cleanup()
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
+	tracker, cleanup3, err := presence.ProvidePresenceTracker(presenceConfig, client)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
 	generalNotificationWebSocketHandler := &handler.GeneralNotificationWebSocketHandler{
 		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           generalNotificationHandlerConfig,
 	}
 	handlerGeneralNotificationWebSocketHandler := handler.GeneralNotificationWebSocketHandler{
 		WebSocketManager: webSocketManager,
+		PresenceTracker:  tracker,
+		Config:           generalNotificationHandlerConfig,
 	}
 	routerWithWebSocketCustomizer := handler.ProvideRouterCustomizer(handlerGeneralNotificationWebSocketHandler)
 	locator := wire.Locator{
+		GeneralNotificationHandlerConfig:    generalNotificationHandlerConfig,
 		GeneralNotificationWebSocketHandler: generalNotificationWebSocketHandler,
 		RouterCustomizer:                    routerWithWebSocketCustomizer,
 	}
 	httpServerConfig := httpserverwrapper.ProvideHTTPConfig()
-	httpWithWebSocketServer, cleanup, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager)
-	if err != nil {
-		return GeneralNotificationHandlerITTestContainer{}, nil, err
-	}
 	resource, err := doakeswire.ProvideResource()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerITTestContainer{}, nil, err
 	}
 	metricsConfig := doakeswire.ProvideMetricsConfig()
 	telemetryServerConfig, err := doakeswire.ProvideTelemetryServerConfig()
 	if err != nil {
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerITTestContainer{}, nil, err
 	}
 	options := doakeswire.ProvideServerOptions(resource, metricsConfig, telemetryServerConfig)
-	telemetryServer, cleanup2, err := doakeswire.ProvideServer(options)
+	telemetryServer, cleanup4, err := doakeswire.ProvideServer(options)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
+	longPollConfig := httpserverwrapper.ProvideLongPollConfig()
+	httpWithWebSocketServer, cleanup5, err := httpserverwrapper.ProvideHTTPWithWebSocketServer(httpServerConfig, routerWithWebSocketCustomizer, webSocketManager, telemetryServer, longPollConfig)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return GeneralNotificationHandlerITTestContainer{}, nil, err
+	}
+	webSocketAdminConfig := httpserverwrapper.ProvideWebSocketAdminConfig()
+	webSocketAdminServer, cleanup6, err := httpserverwrapper.ProvideWebSocketAdminServer(webSocketAdminConfig, httpServerConfig, webSocketManager, routerWithWebSocketCustomizer)
 	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
 		cleanup()
 		return GeneralNotificationHandlerITTestContainer{}, nil, err
 	}
 	generalNotificationHandlerContainer := wire.GeneralNotificationHandlerContainer{
 		HTTPWithWebSocketServer: httpWithWebSocketServer,
 		TelemetryServer:         telemetryServer,
+		AdminServer:             webSocketAdminServer,
 	}
 	generalNotificationHandlerITTestContainer := GeneralNotificationHandlerITTestContainer{
 		Locator:                             locator,
 		GeneralNotificationHandlerContainer: generalNotificationHandlerContainer,
+		WebSocketMetric:                     webSocketMetric,
 	}
 	return generalNotificationHandlerITTestContainer, func() {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 	}, nil
@@ -9,6 +9,7 @@ import (
 
 	"github.com/domesama/chat-and-notifications/event"
 	testutils2 "github.com/domesama/chat-and-notifications/utils/testutils"
+	"github.com/domesama/chat-and-notifications/websocket"
 	"github.com/domesama/doakes/server"
 	doakestest "github.com/domesama/doakes/testutil"
 	"github.com/stretchr/testify/assert"
@@ -18,7 +19,7 @@ type EventMetricHelper struct {
 	t                *testing.T
 	mu               sync.RWMutex
 	internalPrefix   string
-	eventMetric      *event.EventMetric
+	resetMetric      func(prefix string) // Replaces the instruments of the asserted metric with ones named after prefix
 	PrometheusHelper *doakestest.PrometheusHelper
 }
 
@@ -27,7 +28,27 @@ func NewMetricHelper(
 	telemetryServer *server.TelemetryServer,
 	metric *event.EventMetric) EventMetricHelper {
 	return EventMetricHelper{
-		t: t, eventMetric: metric,
+		t: t,
+		resetMetric: func(prefix string) {
+			*metric = *event.CreateEventMetrics(prefix)
+		},
+		PrometheusHelper: doakestest.NewPrometheusHelper(telemetryServer.GetRunningPort()),
+	}
+}
+
+// NewWebSocketMetricHelper asserts the WebSocket metrics.
+// Reset the metric before opening connections, the gauges start over from 0
+func NewWebSocketMetricHelper(
+	t *testing.T,
+	telemetryServer *server.TelemetryServer,
+	metric *websocket.WebSocketMetric) EventMetricHelper {
+	return EventMetricHelper{
+		t: t,
+		resetMetric: func(prefix string) {
+			webSocketMetric, err := websocket.CreateWebSocketMetrics(prefix)
+			assert.NoError(t, err)
+			*metric = *webSocketMetric
+		},
 		PrometheusHelper: doakestest.NewPrometheusHelper(telemetryServer.GetRunningPort()),
 	}
 }
@@ -63,7 +84,13 @@ func (m *EventMetricHelper) ReadAndAssertIncomingCounterMetrics(
 				},
 			)
 			if actualMetric != nil {
+				// Counters are read as is, gauges by their current value and histograms by their sample count
 				actualValue := int(actualMetric.GetCounter().GetValue())
+				if gauge := actualMetric.GetGauge(); gauge != nil {
+					actualValue = int(gauge.GetValue())
+				} else if histogram := actualMetric.GetHistogram(); histogram != nil {
+					actualValue = int(histogram.GetSampleCount())
+				}
 				if shouldAssert {
 					testutils2.AssertEqualWithMessage(
 						m.t,
@@ -105,7 +132,7 @@ func (m *EventMetricHelper) ResetEventMetric() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.internalPrefix = fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), os.Getpid())
-	*m.eventMetric = *event.CreateEventMetrics(m.internalPrefix)
+	m.resetMetric(m.internalPrefix)
 }
 
 func (m *EventMetricHelper) NeverExceedsMetricCount(
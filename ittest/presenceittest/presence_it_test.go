@@ -0,0 +1,145 @@
+package ittest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/connections"
+	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
+	"github.com/domesama/chat-and-notifications/presence"
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type PresenceITTestSuite struct {
+	suite.Suite
+	redisClient redis.Client
+	directory   presence.Directory
+}
+
+func TestPresenceITTestSuite(t *testing.T) {
+	suite.Run(t, new(PresenceITTestSuite))
+}
+
+func (t *PresenceITTestSuite) SetupSuite() {
+	t.NoError(godotenv.Load("../../.env.integration"))
+
+	redisClient, cleanUp, err := connections.ProvideRedisClient(connectionconfig.ProvideRedisClientConfig())
+	t.Require().NoError(err)
+	t.T().Cleanup(cleanUp)
+
+	t.redisClient = redisClient
+	t.directory = presence.ProvidePresenceDirectory(redisClient)
+}
+
+func (t *PresenceITTestSuite) newTracker(podAddress string) *presence.Tracker {
+	tracker, cleanUp, err := presence.ProvidePresenceTracker(
+		presence.PresenceConfig{
+			Enabled:           true,
+			PodAddress:        podAddress,
+			TTL:               3 * time.Second,
+			HeartbeatInterval: time.Second,
+		}, &t.redisClient,
+	)
+	t.Require().NoError(err)
+	t.T().Cleanup(cleanUp)
+	return tracker
+}
+
+func (t *PresenceITTestSuite) TestLookupPodsHoldingTheKey() {
+	ctx := context.Background()
+	streamID := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	podA := t.newTracker("http://pod-a:8080")
+	podB := t.newTracker("http://pod-b:8080")
+
+	podA.Track(presence.NamespaceChat, streamID)
+	// In case the same user is connected from multiple devices on the same pod
+	podA.Track(presence.NamespaceChat, streamID)
+	podB.Track(presence.NamespaceChat, streamID)
+
+	pods, err := t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	t.NoError(err)
+	t.ElementsMatch([]string{"http://pod-a:8080", "http://pod-b:8080"}, pods)
+
+	// Key spaces of the services are separated
+	pods, err = t.directory.LookupPods(ctx, presence.NamespaceNotifications, streamID)
+	t.NoError(err)
+	t.Empty(pods)
+
+	// The entry of a pod is kept until its last connection is gone
+	podA.Untrack(presence.NamespaceChat, streamID)
+	podB.Untrack(presence.NamespaceChat, streamID)
+	pods, err = t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	t.NoError(err)
+	t.Equal([]string{"http://pod-a:8080"}, pods)
+
+	podA.Untrack(presence.NamespaceChat, streamID)
+	pods, err = t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	t.NoError(err)
+	t.Empty(pods)
+}
+
+func (t *PresenceITTestSuite) TestHeartbeatKeepsEntriesAlive() {
+	ctx := context.Background()
+	streamID := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	tracker := t.newTracker("http://pod-a:8080")
+	tracker.Track(presence.NamespaceChat, streamID)
+
+	// Outlive the TTL, the heartbeat should have extended the entry in the meantime
+	time.Sleep(4 * time.Second)
+
+	pods, err := t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	t.NoError(err)
+	t.Equal([]string{"http://pod-a:8080"}, pods)
+}
+
+func (t *PresenceITTestSuite) TestExpiredEntriesAreIgnored() {
+	ctx := context.Background()
+	streamID := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	// Simulate a pod that crashed without removing its entry
+	expiredAt := time.Now().Add(-time.Second).UnixMilli()
+	t.NoError(
+		t.redisClient.ZAdd(
+			ctx, "presence:chat:"+streamID,
+			redis.Z{Score: float64(expiredAt), Member: "http://crashed-pod:8080"},
+		).Err(),
+	)
+
+	pods, err := t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+	t.NoError(err)
+	t.Empty(pods)
+}
+
+func (t *PresenceITTestSuite) TestQuickReconnectKeepsTheEntry() {
+	ctx := context.Background()
+	tracker := t.newTracker("http://pod-a:8080")
+
+	for i := 0; i < 20; i++ {
+		streamID := fmt.Sprintf("stream-%d-%d", time.Now().UnixNano(), i)
+		tracker.Track(presence.NamespaceChat, streamID)
+
+		// The disconnect and the reconnect race, the live connection must stay in the directory whatever the order
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tracker.Untrack(presence.NamespaceChat, streamID)
+		}()
+		go func() {
+			defer wg.Done()
+			tracker.Track(presence.NamespaceChat, streamID)
+		}()
+		wg.Wait()
+
+		pods, err := t.directory.LookupPods(ctx, presence.NamespaceChat, streamID)
+		t.NoError(err)
+		t.Equal([]string{"http://pod-a:8080"}, pods)
+	}
+}
@@ -2,6 +2,7 @@ package chatwebsockethandlerstub
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/domesama/chat-and-notifications/ittest/stub"
 	"github.com/domesama/chat-and-notifications/model"
@@ -18,8 +19,19 @@ func ChatWebSocketHandlerRouterStub(engine *gin.Engine) *ChatWebSocketForwarderS
 	return chatForwarderHandler
 }
 
+// ChatWebSocketAdminRouterStub serves the routes of the internal admin listener of the chat websocket service,
+// they are recorded by the stub of the public routes
+func ChatWebSocketAdminRouterStub(engine *gin.Engine, chatForwarderHandler *ChatWebSocketForwarderStub) {
+	engine.POST(
+		"/chat/close-websocket-stream", chatForwarderHandler.closeChatStreamConnections,
+	)
+}
+
 type ChatWebSocketForwarderStub struct {
 	chatWebsocketForwarderStub []ChatWebSocketForwardAPIStub
+
+	mu            sync.Mutex
+	closedStreams []model.ChatStreamClose
 }
 
 func (c *ChatWebSocketForwarderStub) AddForwardChatMessageToWebSocketStub(stub ...ChatWebSocketForwardAPIStub) {
@@ -44,3 +56,25 @@ func (c *ChatWebSocketForwarderStub) forwardChatMessageToSubscribers(gctx *gin.C
 		}
 	}
 }
+
+// ClosedStreams returns the stream close requests received so far
+func (c *ChatWebSocketForwarderStub) ClosedStreams() []model.ChatStreamClose {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]model.ChatStreamClose(nil), c.closedStreams...)
+}
+
+func (c *ChatWebSocketForwarderStub) closeChatStreamConnections(gctx *gin.Context) {
+	var streamClose model.ChatStreamClose
+	if err := gctx.ShouldBindJSON(&streamClose); err != nil {
+		gctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closedStreams = append(c.closedStreams, streamClose)
+	gctx.JSON(http.StatusOK, gin.H{"closed": 1, "stream_id": streamClose.StreamID})
+}
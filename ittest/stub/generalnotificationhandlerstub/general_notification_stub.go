@@ -41,6 +41,7 @@ func (c *ChatNotificationHandlerStub) chatNotificationHandler(gctx *gin.Context)
 	for _, s := range c.chatNotiStub {
 		if s.Predicates.IsSatisfied(gctx, chatMessage) {
 			gctx.JSON(s.StubStatusCode, gin.H{})
+			return
 		}
 	}
 }
@@ -0,0 +1,116 @@
+package ittest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/connections"
+	"github.com/domesama/chat-and-notifications/connections/connectionconfig"
+	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+// BaseRedisPubSubManagerITTestSuite runs two redis_pubsub managers against the local Redis, each standing for a pod
+type BaseRedisPubSubManagerITTestSuite struct {
+	suite.Suite
+	redisClient   redis.Client
+	channelPrefix string
+	podA          websocket.WebSocketManager
+	podB          websocket.WebSocketManager
+}
+
+func (t *BaseRedisPubSubManagerITTestSuite) SetupSuite() {
+	t.NoError(godotenv.Load("../../.env.integration"))
+
+	redisClient, cleanUp, err := connections.ProvideRedisClient(connectionconfig.ProvideRedisClientConfig())
+	t.Require().NoError(err)
+	t.T().Cleanup(cleanUp)
+	t.redisClient = redisClient
+	t.channelPrefix = fmt.Sprintf("websocket_it_%d", os.Getpid())
+
+	t.podA = t.newPod()
+	t.podB = t.newPod()
+}
+
+func (t *BaseRedisPubSubManagerITTestSuite) newPod() websocket.WebSocketManager {
+	return t.newPodWithConfig(websocket.ProvideWebSocketConfig())
+}
+
+func (t *BaseRedisPubSubManagerITTestSuite) newPodWithConfig(cfg websocket.WebSocketConfig) websocket.WebSocketManager {
+	cfg.ManagerBackend = websocket.ManagerBackendRedisPubSub
+	cfg.RedisPubSubChannelPrefix = t.channelPrefix
+
+	metric, err := websocket.ProvideWebSocketMetric()
+	t.Require().NoError(err)
+	manager, cleanUp, err := websocket.ProvideWebSocketManager(cfg, &t.redisClient, metric)
+	t.Require().NoError(err)
+	t.T().Cleanup(
+		func() {
+			manager.CloseAll(gorillaws.CloseGoingAway, "test finished")
+			cleanUp()
+		},
+	)
+	return manager
+}
+
+// subscribeOnPod connects a client whose server side connection is registered to the given pod under the key
+func (t *BaseRedisPubSubManagerITTestSuite) subscribeOnPod(
+	ctx context.Context, pod websocket.WebSocketManager, key string,
+) (msgChan chan map[string]string, connection *websocket.WebSocketConnection) {
+	return connectToPod[map[string]string](t, ctx, pod, key)
+}
+
+// sequencedMessage is a broadcast stamped with the sequence number of its key
+type sequencedMessage struct {
+	Seq     uint64 `json:"seq"`
+	Content string `json:"content"`
+}
+
+func (t *BaseRedisPubSubManagerITTestSuite) subscribeToSequencedOnPod(
+	ctx context.Context, pod websocket.WebSocketManager, key string,
+) chan sequencedMessage {
+	msgChan, _ := connectToPod[sequencedMessage](t, ctx, pod, key)
+	return msgChan
+}
+
+// connectToPod connects a client decoding the broadcasts as T, see subscribeOnPod
+func connectToPod[T any](
+	t *BaseRedisPubSubManagerITTestSuite, ctx context.Context, pod websocket.WebSocketManager, key string,
+) (msgChan chan T, connection *websocket.WebSocketConnection) {
+	connections := make(chan *websocket.WebSocketConnection, 1)
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				conn, err := (&gorillaws.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				c := pod.RegisterConnection(key, websocket.Metadata{}, conn)
+				connections <- c
+				<-c.CloseChan
+			},
+		),
+	)
+	t.T().Cleanup(srv.Close)
+
+	msgChan, cleanUp, err := websocket.SubscribeToWebSocket[T](
+		ctx, "ws"+strings.TrimPrefix(srv.URL, "http"),
+	)
+	t.Require().NoError(err)
+	t.T().Cleanup(cleanUp)
+
+	select {
+	case connection = <-connections:
+	case <-time.After(5 * time.Second):
+		t.FailNow("connection was not registered")
+	}
+	return msgChan, connection
+}
@@ -0,0 +1,118 @@
+package ittest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/stretchr/testify/suite"
+)
+
+type RedisPubSubManagerITTestSuite struct {
+	BaseRedisPubSubManagerITTestSuite
+}
+
+func TestRedisPubSubManagerITTestSuite(t *testing.T) {
+	suite.Run(t, new(RedisPubSubManagerITTestSuite))
+}
+
+func (t *RedisPubSubManagerITTestSuite) TestBroadcastIsDeliveredByThePodHoldingTheConnection() {
+	ctx := context.Background()
+	key := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	msgChan, _ := t.subscribeOnPod(ctx, t.podB, key)
+
+	result, err := t.podA.BroadcastPayloadToLocalSubscribers(ctx, key, []byte(`{"content":"Hello"}`))
+	t.NoError(err)
+	t.Equal(websocket.BroadcastResult{DeliveredCount: 1}, result)
+
+	select {
+	case msg := <-msgChan:
+		t.Equal("Hello", msg["content"])
+	case <-time.After(5 * time.Second):
+		t.Fail("message was not delivered by the other pod")
+	}
+}
+
+func (t *RedisPubSubManagerITTestSuite) TestBroadcastAggregatesDeliveryCountsOfEveryPod() {
+	ctx := context.Background()
+	key := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	msgChanA, _ := t.subscribeOnPod(ctx, t.podA, key)
+	msgChanB, _ := t.subscribeOnPod(ctx, t.podB, key)
+	// In case the same user is connected from multiple devices on the same pod
+	msgChanBOtherDevice, _ := t.subscribeOnPod(ctx, t.podB, key)
+
+	result, err := t.podA.BroadcastPayloadToLocalSubscribers(ctx, key, []byte(`{"content":"Hello"}`))
+	t.NoError(err)
+	t.Equal(3, result.DeliveredCount)
+
+	for _, msgChan := range []chan map[string]string{msgChanA, msgChanB, msgChanBOtherDevice} {
+		select {
+		case msg := <-msgChan:
+			t.Equal("Hello", msg["content"])
+		case <-time.After(5 * time.Second):
+			t.Fail("message was not delivered")
+		}
+	}
+}
+
+func (t *RedisPubSubManagerITTestSuite) TestBroadcastWithoutSubscribers() {
+	ctx := context.Background()
+	key := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	result, err := t.podA.BroadcastPayloadToLocalSubscribers(ctx, key, []byte(`{}`))
+	t.NoError(err)
+	t.Zero(result.DeliveredCount)
+
+	// The pod unsubscribes from the key once its last connection is gone
+	_, connection := t.subscribeOnPod(ctx, t.podB, key)
+	t.podB.UnregisterConnectionByID(key, connection.ID)
+
+	channel := fmt.Sprintf("%s:broadcast:%s", t.channelPrefix, key)
+	t.Eventually(
+		func() bool {
+			receivers, err := t.redisClient.PubSubNumSub(ctx, channel).Result()
+			return err == nil && receivers[channel] == 0
+		}, 5*time.Second, 100*time.Millisecond,
+	)
+}
+
+func (t *RedisPubSubManagerITTestSuite) TestSequencedBroadcastsAreReceivedInSequenceOrder() {
+	ctx := context.Background()
+	key := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+
+	cfg := websocket.ProvideWebSocketConfig()
+	cfg.ReplayBufferSize = 100
+	podA, podB := t.newPodWithConfig(cfg), t.newPodWithConfig(cfg)
+	received := t.subscribeToSequencedOnPod(ctx, podB, key)
+
+	// Both pods publish concurrently, the pods must still receive the broadcasts in the order of their seq
+	const broadcasts = 50
+	var wg sync.WaitGroup
+	for _, pod := range []websocket.WebSocketManager{podA, podB} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < broadcasts; i++ {
+				_, err := pod.BroadcastPayloadToLocalSubscribers(ctx, key, []byte(`{"content":"Hello"}`))
+				t.NoError(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var lastSeq uint64
+	for i := 0; i < 2*broadcasts; i++ {
+		select {
+		case msg := <-received:
+			t.Greater(msg.Seq, lastSeq, "broadcasts were received out of sequence order")
+			lastSeq = msg.Seq
+		case <-time.After(5 * time.Second):
+			t.FailNow("broadcast was not delivered")
+		}
+	}
+}
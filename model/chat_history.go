@@ -0,0 +1,20 @@
+package model
+
+// ChatHistoryQuery is the query for reading a page of chat messages of a stream.
+// Since and Before are message IDs used as cursors, only one of them may be set:
+// - Since returns the messages created after the cursor (used to catch up after a websocket drop)
+// - Before returns the messages created before the cursor (used to scroll back in history)
+// - Neither returns the latest page of the stream
+type ChatHistoryQuery struct {
+	StreamID string `form:"stream_id" binding:"required"`
+	Since    string `form:"since"`
+	Before   string `form:"before"`
+	Limit    int64  `form:"limit" binding:"gte=0"`
+}
+
+// ChatHistoryPage is a page of chat messages, always sorted from the oldest to the newest.
+// HasMore reports whether there are more messages further in the paging direction.
+type ChatHistoryPage struct {
+	Messages []ChatMessage `json:"messages"`
+	HasMore  bool          `json:"has_more"`
+}
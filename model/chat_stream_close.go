@@ -0,0 +1,8 @@
+package model
+
+// ChatStreamClose asks the chat websocket service to close every connection of a stream,
+// e.g. once the delivery of one of its messages ran out of retries
+type ChatStreamClose struct {
+	StreamID string `json:"stream_id" binding:"required"`
+	Reason   string `json:"reason"`
+}
@@ -0,0 +1,21 @@
+package presence
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// PresenceConfig contains the settings of the Tracker recording which keys this pod holds connections for
+type PresenceConfig struct {
+	Enabled bool `envconfig:"PRESENCE_ENABLED" default:"false"`
+	// PodAddress is the base URL other services use to reach this pod directly, e.g. http://10.0.0.12:8080
+	PodAddress        string        `envconfig:"PRESENCE_POD_ADDRESS"`
+	TTL               time.Duration `envconfig:"PRESENCE_TTL" default:"30s"`
+	HeartbeatInterval time.Duration `envconfig:"PRESENCE_HEARTBEAT_INTERVAL" default:"10s"`
+}
+
+func ProvidePresenceConfig() (conf PresenceConfig) {
+	envconfig.MustProcess("", &conf)
+	return
+}
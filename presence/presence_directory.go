@@ -0,0 +1,51 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Namespace separates the key spaces of the WebSocket services sharing the directory
+type Namespace string
+
+const (
+	// NamespaceChat holds the stream_id keys of chatwebsocketshandler
+	NamespaceChat Namespace = "chat"
+	// NamespaceNotifications holds the user_id keys of generalnotificationshandler
+	NamespaceNotifications Namespace = "notifications"
+)
+
+// Directory looks up the pods holding the connections of a key.
+// Each key is a sorted set of pod addresses scored by the expiry of the entry,
+// so that entries of pods that stopped heartbeating expire individually
+type Directory struct {
+	RedisClient redis.Client
+}
+
+func ProvidePresenceDirectory(redisClient redis.Client) Directory {
+	return Directory{RedisClient: redisClient}
+}
+
+// LookupPods returns the addresses of the pods holding connections of the key, excluding expired entries
+func (d Directory) LookupPods(ctx context.Context, namespace Namespace, key string) ([]string, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	pods, err := d.RedisClient.ZRangeByScore(
+		ctx, directoryKey(namespace, key), &redis.ZRangeBy{
+			Min: "(" + now,
+			Max: "+inf",
+		},
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up presence of key %s: %w", key, err)
+	}
+	return pods, nil
+}
+
+func directoryKey(namespace Namespace, key string) string {
+	return fmt.Sprintf("presence:%s:%s", namespace, key)
+}
@@ -0,0 +1,9 @@
+package presence
+
+import "errors"
+
+var (
+	ErrMissingPodAddress  = errors.New("PRESENCE_POD_ADDRESS is required when presence is enabled")
+	ErrInvalidPresenceTTL = errors.New("PRESENCE_TTL must be longer than PRESENCE_HEARTBEAT_INTERVAL")
+	ErrMissingRedisClient = errors.New("presence requires a Redis client when enabled")
+)
@@ -0,0 +1,29 @@
+package presence
+
+import "github.com/domesama/chat-and-notifications/websocket"
+
+// Hooks are the connection hooks of a route keeping the Directory up to date with the keys of its connections
+type Hooks struct {
+	OnConnect     websocket.OnConnectHook
+	OnDisconnect  websocket.OnDisconnectHook
+	OnSubscribe   websocket.SubscriptionHook
+	OnUnsubscribe websocket.SubscriptionHook
+}
+
+// Hooks returns the hooks tracking the key each connection is registered under and the keys it subscribed to
+func (t *Tracker) Hooks(namespace Namespace) Hooks {
+	return Hooks{
+		OnConnect: func(c *websocket.WebSocketConnection) {
+			t.Track(namespace, c.Key)
+		},
+		OnDisconnect: func(c *websocket.WebSocketConnection, _ websocket.DisconnectReason) {
+			t.Untrack(namespace, c.Key)
+		},
+		OnSubscribe: func(_ *websocket.WebSocketConnection, key string) {
+			t.Track(namespace, key)
+		},
+		OnUnsubscribe: func(_ *websocket.WebSocketConnection, key string) {
+			t.Untrack(namespace, key)
+		},
+	}
+}
@@ -0,0 +1,219 @@
+package presence
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Tracker records the keys this pod holds connections for in the Directory and heartbeats them until they are untracked.
+// Tracking is a no-op when presence is disabled
+type Tracker struct {
+	redisClient *redis.Client
+	cfg         PresenceConfig
+
+	mu      sync.Mutex
+	tracked map[string]int // Number of local connections by directory key
+
+	// keyLocks serialize the count change and the Redis write of a key so that a quick reconnect cannot have its ZADD
+	// overtaken by the ZREM of the previous disconnect
+	keyLocks [keyLockStripes]sync.Mutex
+}
+
+const keyLockStripes = 64
+
+// ProvidePresenceTracker starts heartbeating the tracked keys when presence is enabled, redisClient may be nil otherwise.
+// Returns the tracker and a cleanup function removing the entries of this pod
+func ProvidePresenceTracker(cfg PresenceConfig, redisClient *redis.Client) (*Tracker, func(), error) {
+	t := &Tracker{
+		redisClient: redisClient,
+		cfg:         cfg,
+		tracked:     map[string]int{},
+	}
+	if !cfg.Enabled {
+		return t, func() {}, nil
+	}
+
+	if redisClient == nil {
+		return nil, func() {}, ErrMissingRedisClient
+	}
+	if cfg.PodAddress == "" {
+		return nil, func() {}, ErrMissingPodAddress
+	}
+	if cfg.TTL <= cfg.HeartbeatInterval {
+		return nil, func() {}, ErrInvalidPresenceTTL
+	}
+
+	stop := make(chan struct{})
+	go t.heartbeat(stop)
+
+	cleanup := func() {
+		close(stop)
+		t.removeAll()
+	}
+	return t, cleanup, nil
+}
+
+// Track records that this pod holds a connection of the key, it is meant to be called from an OnConnect hook
+func (t *Tracker) Track(namespace Namespace, key string) {
+	if !t.cfg.Enabled {
+		return
+	}
+	directoryKey := directoryKey(namespace, key)
+	unlock := t.lockKey(directoryKey)
+	defer unlock()
+
+	t.mu.Lock()
+	t.tracked[directoryKey]++
+	first := t.tracked[directoryKey] == 1
+	t.mu.Unlock()
+
+	if first {
+		t.refresh(context.Background(), directoryKey)
+	}
+}
+
+// Untrack records that one connection of the key is gone, the entry of this pod is removed with the last connection.
+// It is meant to be called from an OnDisconnect hook
+func (t *Tracker) Untrack(namespace Namespace, key string) {
+	if !t.cfg.Enabled {
+		return
+	}
+	directoryKey := directoryKey(namespace, key)
+	unlock := t.lockKey(directoryKey)
+	defer unlock()
+
+	t.mu.Lock()
+	t.tracked[directoryKey]--
+	last := t.tracked[directoryKey] <= 0
+	if last {
+		delete(t.tracked, directoryKey)
+	}
+	t.mu.Unlock()
+
+	if last {
+		t.remove(context.Background(), directoryKey)
+	}
+}
+
+func (t *Tracker) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(t.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.refreshAll(context.Background())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refresh extends the entry of this pod and the expiry of the whole key so that abandoned keys are cleaned up by Redis
+func (t *Tracker) refresh(ctx context.Context, directoryKey string) {
+	expiresAt := time.Now().Add(t.cfg.TTL)
+
+	_, err := t.redisClient.TxPipelined(
+		ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, directoryKey, redis.Z{Score: float64(expiresAt.UnixMilli()), Member: t.cfg.PodAddress})
+			pipe.ZRemRangeByScore(ctx, directoryKey, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+			pipe.Expire(ctx, directoryKey, t.cfg.TTL)
+			return nil
+		},
+	)
+	if err != nil {
+		slog.Error("failed to refresh presence", "error", err, "key", directoryKey)
+	}
+}
+
+// refreshAll extends the entries of every tracked key in a single round trip.
+// Keys untracked while the pipeline ran are removed again so that the heartbeat does not resurrect them
+func (t *Tracker) refreshAll(ctx context.Context) {
+	directoryKeys := t.trackedKeys()
+	if len(directoryKeys) == 0 {
+		return
+	}
+	expiresAt := time.Now().Add(t.cfg.TTL)
+
+	_, err := t.redisClient.Pipelined(
+		ctx, func(pipe redis.Pipeliner) error {
+			for _, directoryKey := range directoryKeys {
+				pipe.ZAdd(ctx, directoryKey, redis.Z{Score: float64(expiresAt.UnixMilli()), Member: t.cfg.PodAddress})
+				pipe.ZRemRangeByScore(ctx, directoryKey, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+				pipe.Expire(ctx, directoryKey, t.cfg.TTL)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		slog.Error("failed to refresh presence", "error", err, "keys", len(directoryKeys))
+	}
+
+	for _, directoryKey := range directoryKeys {
+		t.removeIfUntracked(ctx, directoryKey)
+	}
+}
+
+func (t *Tracker) removeIfUntracked(ctx context.Context, directoryKey string) {
+	unlock := t.lockKey(directoryKey)
+	defer unlock()
+
+	t.mu.Lock()
+	_, tracked := t.tracked[directoryKey]
+	t.mu.Unlock()
+
+	if !tracked {
+		t.remove(ctx, directoryKey)
+	}
+}
+
+func (t *Tracker) remove(ctx context.Context, directoryKey string) {
+	if err := t.redisClient.ZRem(ctx, directoryKey, t.cfg.PodAddress).Err(); err != nil {
+		slog.Error("failed to remove presence", "error", err, "key", directoryKey)
+	}
+}
+
+func (t *Tracker) removeAll() {
+	directoryKeys := t.trackedKeys()
+	if len(directoryKeys) == 0 {
+		return
+	}
+	ctx := context.Background()
+
+	_, err := t.redisClient.Pipelined(
+		ctx, func(pipe redis.Pipeliner) error {
+			for _, directoryKey := range directoryKeys {
+				pipe.ZRem(ctx, directoryKey, t.cfg.PodAddress)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		slog.Error("failed to remove presence", "error", err, "keys", len(directoryKeys))
+	}
+}
+
+func (t *Tracker) lockKey(directoryKey string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(directoryKey))
+	mu := &t.keyLocks[h.Sum32()%keyLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (t *Tracker) trackedKeys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.tracked))
+	for directoryKey := range t.tracked {
+		keys = append(keys, directoryKey)
+	}
+	return keys
+}
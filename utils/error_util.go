@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
+// WrapError prefixes the error with its type, both can be matched with errors.Is
 func WrapError(errorMessage error, errorType error) error {
-	errStr := errorMessage.Error()
-	return fmt.Errorf("%w: %s", errorType, errStr)
+	return fmt.Errorf("%w: %w", errorType, errorMessage)
 }
@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AckFrameType is the inbound frame type clients acknowledge broadcast frames with when ack mode is enabled:
+// {"type": "ack", "payload": {"ack_id": "<ack_id of the frame>"}}
+const AckFrameType = "ack"
+
+// AckPayload is the payload of an ack frame
+type AckPayload struct {
+	AckID string `json:"ack_id"`
+}
+
+// pendingAck is a broadcast frame waiting for the acknowledgement of a connection
+type pendingAck struct {
+	connection *WebSocketConnection
+	ackID      string
+	frame      []byte
+	acked      chan struct{}
+	report     int // Index of the report of the connection in BroadcastResult.Connections
+}
+
+// connectionAcks tracks the frames of a connection waiting for an acknowledgement
+type connectionAcks struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAck
+}
+
+func (a *connectionAcks) track(ack *pendingAck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending == nil {
+		a.pending = map[string]*pendingAck{}
+	}
+	a.pending[ack.ackID] = ack
+}
+
+func (a *connectionAcks) untrack(ackID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.pending, ackID)
+}
+
+// acknowledge marks the frame as acknowledged, unknown or late acks are ignored
+func (a *connectionAcks) acknowledge(ackID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ack, ok := a.pending[ackID]; ok {
+		delete(a.pending, ackID)
+		close(ack.acked)
+	}
+}
+
+// withAckHandler adds the ack frame handler to the inbound handlers of a connection
+func withAckHandler(handlers InboundHandlers) InboundHandlers {
+	withAck := make(InboundHandlers, len(handlers)+1)
+	for frameType, handler := range handlers {
+		withAck[frameType] = handler
+	}
+	withAck[AckFrameType] = NewInboundHandler(
+		func(ctx context.Context, msg InboundMessage[AckPayload]) error {
+			msg.Connection.acks.acknowledge(msg.Payload.AckID)
+			return nil
+		},
+	)
+	return withAck
+}
+
+// frameWithAck stamps the frame with a new ack ID and tracks it on the connection,
+// returns nil when the frame is not a JSON object and cannot be acknowledged
+func frameWithAck(c *WebSocketConnection, message []byte) *pendingAck {
+	ackID := uuid.NewString()
+	frame, ok := injectField(message, "ack_id", []byte(`"`+ackID+`"`))
+	if !ok {
+		return nil
+	}
+
+	ack := &pendingAck{
+		connection: c,
+		ackID:      ackID,
+		frame:      frame,
+		acked:      make(chan struct{}),
+	}
+	c.acks.track(ack)
+	return ack
+}
+
+// enqueuedBroadcast is a broadcast enqueued to the local connections, along with the acks it waits for in ack mode
+type enqueuedBroadcast struct {
+	result BroadcastResult
+	err    error
+	acks   []*pendingAck
+
+	// route and fanOut label the broadcast metrics, fanOut is the number of local connections of the key
+	route  string
+	fanOut int
+	// startedAt is when the message started to be enqueued, the latencies of the reports are measured from it
+	startedAt time.Time
+}
+
+// awaitAcks waits for the connections to acknowledge the broadcast, redelivering the frame after each AckTimeout.
+// The delivered count only includes the connections that acknowledged the frame
+func (m *webSocketManager) awaitAcks(ctx context.Context, enqueued enqueuedBroadcast) (BroadcastResult, error) {
+	if !m.AckModeEnabled {
+		return enqueued.result, enqueued.err
+	}
+
+	// The reports are copied since each ack updates the report of its connection
+	result := enqueued.result
+	result.Connections = slices.Clone(result.Connections)
+
+	var acked, redelivered atomic.Int64
+	var wg sync.WaitGroup
+	for _, ack := range enqueued.acks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer ack.connection.acks.untrack(ack.ackID)
+
+			isAcked, redeliveries := m.awaitAck(ctx, ack)
+			var err error
+			if isAcked {
+				acked.Add(1)
+			} else {
+				err = ErrUnacknowledged
+			}
+			redelivered.Add(int64(redeliveries))
+			result.Connections[ack.report] = newConnectionDeliveryReport(ack.connection, enqueued.startedAt, err)
+		}()
+	}
+	wg.Wait()
+
+	result.AckedCount = int(acked.Load())
+	result.UnackedCount = len(enqueued.acks) - result.AckedCount
+	result.RedeliveredCount = int(redelivered.Load())
+	// Enqueued frames that could not be acknowledged, e.g. non JSON object payloads, count as delivered
+	result.DeliveredCount = result.DeliveredCount - len(enqueued.acks) + result.AckedCount
+
+	if result.UnackedCount == 0 {
+		return result, enqueued.err
+	}
+
+	unackedErr := fmt.Errorf("%w: %d of %d connections", ErrUnacknowledged, result.UnackedCount, len(enqueued.acks))
+	if enqueued.err != nil {
+		return result, fmt.Errorf("%w; %w", enqueued.err, unackedErr)
+	}
+	return result, unackedErr
+}
+
+func (m *webSocketManager) awaitAck(ctx context.Context, ack *pendingAck) (acked bool, redeliveries int) {
+	timer := time.NewTimer(m.AckTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ack.acked:
+			return true, redeliveries
+		case <-ack.connection.CloseChan:
+			return false, redeliveries
+		case <-ctx.Done():
+			return false, redeliveries
+		case <-timer.C:
+			if redeliveries >= m.AckMaxRedeliveries {
+				return false, redeliveries
+			}
+			if _, err := ack.connection.enqueue(ack.frame); err != nil {
+				return false, redeliveries
+			}
+			redeliveries++
+			timer.Reset(m.AckTimeout)
+		}
+	}
+}
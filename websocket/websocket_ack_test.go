@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketManagerAckMode(t *testing.T) {
+	ctx := context.Background()
+	cfg := WebSocketConfig{
+		PingInterval:       time.Minute,
+		PongWait:           time.Minute,
+		WriteWait:          time.Second,
+		SendQueueSize:      8,
+		AckModeEnabled:     true,
+		AckTimeout:         100 * time.Millisecond,
+		AckMaxRedeliveries: 1,
+	}
+
+	type ackedFrame struct {
+		AckID   string `json:"ack_id"`
+		Content string `json:"content"`
+	}
+
+	readFrame := func(t *testing.T, clientConn *websocket.Conn) ackedFrame {
+		var frame ackedFrame
+		require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, clientConn.ReadJSON(&frame))
+		return frame
+	}
+
+	ack := func(t *testing.T, clientConn *websocket.Conn, ackID string) {
+		payload, err := json.Marshal(AckPayload{AckID: ackID})
+		require.NoError(t, err)
+		require.NoError(t, clientConn.WriteJSON(InboundFrame{Type: AckFrameType, Payload: payload}))
+	}
+
+	t.Run(
+		"acknowledged frames count as delivered", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+			serverConn, clientConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+			go func() {
+				frame := readFrame(t, clientConn)
+				ack(t, clientConn, frame.AckID)
+			}()
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"Hello"}`))
+			require.NoError(t, err)
+			reports := withoutReports(&result)
+			assert.Equal(t, BroadcastResult{DeliveredCount: 1, AckedCount: 1}, result)
+			require.Len(t, reports, 1)
+			assert.NoError(t, reports[0].Err)
+		},
+	)
+
+	t.Run(
+		"unacknowledged frames are redelivered then reported", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+			ackingServerConn, ackingClientConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{"device": {"acking"}}, ackingServerConn)
+			silentServerConn, silentClientConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{"device": {"silent"}}, silentServerConn)
+
+			go func() {
+				frame := readFrame(t, ackingClientConn)
+				ack(t, ackingClientConn, frame.AckID)
+			}()
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"Hello"}`))
+			assert.ErrorIs(t, err, ErrUnacknowledged)
+			reports := withoutReports(&result)
+			assert.Equal(
+				t, BroadcastResult{DeliveredCount: 1, AckedCount: 1, UnackedCount: 1, RedeliveredCount: 1}, result,
+			)
+
+			// The report tells which device did not acknowledge
+			errs := map[string]error{}
+			for _, report := range reports {
+				errs[report.Metadata["device"][0]] = report.Err
+			}
+			assert.Equal(t, map[string]error{"acking": nil, "silent": ErrUnacknowledged}, errs)
+
+			// The silent client got the same frame twice
+			first := readFrame(t, silentClientConn)
+			redelivered := readFrame(t, silentClientConn)
+			assert.Equal(t, first, redelivered)
+			assert.Equal(t, "Hello", first.Content)
+		},
+	)
+
+	t.Run(
+		"late redelivery is acknowledged", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+			serverConn, clientConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+			go func() {
+				// Ignore the first delivery, acknowledge the redelivery
+				_ = readFrame(t, clientConn)
+				frame := readFrame(t, clientConn)
+				ack(t, clientConn, frame.AckID)
+			}()
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"Hello"}`))
+			require.NoError(t, err)
+			withoutReports(&result)
+			assert.Equal(t, BroadcastResult{DeliveredCount: 1, AckedCount: 1, RedeliveredCount: 1}, result)
+		},
+	)
+}
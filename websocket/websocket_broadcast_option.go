@@ -0,0 +1,98 @@
+package websocket
+
+import "slices"
+
+// MetadataMatch selects the connections of a broadcast by their Metadata.
+// A connection matches when, for every Include field, one of its values is listed,
+// and when none of its values of the Exclude fields is listed
+type MetadataMatch struct {
+	Include Metadata `json:"include,omitempty"`
+	Exclude Metadata `json:"exclude,omitempty"`
+}
+
+func (m MetadataMatch) isEmpty() bool {
+	return len(m.Include) == 0 && len(m.Exclude) == 0
+}
+
+func (m MetadataMatch) matches(c *WebSocketConnection) bool {
+	for field, values := range m.Include {
+		if !slices.ContainsFunc(c.Metadata[field], func(v string) bool { return slices.Contains(values, v) }) {
+			return false
+		}
+	}
+	for field, values := range m.Exclude {
+		if slices.ContainsFunc(c.Metadata[field], func(v string) bool { return slices.Contains(values, v) }) {
+			return false
+		}
+	}
+	return true
+}
+
+type BroadcastOptionalParams struct {
+	Filter      ConnectionPredicate
+	Match       MetadataMatch
+	MessageID   string
+	MessageType string
+}
+
+type BroadcastOptions func(optionalParam *BroadcastOptionalParams)
+
+// WithConnectionFilter only delivers the broadcast to the connections the predicate returns true for.
+// The filtered broadcast is neither sequenced nor kept for replay, since the predicate can't be applied on resume.
+// Predicates can't be sent to other pods, the redis_pubsub backend rejects them with ErrUnsupportedBroadcastFilter
+func WithConnectionFilter(predicate ConnectionPredicate) BroadcastOptions {
+	return func(optionalParam *BroadcastOptionalParams) {
+		optionalParam.Filter = predicate
+	}
+}
+
+// WithMetadataInclude only delivers the broadcast to the connections with one of the values in the metadata field
+func WithMetadataInclude(field string, values ...string) BroadcastOptions {
+	return func(optionalParam *BroadcastOptionalParams) {
+		if optionalParam.Match.Include == nil {
+			optionalParam.Match.Include = Metadata{}
+		}
+		optionalParam.Match.Include[field] = append(optionalParam.Match.Include[field], values...)
+	}
+}
+
+// WithMetadataExclude skips the connections with one of the values in the metadata field,
+// e.g. WithMetadataExclude("sender_id", senderID) to not echo a message back to its sender
+func WithMetadataExclude(field string, values ...string) BroadcastOptions {
+	return func(optionalParam *BroadcastOptionalParams) {
+		if optionalParam.Match.Exclude == nil {
+			optionalParam.Match.Exclude = Metadata{}
+		}
+		optionalParam.Match.Exclude[field] = append(optionalParam.Match.Exclude[field], values...)
+	}
+}
+
+// WithMessageID sets the ID of the Envelope of the broadcast, e.g. the ID of the stored message, a random one by default
+func WithMessageID(id string) BroadcastOptions {
+	return func(optionalParam *BroadcastOptionalParams) {
+		optionalParam.MessageID = id
+	}
+}
+
+// WithMessageType sets the type of the Envelope of the broadcast, DefaultMessageType by default
+func WithMessageType(messageType string) BroadcastOptions {
+	return func(optionalParam *BroadcastOptionalParams) {
+		optionalParam.MessageType = messageType
+	}
+}
+
+func bindBroadcastOptions(opts ...BroadcastOptions) BroadcastOptionalParams {
+	optionalParam := BroadcastOptionalParams{}
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+	return optionalParam
+}
+
+// selects returns whether the broadcast is delivered to the connection
+func (p BroadcastOptionalParams) selects(c *WebSocketConnection) bool {
+	if p.Filter != nil && !p.Filter(c) {
+		return false
+	}
+	return p.Match.matches(c)
+}
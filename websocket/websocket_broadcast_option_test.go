@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataMatch(t *testing.T) {
+	conn := &WebSocketConnection{Metadata: Metadata{"sender_id": {"user-1"}, "device": {"ios"}}}
+
+	tests := []struct {
+		name     string
+		opts     []BroadcastOptions
+		expected bool
+	}{
+		{name: "no filter", expected: true},
+		{name: "included value", opts: []BroadcastOptions{WithMetadataInclude("device", "android", "ios")}, expected: true},
+		{name: "missing included value", opts: []BroadcastOptions{WithMetadataInclude("device", "android")}},
+		{name: "missing included field", opts: []BroadcastOptions{WithMetadataInclude("receiver_id", "user-1")}},
+		{name: "excluded value", opts: []BroadcastOptions{WithMetadataExclude("sender_id", "user-1")}},
+		{name: "other excluded value", opts: []BroadcastOptions{WithMetadataExclude("sender_id", "user-2")}, expected: true},
+		{
+			name: "predicate",
+			opts: []BroadcastOptions{
+				WithConnectionFilter(func(c *WebSocketConnection) bool { return c.Metadata["device"][0] == "web" }),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, bindBroadcastOptions(tt.opts...).selects(conn))
+			},
+		)
+	}
+}
+
+func TestWebSocketManagerFilteredBroadcast(t *testing.T) {
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{
+			PingInterval:  time.Minute,
+			PongWait:      time.Minute,
+			WriteWait:     time.Second,
+			SendQueueSize: 8,
+		},
+	)
+	dial := newTestConnDialer(t)
+
+	serverConn, senderClientConn := dial()
+	m.RegisterConnection("stream", Metadata{"sender_id": {"user-1"}}, serverConn)
+	serverConn, receiverClientConn := dial()
+	m.RegisterConnection("stream", Metadata{"sender_id": {"user-2"}}, serverConn)
+
+	result, err := m.BroadcastPayloadToLocalSubscribers(
+		context.Background(), "stream", []byte(`{"content":"hello"}`), WithMetadataExclude("sender_id", "user-1"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DeliveredCount)
+	assertReply(t, receiverClientConn, `{"content":"hello"}`)
+
+	// The sender only gets the next unfiltered broadcast
+	_, err = m.BroadcastPayloadToLocalSubscribers(context.Background(), "stream", []byte(`{"content":"bye"}`))
+	require.NoError(t, err)
+	assertReply(t, senderClientConn, `{"content":"bye"}`)
+	assertReply(t, receiverClientConn, `{"content":"bye"}`)
+}
+
+func TestWebSocketManagerResumeSkipsFilteredBroadcasts(t *testing.T) {
+	ctx := context.Background()
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueueSize:    8,
+			ReplayBufferSize: 8,
+			ReplayBufferTTL:  time.Minute,
+		},
+	)
+	t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+	dial := newTestConnDialer(t)
+
+	readContent := func(t *testing.T, clientConn *websocket.Conn) (seq uint64, content string) {
+		var msg struct {
+			Seq     uint64 `json:"seq"`
+			Content string `json:"content"`
+		}
+		require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, clientConn.ReadJSON(&msg))
+		return msg.Seq, msg.Content
+	}
+
+	metadata := Metadata{"sender_id": {"user-1"}}
+	serverConn, clientConn := dial()
+	first := m.RegisterConnection("stream", metadata, serverConn)
+	_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "stream", []byte(`{"content":"first"}`))
+	require.NoError(t, err)
+	lastSeq, _ := readContent(t, clientConn)
+
+	// Missed while disconnected, the first two were not meant for this connection
+	m.UnregisterConnectionByID("stream", first.ID)
+	_, _ = m.BroadcastPayloadToLocalSubscribers(
+		ctx, "stream", []byte(`{"content":"excluded"}`), WithMetadataExclude("sender_id", "user-1"),
+	)
+	_, _ = m.BroadcastPayloadToLocalSubscribers(
+		ctx, "stream", []byte(`{"content":"included elsewhere"}`), WithMetadataInclude("sender_id", "user-2"),
+	)
+	_, _ = m.BroadcastPayloadToLocalSubscribers(
+		ctx, "stream", []byte(`{"content":"included"}`), WithMetadataInclude("sender_id", "user-1"),
+	)
+
+	serverConn, clientConn = dial()
+	m.RegisterConnection("stream", metadata, serverConn, WithResumeFrom(lastSeq))
+	_, err = m.BroadcastPayloadToLocalSubscribers(ctx, "stream", []byte(`{"content":"live"}`))
+	require.NoError(t, err)
+
+	for _, expected := range []string{"included", "live"} {
+		_, content := readContent(t, clientConn)
+		assert.Equal(t, expected, content)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 // SubscribeToWebSocket establishes a WebSocket connection and returns a channel for receiving messages.
 // It spawns a goroutine to continuously read messages from the WebSocket and unmarshal them into type T.
+// It is a test helper without reconnect, use websocketclient.Dial for a resilient client.
 func SubscribeToWebSocket[T any](ctx context.Context, wsURL string) (chan T, func(), error) {
 	dialer := &websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
@@ -1,16 +1,134 @@
 package websocket
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
+// OverflowPolicy decides what happens to a message enqueued to a connection whose send queue is full
+type OverflowPolicy string
+
+const (
+	// OverflowPolicyDropOldest drops the oldest queued message to make room for the new one
+	OverflowPolicyDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowPolicyDropNewest drops the new message, the broadcast reports it as undelivered
+	OverflowPolicyDropNewest OverflowPolicy = "drop_newest"
+	// OverflowPolicyDisconnect closes the slow connection with SendQueueOverflowCloseCode
+	OverflowPolicyDisconnect OverflowPolicy = "disconnect"
+)
+
+// Decode implements envconfig.Decoder to reject unknown policies at startup
+func (p *OverflowPolicy) Decode(value string) error {
+	switch policy := OverflowPolicy(value); policy {
+	case OverflowPolicyDropOldest, OverflowPolicyDropNewest, OverflowPolicyDisconnect:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown send queue overflow policy %q", value)
+	}
+}
+
+// ManagerBackend selects the WebSocketManager implementation, see ProvideWebSocketManager
+type ManagerBackend string
+
+const (
+	// ManagerBackendLocal broadcasts to the connections of the receiving pod only,
+	// it relies on the load balancer routing every request of a key to the pod holding its connections
+	ManagerBackendLocal ManagerBackend = "local"
+	// ManagerBackendRedisPubSub publishes broadcasts to Redis so that whichever pod holds the connections delivers them
+	ManagerBackendRedisPubSub ManagerBackend = "redis_pubsub"
+)
+
+// Decode implements envconfig.Decoder to reject unknown backends at startup
+func (b *ManagerBackend) Decode(value string) error {
+	switch backend := ManagerBackend(value); backend {
+	case ManagerBackendLocal, ManagerBackendRedisPubSub:
+		*b = backend
+		return nil
+	default:
+		return fmt.Errorf("unknown WebSocket manager backend %q", value)
+	}
+}
+
 // WebSocketConfig contains WebSocket-specific settings
 type WebSocketConfig struct {
 	PingInterval time.Duration `envconfig:"PING_INTERVAL" default:"30s"`
 	PongWait     time.Duration `envconfig:"PONG_WAIT" default:"40s"`
 	WriteWait    time.Duration `envconfig:"WRITE_WAIT" default:"10s"`
+
+	SendQueueSize              int            `envconfig:"SEND_QUEUE_SIZE" default:"256"`
+	SendQueueOverflowPolicy    OverflowPolicy `envconfig:"SEND_QUEUE_OVERFLOW_POLICY" default:"disconnect"`
+	SendQueueOverflowCloseCode int            `envconfig:"SEND_QUEUE_OVERFLOW_CLOSE_CODE" default:"1013"`
+
+	// ReplayBufferSize is the number of recent broadcasts kept per key for resuming connections.
+	// Replay is opt-in since it stamps a "seq" field into the payloads of the connections without envelope,
+	// 0 disables sequence numbers
+	ReplayBufferSize int `envconfig:"REPLAY_BUFFER_SIZE" default:"0"`
+	// ReplayBufferTTL is how long the buffer of a key is kept after its last broadcast
+	ReplayBufferTTL time.Duration `envconfig:"REPLAY_BUFFER_TTL" default:"5m"`
+
+	// AckModeEnabled stamps each broadcast frame with an "ack_id" and waits for the clients to acknowledge it,
+	// broadcasts then count a connection as delivered only once it acknowledged the frame
+	AckModeEnabled bool `envconfig:"ACK_MODE_ENABLED" default:"false"`
+	// AckTimeout is how long to wait for an ack before redelivering the frame, a broadcast waits at most
+	// AckTimeout * (AckMaxRedeliveries + 1) which should stay below the timeout of the forwarding clients
+	AckTimeout         time.Duration `envconfig:"ACK_TIMEOUT" default:"500ms"`
+	AckMaxRedeliveries int           `envconfig:"ACK_MAX_REDELIVERIES" default:"1"`
+
+	// Connection limits protect the pod from clients opening unlimited connections, 0 disables a limit.
+	// MaxConnectionsPerPod always rejects, the per-key and per-identity limits apply ConnectionLimitPolicy
+	MaxConnectionsPerPod      int `envconfig:"MAX_CONNECTIONS_PER_POD" default:"0"`
+	MaxConnectionsPerKey      int `envconfig:"MAX_CONNECTIONS_PER_KEY" default:"0"`
+	MaxConnectionsPerIdentity int `envconfig:"MAX_CONNECTIONS_PER_IDENTITY" default:"0"`
+	// ConnectionIdentityMetadataKey is the metadata entry identifying the client, e.g. user_id or sender_id
+	ConnectionIdentityMetadataKey string                `envconfig:"CONNECTION_IDENTITY_METADATA_KEY" default:"user_id"`
+	ConnectionLimitPolicy         ConnectionLimitPolicy `envconfig:"CONNECTION_LIMIT_POLICY" default:"reject"`
+	// ConnectionEvictedCloseCode is sent to the connections evicted under ConnectionLimitPolicyEvictOldest
+	ConnectionEvictedCloseCode int `envconfig:"CONNECTION_EVICTED_CLOSE_CODE" default:"4000"`
+
+	// MaxSubscriptionsPerConnection is the number of keys a connection can subscribe to on top of the key it was
+	// registered under, see WebSocketManager.Subscribe. 0 disables the limit
+	MaxSubscriptionsPerConnection int `envconfig:"MAX_SUBSCRIPTIONS_PER_CONNECTION" default:"20"`
+
+	// Rate limits are token buckets allowing the given number of messages per second on average, with bursts of up to
+	// the burst size (one second worth of messages when 0). A 0 rate disables a limit.
+	// The outbound limits apply to the frames sent to each connection and to the broadcasts of each key
+	OutboundRateLimitPerConnection      float64         `envconfig:"OUTBOUND_RATE_LIMIT_PER_CONNECTION" default:"0"`
+	OutboundRateLimitBurstPerConnection int             `envconfig:"OUTBOUND_RATE_LIMIT_BURST_PER_CONNECTION" default:"0"`
+	OutboundRateLimitPerKey             float64         `envconfig:"OUTBOUND_RATE_LIMIT_PER_KEY" default:"0"`
+	OutboundRateLimitBurstPerKey        int             `envconfig:"OUTBOUND_RATE_LIMIT_BURST_PER_KEY" default:"0"`
+	OutboundRateLimitPolicy             RateLimitPolicy `envconfig:"OUTBOUND_RATE_LIMIT_POLICY" default:"delay"`
+	// The inbound limit applies to the frames read from each connection, before they are dispatched
+	InboundRateLimitPerConnection      float64         `envconfig:"INBOUND_RATE_LIMIT_PER_CONNECTION" default:"0"`
+	InboundRateLimitBurstPerConnection int             `envconfig:"INBOUND_RATE_LIMIT_BURST_PER_CONNECTION" default:"0"`
+	InboundRateLimitPolicy             RateLimitPolicy `envconfig:"INBOUND_RATE_LIMIT_POLICY" default:"close"`
+
+	// Inbound handlers run off the read loop so that a slow handler does not hold up the pongs of its connection.
+	// InboundQueueSize is the number of frames read ahead of the handlers, reads wait once it is full.
+	// InboundHandlerTimeout bounds the context of each handler, 0 disables the timeout
+	InboundQueueSize      int           `envconfig:"INBOUND_QUEUE_SIZE" default:"64"`
+	InboundHandlerTimeout time.Duration `envconfig:"INBOUND_HANDLER_TIMEOUT" default:"10s"`
+
+	// MulticastParallelism is the number of keys a multicast broadcasts to at a time, 0 broadcasts to every key at once
+	MulticastParallelism int `envconfig:"MULTICAST_PARALLELISM" default:"16"`
+
+	// DrainWindow is how long Drain spreads the closing of the connections over on shutdown. The drain counts towards
+	// SHUTDOWN_TIMEOUT, keep it well below it and below the termination grace period of the pod (30s by default)
+	DrainWindow time.Duration `envconfig:"DRAIN_WINDOW" default:"15s"`
+	// DrainReadinessDelay is how long Drain waits after failing the websocket_drain health check before it hints and
+	// closes the connections, so that their reconnects don't land on this pod. Keep it above the readiness probe period
+	DrainReadinessDelay time.Duration `envconfig:"DRAIN_READINESS_DELAY" default:"5s"`
+	// DrainBatchSize is the number of connections closed together, 0 closes every connection in a single batch
+	DrainBatchSize            int  `envconfig:"DRAIN_BATCH_SIZE" default:"100"`
+	DrainReconnectHintEnabled bool `envconfig:"DRAIN_RECONNECT_HINT_ENABLED" default:"true"`
+
+	ManagerBackend ManagerBackend `envconfig:"WEBSOCKET_MANAGER_BACKEND" default:"local"`
+	// RedisPubSubChannelPrefix namespaces the Redis channels of the redis_pubsub backend
+	RedisPubSubChannelPrefix string `envconfig:"WEBSOCKET_REDIS_PUBSUB_CHANNEL_PREFIX" default:"websocket"`
+	// RedisPubSubReportTimeout bounds how long a broadcast waits for the delivery reports of the other pods
+	RedisPubSubReportTimeout time.Duration `envconfig:"WEBSOCKET_REDIS_PUBSUB_REPORT_TIMEOUT" default:"3s"`
 }
 
 func ProvideWebSocketConfig() (conf WebSocketConfig) {
@@ -6,16 +6,49 @@ import (
 	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 type WebSocketConnection struct {
-	conn        *websocket.Conn
-	Metadata    Metadata // Generic metadata for logging and identification
-	ConnectedAt time.Time
-	CloseChan   chan struct{}
-	writeMu     sync.Mutex // Protects concurrent writes to the websocket connection
-	writeWait   time.Duration
+	transport       Transport
+	ID              string   // Unique ID of the connection, used to unregister this connection only
+	Key             string   // The grouping key this connection is registered under
+	Route           string   // The path of the route that upgraded this connection, empty when unknown
+	Metadata        Metadata // Generic metadata for logging and identification
+	ConnectedAt     time.Time
+	CloseChan       chan struct{}
+	closeOnce       sync.Once
+	closeReason     DisconnectReason // Set once before CloseChan is closed
+	writeWait       time.Duration
+	inboundHandlers InboundHandlers
+	inboundQueue    chan []byte // Frames read from the connection, drained by dispatchInboundMessages
+	onDisconnect    OnDisconnectHook
+	onSubscribe     SubscriptionHook
+	onUnsubscribe   SubscriptionHook
+	keys            connectionKeys // Keys the connection is registered under, see WebSocketManager.Subscribe
+	replayedSeq     uint64         // Sequence number of the last replayed broadcast, live broadcasts up to it are skipped
+	acks            connectionAcks
+	envelope        bool // Frames are sent as an Envelope, see EnvelopeSubprotocol
+
+	// While resuming, the live broadcasts of Key are buffered until the replay is enqueued.
+	// Both are guarded by the broadcast lock of Key, see registerAndReplay
+	resuming     bool
+	resumeBuffer []sequencedFrame
+
+	// sendQueue is drained by writePump, the only goroutine writing data frames to conn
+	sendQueue         chan []byte
+	enqueueMu         sync.Mutex // Serializes enqueues so that drop_oldest evicts exactly one message per overflow
+	overflowPolicy    OverflowPolicy
+	overflowCloseCode int
+	closing           bool // Set under enqueueMu once an enqueue started closing the connection
+
+	// Token buckets of the per-connection rate limits, nil when disabled, see WebSocketConfig
+	outboundLimiter     *tokenBucket
+	outboundLimitPolicy RateLimitPolicy
+	inboundLimiter      *tokenBucket
+	inboundLimitPolicy  RateLimitPolicy
+	onRateLimited       func(limit MetricLabelValue, policy RateLimitPolicy)
 }
 
 type Metadata map[string][]string
@@ -30,44 +63,166 @@ func (m Metadata) ToString() string {
 }
 
 func NewWebSocketConnection(
+	key string,
 	conn *websocket.Conn,
 	metadata Metadata,
-	writeWait time.Duration) *WebSocketConnection {
+	cfg WebSocketConfig) *WebSocketConnection {
+	return NewConnection(key, newWebSocketTransport(conn, cfg.PongWait), metadata, cfg)
+}
+
+// NewConnection creates a connection writing its frames to the given transport, e.g. an SSETransport
+func NewConnection(
+	key string,
+	transport Transport,
+	metadata Metadata,
+	cfg WebSocketConfig) *WebSocketConnection {
 	c := WebSocketConnection{
-		conn:        conn,
-		Metadata:    metadata,
-		ConnectedAt: time.Now(),
-		CloseChan:   make(chan struct{}),
-		writeWait:   writeWait,
+		transport:         transport,
+		ID:                uuid.NewString(),
+		Key:               key,
+		Metadata:          metadata,
+		ConnectedAt:       time.Now(),
+		CloseChan:         make(chan struct{}),
+		writeWait:         cfg.WriteWait,
+		sendQueue:         make(chan []byte, cfg.SendQueueSize),
+		inboundQueue:      make(chan []byte, cfg.InboundQueueSize),
+		overflowPolicy:    cfg.SendQueueOverflowPolicy,
+		overflowCloseCode: cfg.SendQueueOverflowCloseCode,
+
+		outboundLimiter:     newTokenBucket(cfg.OutboundRateLimitPerConnection, cfg.OutboundRateLimitBurstPerConnection),
+		outboundLimitPolicy: cfg.outboundRateLimitPolicy(),
+		inboundLimiter:      newTokenBucket(cfg.InboundRateLimitPerConnection, cfg.InboundRateLimitBurstPerConnection),
+		inboundLimitPolicy:  cfg.inboundRateLimitPolicy(),
+		onRateLimited:       func(MetricLabelValue, RateLimitPolicy) {},
 	}
 
 	return &c
 }
 
-// Close closes the WebSocket connection and cleanup resources
+// Close closes the WebSocket connection and cleanup resources, closing an already closed connection is a no-op
 func (c *WebSocketConnection) Close() error {
-	close(c.CloseChan)
-	return c.conn.Close()
+	return c.closeWithReason(DisconnectReasonServerClosed)
+}
+
+// CloseWithCode sends a close frame with the given code and reason before closing the connection
+func (c *WebSocketConnection) CloseWithCode(code int, reason string) error {
+	return c.closeWithCode(code, reason, DisconnectReasonServerClosed)
+}
+
+// CloseReason returns why the connection was closed, it is only meaningful once CloseChan is closed
+func (c *WebSocketConnection) CloseReason() DisconnectReason {
+	return c.closeReason
+}
+
+func (c *WebSocketConnection) closeWithCode(code int, text string, reason DisconnectReason) error {
+	_ = c.transport.WriteClose(code, text, time.Now().Add(c.writeWait))
+	return c.closeWithReason(reason)
+}
+
+// closeWithReason closes the connection, only the reason of the first close is kept
+func (c *WebSocketConnection) closeWithReason(reason DisconnectReason) (err error) {
+	c.closeOnce.Do(
+		func() {
+			c.closeReason = reason
+			close(c.CloseChan)
+			err = c.transport.Close()
+		},
+	)
+	return
+}
+
+// Send enqueues a message to this connection only, e.g. to reply to an inbound frame
+func (c *WebSocketConnection) Send(data []byte) error {
+	_, err := c.enqueue(data)
+	return err
 }
 
-// send synchronously sends a message to the WebSocket connection
-// Returns an error if the connection is closed or if the write fails
-func (c *WebSocketConnection) send(data []byte) (err error) {
+// enqueue adds a message to the send queue without blocking, overflowed reports whether the queue was full.
+// Returns an error if the connection is closed or if the message could not be queued under the overflow policy
+func (c *WebSocketConnection) enqueue(data []byte) (overflowed bool, err error) {
+	c.enqueueMu.Lock()
+	defer c.enqueueMu.Unlock()
+
 	select {
 	case <-c.CloseChan:
-		return
+		return false, ErrConnectionClosed
 	default:
-		c.writeMu.Lock()
-		defer c.writeMu.Unlock()
+	}
+	if c.closing {
+		return false, ErrConnectionClosed
+	}
 
-		if err = c.conn.SetWriteDeadline(time.Now().Add(c.writeWait)); err != nil {
-			return
+	// Delayed messages wait for their token in writePump, enqueue never blocks
+	if c.outboundLimitPolicy != RateLimitPolicyDelay &&
+		!c.applyRateLimit(c.outboundLimiter, c.outboundLimitPolicy, RateLimitOutboundConnection) {
+		// Writing the close frame can take up to writeWait, the broadcasts holding enqueueMu don't wait for it
+		if c.outboundLimitPolicy == RateLimitPolicyClose {
+			c.closing = true
+			go c.closeRateLimited(RateLimitOutboundConnection)
 		}
+		return false, ErrRateLimited
+	}
+
+	select {
+	case c.sendQueue <- data:
+		return false, nil
+	default:
+	}
 
-		if err = c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	switch c.overflowPolicy {
+	case OverflowPolicyDropOldest:
+		// writePump may have drained the queue in the meantime, in which case there is nothing to drop
+		select {
+		case <-c.sendQueue:
+		default:
+		}
+		select {
+		case c.sendQueue <- data:
+			return true, nil
+		default:
+			return true, ErrSendQueueFull
+		}
+	case OverflowPolicyDisconnect:
+		slog.Warn(
+			"WebSocket send queue overflowed, disconnecting slow connection",
+			"key", c.Key,
+			"metadata", c.Metadata,
+		)
+		c.closing = true
+		go func() {
+			_ = c.closeWithCode(c.overflowCloseCode, "send queue overflow", DisconnectReasonSendQueueOverflow)
+		}()
+		return true, ErrSendQueueFull
+	default:
+		return true, ErrSendQueueFull
+	}
+}
+
+// writePump writes the queued messages to the transport until the connection is closed
+func (c *WebSocketConnection) writePump() {
+	for {
+		select {
+		case <-c.CloseChan:
 			return
+		case data := <-c.sendQueue:
+			// Dropped when delayed too long, the next iteration returns once the connection is closed
+			if c.outboundLimitPolicy == RateLimitPolicyDelay &&
+				!c.applyRateLimit(c.outboundLimiter, c.outboundLimitPolicy, RateLimitOutboundConnection) {
+				continue
+			}
+			if err := c.write(data); err != nil {
+				slog.Info(
+					"failed to write WebSocket message, closing connection",
+					"error", err,
+					"metadata", c.Metadata,
+				)
+				_ = c.closeWithReason(DisconnectReasonWriteError)
+				return
+			}
 		}
 	}
+}
 
-	return
+func (c *WebSocketConnection) write(data []byte) error {
+	return c.transport.WriteMessage(data, time.Now().Add(c.writeWait))
 }
@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ConnectionLimitPolicy decides what happens to a new connection once a per-key or per-identity limit is reached
+type ConnectionLimitPolicy string
+
+const (
+	// ConnectionLimitPolicyReject rejects the new connection, with HTTP 429 before the upgrade
+	ConnectionLimitPolicyReject ConnectionLimitPolicy = "reject"
+	// ConnectionLimitPolicyEvictOldest closes the oldest connections with ConnectionEvictedCloseCode to make room
+	ConnectionLimitPolicyEvictOldest ConnectionLimitPolicy = "evict_oldest"
+)
+
+// Decode implements envconfig.Decoder to reject unknown policies at startup
+func (p *ConnectionLimitPolicy) Decode(value string) error {
+	switch policy := ConnectionLimitPolicy(value); policy {
+	case ConnectionLimitPolicyReject, ConnectionLimitPolicyEvictOldest:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown connection limit policy %q", value)
+	}
+}
+
+// connectionLimiter counts the connections of the pod per key and per identity, see WebSocketConfig.MaxConnectionsPerKey.
+// Connections are kept in registration order so that the oldest ones are evicted first
+type connectionLimiter struct {
+	mu         sync.Mutex
+	total      int
+	byKey      map[string][]*WebSocketConnection
+	byIdentity map[string][]*WebSocketConnection
+
+	maxPerPod           int
+	maxPerKey           int
+	maxPerIdentity      int
+	identityMetadataKey string
+	policy              ConnectionLimitPolicy
+}
+
+func newConnectionLimiter(cfg WebSocketConfig) *connectionLimiter {
+	return &connectionLimiter{
+		byKey:               make(map[string][]*WebSocketConnection),
+		byIdentity:          make(map[string][]*WebSocketConnection),
+		maxPerPod:           cfg.MaxConnectionsPerPod,
+		maxPerKey:           cfg.MaxConnectionsPerKey,
+		maxPerIdentity:      cfg.MaxConnectionsPerIdentity,
+		identityMetadataKey: cfg.ConnectionIdentityMetadataKey,
+		policy:              cfg.ConnectionLimitPolicy,
+	}
+}
+
+// enabled is false when no limit is configured, connections are then not counted at all
+func (l *connectionLimiter) enabled() bool {
+	return l.maxPerPod > 0 || l.maxPerKey > 0 || l.maxPerIdentity > 0
+}
+
+// identityOf returns the identity of the connection metadata, empty when the metadata doesn't carry one
+func (l *connectionLimiter) identityOf(metadata Metadata) string {
+	if values := metadata[l.identityMetadataKey]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// check reports whether a new connection with the key and metadata would be admitted, without counting it
+func (l *connectionLimiter) check(key string, metadata Metadata) error {
+	if !l.enabled() {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.plan(key, l.identityOf(metadata))
+	return err
+}
+
+// admit counts the connection, it returns the connections to evict to make room for it under
+// ConnectionLimitPolicyEvictOldest, or ErrConnectionLimitReached when the connection must be rejected
+func (l *connectionLimiter) admit(c *WebSocketConnection) (evicted []*WebSocketConnection, err error) {
+	if !l.enabled() {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	identity := l.identityOf(c.Metadata)
+	if evicted, err = l.plan(c.Key, identity); err != nil {
+		return nil, err
+	}
+
+	for _, victim := range evicted {
+		l.untrack(victim)
+	}
+
+	l.total++
+	l.byKey[c.Key] = append(l.byKey[c.Key], c)
+	if identity != "" {
+		l.byIdentity[identity] = append(l.byIdentity[identity], c)
+	}
+	return evicted, nil
+}
+
+// release stops counting the connection, releasing a connection that is not counted is a no-op
+func (l *connectionLimiter) release(c *WebSocketConnection) {
+	if !l.enabled() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.untrack(c)
+}
+
+// plan returns the connections to evict for a new connection of the key and identity, must be called with mu held
+func (l *connectionLimiter) plan(key string, identity string) (evicted []*WebSocketConnection, err error) {
+	overLimit := func(conns []*WebSocketConnection, limit int, scope string) error {
+		if limit <= 0 {
+			return nil
+		}
+
+		// Connections already planned for eviction free their slot
+		remaining := slices.DeleteFunc(
+			slices.Clone(conns), func(c *WebSocketConnection) bool {
+				return slices.Contains(evicted, c)
+			},
+		)
+		if len(remaining) < limit {
+			return nil
+		}
+
+		if l.policy != ConnectionLimitPolicyEvictOldest {
+			return fmt.Errorf("%w: %d connections per %s", ErrConnectionLimitReached, limit, scope)
+		}
+		evicted = append(evicted, remaining[:len(remaining)-limit+1]...)
+		return nil
+	}
+
+	if err = overLimit(l.byKey[key], l.maxPerKey, "key"); err != nil {
+		return nil, err
+	}
+	if identity != "" {
+		if err = overLimit(l.byIdentity[identity], l.maxPerIdentity, "identity"); err != nil {
+			return nil, err
+		}
+	}
+
+	// The pod cap protects the process, it never evicts connections of other keys
+	if l.maxPerPod > 0 && l.total-len(evicted) >= l.maxPerPod {
+		return nil, fmt.Errorf("%w: %d connections per pod", ErrConnectionLimitReached, l.maxPerPod)
+	}
+	return evicted, nil
+}
+
+// untrack must be called with mu held
+func (l *connectionLimiter) untrack(c *WebSocketConnection) {
+	conns := l.byKey[c.Key]
+	i := slices.Index(conns, c)
+	if i < 0 {
+		return
+	}
+
+	l.total--
+	if conns = slices.Delete(conns, i, i+1); len(conns) == 0 {
+		delete(l.byKey, c.Key)
+	} else {
+		l.byKey[c.Key] = conns
+	}
+
+	identity := l.identityOf(c.Metadata)
+	if identity == "" {
+		return
+	}
+	conns = slices.DeleteFunc(l.byIdentity[identity], func(other *WebSocketConnection) bool { return other == c })
+	if len(conns) == 0 {
+		delete(l.byIdentity, identity)
+	} else {
+		l.byIdentity[identity] = conns
+	}
+}
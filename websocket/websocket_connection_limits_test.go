@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionLimiter(t *testing.T) {
+	newConnection := func(key string, userID string) *WebSocketConnection {
+		return &WebSocketConnection{ID: key + "/" + userID, Key: key, Metadata: Metadata{"user_id": {userID}}}
+	}
+
+	t.Run(
+		"disabled without limits", func(t *testing.T) {
+			l := newConnectionLimiter(WebSocketConfig{ConnectionIdentityMetadataKey: "user_id"})
+			for range 3 {
+				evicted, err := l.admit(newConnection("key", "user-1"))
+				assert.NoError(t, err)
+				assert.Empty(t, evicted)
+			}
+			assert.Zero(t, l.total)
+		},
+	)
+
+	t.Run(
+		"reject per key and per identity", func(t *testing.T) {
+			l := newConnectionLimiter(
+				WebSocketConfig{
+					MaxConnectionsPerKey:          2,
+					MaxConnectionsPerIdentity:     1,
+					ConnectionIdentityMetadataKey: "user_id",
+					ConnectionLimitPolicy:         ConnectionLimitPolicyReject,
+				},
+			)
+
+			first := newConnection("key", "user-1")
+			_, err := l.admit(first)
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, l.check("other-key", Metadata{"user_id": {"user-1"}}), ErrConnectionLimitReached)
+			assert.NoError(t, l.check("key", Metadata{"user_id": {"user-2"}}))
+
+			_, err = l.admit(newConnection("key", "user-2"))
+			require.NoError(t, err)
+			assert.ErrorIs(t, l.check("key", Metadata{"user_id": {"user-3"}}), ErrConnectionLimitReached)
+
+			l.release(first)
+			l.release(first)
+			assert.Equal(t, 1, l.total, "releasing twice should only count once")
+			assert.NoError(t, l.check("key", Metadata{"user_id": {"user-1"}}))
+		},
+	)
+
+	t.Run(
+		"evict the oldest connections", func(t *testing.T) {
+			l := newConnectionLimiter(
+				WebSocketConfig{
+					MaxConnectionsPerKey:          2,
+					MaxConnectionsPerIdentity:     2,
+					ConnectionIdentityMetadataKey: "user_id",
+					ConnectionLimitPolicy:         ConnectionLimitPolicyEvictOldest,
+				},
+			)
+
+			oldest := newConnection("key-1", "user-1")
+			_, _ = l.admit(oldest)
+			_, _ = l.admit(newConnection("key-2", "user-1"))
+
+			// The oldest connection of the identity makes room, it also frees a slot of key-1
+			assert.NoError(t, l.check("key-1", Metadata{"user_id": {"user-1"}}))
+			evicted, err := l.admit(newConnection("key-1", "user-1"))
+			require.NoError(t, err)
+			assert.Equal(t, []*WebSocketConnection{oldest}, evicted)
+			assert.Equal(t, 2, l.total)
+		},
+	)
+
+	t.Run(
+		"pod cap always rejects", func(t *testing.T) {
+			l := newConnectionLimiter(
+				WebSocketConfig{
+					MaxConnectionsPerPod:          1,
+					ConnectionIdentityMetadataKey: "user_id",
+					ConnectionLimitPolicy:         ConnectionLimitPolicyEvictOldest,
+				},
+			)
+
+			_, err := l.admit(newConnection("key-1", "user-1"))
+			require.NoError(t, err)
+
+			evicted, err := l.admit(newConnection("key-2", "user-2"))
+			assert.ErrorIs(t, err, ErrConnectionLimitReached)
+			assert.Empty(t, evicted)
+		},
+	)
+}
+
+func TestWebSocketManagerConnectionLimits(t *testing.T) {
+	cfg := WebSocketConfig{
+		PingInterval:                  time.Minute,
+		PongWait:                      time.Minute,
+		WriteWait:                     time.Second,
+		SendQueueSize:                 8,
+		MaxConnectionsPerIdentity:     1,
+		ConnectionIdentityMetadataKey: "user_id",
+		ConnectionEvictedCloseCode:    4000,
+	}
+	metadata := Metadata{"user_id": {"user-1"}}
+
+	t.Run(
+		"evict_oldest closes the previous connection with the eviction close code", func(t *testing.T) {
+			cfg.ConnectionLimitPolicy = ConnectionLimitPolicyEvictOldest
+			m := ProvideDefaultWebSocketManager(cfg)
+			dial := newTestConnDialer(t)
+
+			oldServerConn, oldClientConn := dial()
+			disconnected := make(chan DisconnectReason, 1)
+			m.RegisterConnection(
+				"key", metadata, oldServerConn,
+				WithOnDisconnect(func(c *WebSocketConnection, reason DisconnectReason) { disconnected <- reason }),
+			)
+
+			newServerConn, newClientConn := dial()
+			m.RegisterConnection("key", metadata, newServerConn)
+
+			_, _, err := oldClientConn.ReadMessage()
+			var closeErr *websocket.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			assert.Equal(t, 4000, closeErr.Code)
+			assert.Equal(t, DisconnectReasonEvicted, <-disconnected)
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(`{}`))
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.DeliveredCount)
+
+			_, data, err := newClientConn.ReadMessage()
+			require.NoError(t, err)
+			assert.JSONEq(t, `{}`, string(data))
+		},
+	)
+
+	t.Run(
+		"reject closes connections registered over the limit", func(t *testing.T) {
+			cfg.ConnectionLimitPolicy = ConnectionLimitPolicyReject
+			m := ProvideDefaultWebSocketManager(cfg)
+			dial := newTestConnDialer(t)
+
+			serverConn, _ := dial()
+			m.RegisterConnection("key", metadata, serverConn)
+			assert.ErrorIs(t, m.AdmitConnection("key", metadata), ErrConnectionLimitReached)
+
+			// A connection that passed AdmitConnection concurrently is closed right after the upgrade, without the hooks
+			serverConn, clientConn := dial()
+			var hooked atomic.Int64
+			c := m.RegisterConnection(
+				"key", metadata, serverConn,
+				WithOnConnect(func(*WebSocketConnection) { hooked.Add(1) }),
+				WithOnDisconnect(func(*WebSocketConnection, DisconnectReason) { hooked.Add(1) }),
+			)
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonConnectionLimit, c.CloseReason())
+			assert.Zero(t, hooked.Load())
+			assert.Len(t, m.ListConnections("key"), 1)
+
+			_, _, err := clientConn.ReadMessage()
+			var closeErr *websocket.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			assert.Equal(t, websocket.CloseTryAgainLater, closeErr.Code)
+		},
+	)
+}
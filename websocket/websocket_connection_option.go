@@ -0,0 +1,94 @@
+package websocket
+
+type ConnectionOptionalParams struct {
+	InboundHandlers InboundHandlers
+	OnConnect       OnConnectHook
+	OnDisconnect    OnDisconnectHook
+	Resume          bool
+	LastSeq         uint64
+	Route           string
+	Authorize       SubscriptionAuthorizer
+	OnSubscribe     SubscriptionHook
+	OnUnsubscribe   SubscriptionHook
+	Envelope        bool
+}
+
+type ConnectionOptions func(optionalParam *ConnectionOptionalParams)
+
+// WithInboundHandlers dispatches the frames received from the connection to the given handlers
+func WithInboundHandlers(handlers InboundHandlers) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.InboundHandlers = handlers
+	}
+}
+
+// WithOnConnect calls the hook after the connection is registered, e.g. to track presence
+func WithOnConnect(hook OnConnectHook) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.OnConnect = hook
+	}
+}
+
+// WithOnDisconnect calls the hook once the connection is closed and removed from the manager, only for the connections
+// that got OnConnect
+func WithOnDisconnect(hook OnDisconnectHook) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.OnDisconnect = hook
+	}
+}
+
+// WithResumeFrom replays the buffered broadcasts of the key with a sequence number greater than lastSeq
+// to the connection before any live broadcast, see ReplayStore. Only the key the connection is registered under is
+// resumed, the broadcasts to the keys it subscribes to afterwards carry no "seq" and are not replayed
+func WithResumeFrom(lastSeq uint64) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.Resume = true
+		optionalParam.LastSeq = lastSeq
+	}
+}
+
+// WithRoute records the path of the route that upgraded the connection, the metrics are labelled by it
+func WithRoute(route string) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.Route = route
+	}
+}
+
+// WithSubscriptionAuthorizer lets the client subscribe to additional keys with control frames, see SubscribeFrameType.
+// Every subscribe frame is authorized by authorize, subscriptions are disabled without an authorizer
+func WithSubscriptionAuthorizer(authorize SubscriptionAuthorizer) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.Authorize = authorize
+	}
+}
+
+// WithOnSubscribe calls the hook once the connection subscribed to an additional key
+func WithOnSubscribe(hook SubscriptionHook) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.OnSubscribe = hook
+	}
+}
+
+// WithOnUnsubscribe calls the hook once the connection unsubscribed from an additional key,
+// including the keys it was still subscribed to when it is closed, before the OnDisconnect hook
+func WithOnUnsubscribe(hook SubscriptionHook) ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.OnUnsubscribe = hook
+	}
+}
+
+// WithEnvelope sends every frame to the connection as an Envelope. WebSocket connections upgraded with the
+// EnvelopeSubprotocol get it automatically, other transports opt in with it
+func WithEnvelope() ConnectionOptions {
+	return func(optionalParam *ConnectionOptionalParams) {
+		optionalParam.Envelope = true
+	}
+}
+
+func bindConnectionOptions(opts ...ConnectionOptions) ConnectionOptionalParams {
+	optionalParam := ConnectionOptionalParams{}
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+	return optionalParam
+}
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestConnDialer starts an in-process WebSocket server, dial returns both ends of a new real connection
+func newTestConnDialer(t *testing.T) (dial func() (server *websocket.Conn, client *websocket.Conn)) {
+	serverConns := make(chan *websocket.Conn)
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("failed to upgrade test connection: %v", err)
+					return
+				}
+				serverConns <- conn
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	return func() (*websocket.Conn, *websocket.Conn) {
+		client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = client.Close() })
+
+		return <-serverConns, client
+	}
+}
+
+// newTestConnPair returns both ends of a real WebSocket connection served by an in-process server
+func newTestConnPair(t *testing.T) (server *websocket.Conn, client *websocket.Conn) {
+	return newTestConnDialer(t)()
+}
+
+func TestWebSocketConnectionSendQueue(t *testing.T) {
+	cfg := WebSocketConfig{
+		WriteWait:                  time.Second,
+		SendQueueSize:              2,
+		SendQueueOverflowCloseCode: websocket.CloseTryAgainLater,
+	}
+
+	t.Run(
+		"drop_oldest keeps the newest messages", func(t *testing.T) {
+			serverConn, _ := newTestConnPair(t)
+			cfg.SendQueueOverflowPolicy = OverflowPolicyDropOldest
+			c := NewWebSocketConnection("key", serverConn, Metadata{}, cfg)
+
+			for _, msg := range []string{"1", "2"} {
+				overflowed, err := c.enqueue([]byte(msg))
+				assert.False(t, overflowed)
+				assert.NoError(t, err)
+			}
+
+			overflowed, err := c.enqueue([]byte("3"))
+			assert.True(t, overflowed)
+			assert.NoError(t, err)
+			assert.Equal(t, "2", string(<-c.sendQueue))
+			assert.Equal(t, "3", string(<-c.sendQueue))
+		},
+	)
+
+	t.Run(
+		"drop_newest rejects the new message", func(t *testing.T) {
+			serverConn, _ := newTestConnPair(t)
+			cfg.SendQueueOverflowPolicy = OverflowPolicyDropNewest
+			c := NewWebSocketConnection("key", serverConn, Metadata{}, cfg)
+
+			_, _ = c.enqueue([]byte("1"))
+			_, _ = c.enqueue([]byte("2"))
+
+			overflowed, err := c.enqueue([]byte("3"))
+			assert.True(t, overflowed)
+			assert.ErrorIs(t, err, ErrSendQueueFull)
+			assert.Equal(t, "1", string(<-c.sendQueue))
+			assert.Equal(t, "2", string(<-c.sendQueue))
+		},
+	)
+
+	t.Run(
+		"disconnect closes the connection with the configured close code", func(t *testing.T) {
+			serverConn, clientConn := newTestConnPair(t)
+			cfg.SendQueueOverflowPolicy = OverflowPolicyDisconnect
+			c := NewWebSocketConnection("key", serverConn, Metadata{}, cfg)
+
+			_, _ = c.enqueue([]byte("1"))
+			_, _ = c.enqueue([]byte("2"))
+
+			overflowed, err := c.enqueue([]byte("3"))
+			assert.True(t, overflowed)
+			assert.ErrorIs(t, err, ErrSendQueueFull)
+
+			_, err = c.enqueue([]byte("4"))
+			assert.ErrorIs(t, err, ErrConnectionClosed)
+
+			_, _, err = clientConn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+		},
+	)
+
+	t.Run(
+		"disconnect does not wait for the close frame of a slow client", func(t *testing.T) {
+			cfg.SendQueueOverflowPolicy = OverflowPolicyDisconnect
+			transport := &blockingCloseTransport{release: make(chan struct{})}
+			c := NewConnection("key", transport, Metadata{}, cfg)
+			t.Cleanup(func() { close(transport.release) })
+
+			_, _ = c.enqueue([]byte("1"))
+			_, _ = c.enqueue([]byte("2"))
+
+			enqueued := make(chan error, 1)
+			go func() {
+				_, err := c.enqueue([]byte("3"))
+				enqueued <- err
+			}()
+			select {
+			case err := <-enqueued:
+				assert.ErrorIs(t, err, ErrSendQueueFull)
+			case <-time.After(time.Second):
+				require.FailNow(t, "enqueue waited for the close frame")
+			}
+
+			_, err := c.enqueue([]byte("4"))
+			assert.ErrorIs(t, err, ErrConnectionClosed)
+		},
+	)
+
+	t.Run(
+		"writePump writes queued messages in order", func(t *testing.T) {
+			serverConn, clientConn := newTestConnPair(t)
+			cfg.SendQueueOverflowPolicy = OverflowPolicyDisconnect
+			c := NewWebSocketConnection("key", serverConn, Metadata{}, cfg)
+			go c.writePump()
+			t.Cleanup(func() { _ = c.Close() })
+
+			for _, msg := range []string{"1", "2", "3", "4"} {
+				require.NoError(t, c.Send([]byte(msg)))
+				_, data, err := clientConn.ReadMessage()
+				require.NoError(t, err)
+				assert.Equal(t, msg, string(data))
+			}
+		},
+	)
+}
+
+// blockingCloseTransport is a transport whose close frame is only written once release is closed
+type blockingCloseTransport struct {
+	release chan struct{}
+}
+
+func (t *blockingCloseTransport) ReadMessage() ([]byte, error) {
+	<-t.release
+	return nil, io.EOF
+}
+
+func (t *blockingCloseTransport) WriteMessage([]byte, time.Time) error { return nil }
+
+func (t *blockingCloseTransport) WriteClose(int, string, time.Time) error {
+	<-t.release
+	return nil
+}
+
+func (t *blockingCloseTransport) Ping(time.Time) error { return nil }
+
+func (t *blockingCloseTransport) Close() error { return nil }
+
+func (t *blockingCloseTransport) Bidirectional() bool { return true }
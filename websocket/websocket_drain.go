@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReconnectFrameType is the frame type of the hint sent to every connection when the pod starts draining:
+// {"type": "reconnect", "payload": {"reason": "server_draining", "within_ms": 30000}}.
+// Clients should reconnect at a random time within within_ms, the load balancer routes them to another pod
+const ReconnectFrameType = "reconnect"
+
+// ReconnectReasonServerDraining is the reason of the reconnect hint sent by Drain
+const ReconnectReasonServerDraining = "server_draining"
+
+// ReconnectPayload is the payload of a reconnect hint frame
+type ReconnectPayload struct {
+	Reason   string `json:"reason"`
+	WithinMs int64  `json:"within_ms"`
+}
+
+// OutboundFrame is a control frame sent by the server to the connections without Envelope, it has the same
+// format as InboundFrame
+type OutboundFrame[T any] struct {
+	Type    string `json:"type"`
+	Payload T      `json:"payload"`
+}
+
+func (m *webSocketManager) IsDraining() bool {
+	return m.draining.Load()
+}
+
+func (m *webSocketManager) Drain(ctx context.Context) {
+	if !m.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	// Connections registered concurrently are either in the snapshot or close themselves, see register
+	if !waitFor(m.DrainReadinessDelay, ctx.Done()) {
+		slog.Warn("WebSocket drain interrupted, closing the connections", "error", ctx.Err())
+		closeDrainedConnections(m.connections.all())
+		return
+	}
+
+	conns := m.connections.all()
+	slog.Info("draining WebSocket connections", "connections", len(conns), "window", m.DrainWindow)
+
+	if m.DrainReconnectHintEnabled {
+		m.sendReconnectHint(conns)
+	}
+
+	// Batches are closed in random order, each at a random time within its slot of the window
+	rand.Shuffle(len(conns), func(i, j int) { conns[i], conns[j] = conns[j], conns[i] })
+	batches := chunkConnections(conns, m.DrainBatchSize)
+	if len(batches) == 0 {
+		return
+	}
+
+	slot := m.DrainWindow / time.Duration(len(batches))
+	startedAt := time.Now()
+	for i, batch := range batches {
+		closeAt := startedAt.Add(time.Duration(i) * slot)
+		if slot > 0 {
+			closeAt = closeAt.Add(rand.N(slot))
+		}
+
+		timer := time.NewTimer(time.Until(closeAt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Warn("WebSocket drain interrupted, closing the remaining connections", "error", ctx.Err())
+			for _, remaining := range batches[i:] {
+				closeDrainedConnections(remaining)
+			}
+			return
+		}
+		closeDrainedConnections(batch)
+	}
+
+	slog.Info("drained WebSocket connections", "connections", len(conns), "took", time.Since(startedAt))
+}
+
+func (m *webSocketManager) sendReconnectHint(conns []*WebSocketConnection) {
+	hint := ReconnectPayload{
+		Reason:   ReconnectReasonServerDraining,
+		WithinMs: m.DrainWindow.Milliseconds(),
+	}
+
+	for _, c := range conns {
+		data, err := c.encodeFrame(ReconnectFrameType, hint)
+		if err != nil {
+			// This should never happen
+			slog.Error("failed to marshal reconnect hint", "error", err)
+			return
+		}
+		_ = c.Send(data)
+	}
+}
+
+func closeDrainedConnections(batch []*WebSocketConnection) {
+	for _, c := range batch {
+		_ = c.closeWithCode(websocket.CloseGoingAway, "server shutting down", DisconnectReasonDrained)
+	}
+}
+
+func chunkConnections(conns []*WebSocketConnection, size int) (batches [][]*WebSocketConnection) {
+	if size <= 0 {
+		size = len(conns)
+	}
+	for start := 0; start < len(conns); start += size {
+		batches = append(batches, conns[start:min(start+size, len(conns))])
+	}
+	return
+}
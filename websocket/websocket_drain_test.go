@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketManagerDrain(t *testing.T) {
+	cfg := WebSocketConfig{
+		PingInterval:              time.Minute,
+		PongWait:                  time.Minute,
+		WriteWait:                 time.Second,
+		SendQueueSize:             8,
+		DrainWindow:               300 * time.Millisecond,
+		DrainBatchSize:            1,
+		DrainReconnectHintEnabled: true,
+	}
+
+	registerClients := func(t *testing.T, m WebSocketManager, count int) (clients []*websocket.Conn) {
+		dial := newTestConnDialer(t)
+		for range count {
+			serverConn, clientConn := dial()
+			m.RegisterConnection("key", Metadata{}, serverConn)
+			clients = append(clients, clientConn)
+		}
+		return
+	}
+
+	t.Run(
+		"hints then closes connections in batches over the window", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			clients := registerClients(t, m, 3)
+
+			startedAt := time.Now()
+			m.Drain(context.Background())
+			assert.Less(t, time.Since(startedAt), cfg.DrainWindow+200*time.Millisecond)
+			assert.True(t, m.IsDraining())
+			assert.ErrorIs(t, m.AdmitConnection("key", Metadata{}), ErrDraining)
+
+			for _, client := range clients {
+				_, data, err := client.ReadMessage()
+				require.NoError(t, err)
+				assert.JSONEq(t, `{"type":"reconnect","payload":{"reason":"server_draining","within_ms":300}}`, string(data))
+
+				_, _, err = client.ReadMessage()
+				var closeErr *websocket.CloseError
+				require.ErrorAs(t, err, &closeErr)
+				assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+			}
+		},
+	)
+
+	t.Run(
+		"closes the remaining connections once the context is done", func(t *testing.T) {
+			cfg := cfg
+			cfg.DrainWindow = time.Minute
+			cfg.DrainReconnectHintEnabled = false
+			m := ProvideDefaultWebSocketManager(cfg)
+			clients := registerClients(t, m, 3)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			m.Drain(ctx)
+
+			for _, client := range clients {
+				_, _, err := client.ReadMessage()
+				var closeErr *websocket.CloseError
+				require.ErrorAs(t, err, &closeErr)
+				assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+			}
+		},
+	)
+
+	t.Run(
+		"waits for the readiness delay before closing connections", func(t *testing.T) {
+			cfg := cfg
+			cfg.DrainReadinessDelay = 200 * time.Millisecond
+			cfg.DrainWindow = 0
+			cfg.DrainReconnectHintEnabled = false
+			m := ProvideDefaultWebSocketManager(cfg)
+			clients := registerClients(t, m, 1)
+
+			drained := make(chan struct{})
+			go func() {
+				m.Drain(context.Background())
+				close(drained)
+			}()
+			require.Eventually(t, m.IsDraining, time.Second, time.Millisecond)
+			select {
+			case <-drained:
+				t.Fatal("connections closed before the readiness delay")
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			<-drained
+			_, _, err := clients[0].ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+		},
+	)
+
+	t.Run(
+		"connections added after the drain snapshot close themselves", func(t *testing.T) {
+			m := newWebSocketManager(cfg, newNoopWebSocketMetric())
+			m.Drain(context.Background())
+
+			// The connection passed the draining check of RegisterTransport before Drain started
+			serverConn, _ := newTestConnPair(t)
+			c := NewWebSocketConnection("key", serverConn, Metadata{}, cfg)
+			require.True(t, m.register(c, ConnectionOptionalParams{}))
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonDrained, c.CloseReason())
+		},
+	)
+
+	t.Run(
+		"connections registered while draining are closed", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			m.Drain(context.Background())
+
+			serverConn, _ := newTestConnPair(t)
+			c := m.RegisterConnection("key", Metadata{}, serverConn)
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonDrained, c.CloseReason())
+		},
+	)
+}
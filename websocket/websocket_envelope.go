@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"cmp"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+)
+
+const (
+	// EnvelopeSubprotocol is the WebSocket subprotocol negotiating the Envelope wire format. Connections upgraded with
+	// it receive every frame as an Envelope, the others keep receiving the bare payloads of the broadcasts
+	EnvelopeSubprotocol = "envelope.v1"
+	// EnvelopeVersion is the version of the Envelope wire format, a breaking change comes with a new subprotocol
+	EnvelopeVersion = 1
+	// DefaultMessageType is the type of the broadcasts sent without WithMessageType
+	DefaultMessageType = "message"
+)
+
+// Envelope is the versioned wire format of the frames of enveloped connections, see EnvelopeSubprotocol.
+// The ID of a broadcast is kept across replays and ack redeliveries so that clients can dedupe the frames they
+// already received. Seq is only set by a ReplayStore and AckID in ack mode.
+// Clients send their frames in the same format, the inbound handlers are selected by Type, see InboundFrame
+type Envelope struct {
+	Version   int             `json:"v"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"ts"`
+	Seq       uint64          `json:"seq,omitempty"`
+	AckID     string          `json:"ack_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope wraps an encoded JSON payload in an Envelope of the current version
+func NewEnvelope(id string, messageType string, payload []byte) Envelope {
+	return Envelope{
+		Version:   EnvelopeVersion,
+		ID:        id,
+		Type:      messageType,
+		Timestamp: time.Now().UTC(),
+		Payload:   payload,
+	}
+}
+
+// isEnvelope reports whether the envelope was decoded from a frame wrapped by this version
+func (e Envelope) isEnvelope() bool {
+	return e.Version == EnvelopeVersion && e.ID != "" && e.Payload != nil
+}
+
+// wrapBroadcast wraps the payload of a broadcast in an Envelope before it is sequenced and kept for replay.
+// Payloads that are not valid JSON can't be wrapped, they are sent as they are to every connection
+func wrapBroadcast(message []byte, optionalParam BroadcastOptionalParams) []byte {
+	if !json.Valid(message) {
+		return message
+	}
+
+	envelope := NewEnvelope(
+		cmp.Or(optionalParam.MessageID, uuid.NewString()),
+		cmp.Or(optionalParam.MessageType, DefaultMessageType),
+		message,
+	)
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		// This should never happen
+		slog.Error("failed to marshal broadcast envelope", "error", err)
+		return message
+	}
+	return data
+}
+
+// broadcastFrames are the frames of a broadcast in both wire formats, computed once and shared by its connections
+type broadcastFrames struct {
+	// legacy is the payload stamped with its "seq", as sent to the connections without envelope
+	legacy   []byte
+	envelope []byte
+	// unsequenced returns the frames without "seq" of the connections subscribed to the key of the broadcast,
+	// nil when the frames are not sequenced. See forConnection
+	unsequenced func() broadcastFrames
+}
+
+// newBroadcastFrames derives the frames of a broadcast wrapped by wrapBroadcast and stamped by the ReplayStore.
+// Broadcasts left unwrapped by wrapBroadcast, i.e. invalid JSON, are sent as they are in both wire formats
+func newBroadcastFrames(message []byte) broadcastFrames {
+	var envelope Envelope
+	if err := json.Unmarshal(message, &envelope); err == nil && envelope.isEnvelope() {
+		frames := broadcastFrames{legacy: envelope.Payload, envelope: message}
+		if envelope.Seq != 0 {
+			if stamped, ok := stampSequence(frames.legacy, envelope.Seq); ok {
+				frames.legacy = stamped
+			}
+			frames.unsequenced = sync.OnceValue(
+				func() broadcastFrames {
+					return unsequencedFrames(envelope, message)
+				},
+			)
+		}
+		return frames
+	}
+
+	return broadcastFrames{legacy: message, envelope: message}
+}
+
+// unsequencedFrames returns the frames of a sequenced envelope without its sequence number
+func unsequencedFrames(envelope Envelope, message []byte) broadcastFrames {
+	envelope.Seq = 0
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		// This should never happen
+		slog.Error("failed to marshal broadcast envelope", "error", err)
+		data = message
+	}
+	return broadcastFrames{legacy: envelope.Payload, envelope: data}
+}
+
+// forConnection returns the frame of a broadcast to the key in the wire format of the connection.
+// Sequence numbers are per key, only the connections registered under the key get the sequenced frames so that
+// the "seq" they resume from is never one of a key they subscribed to, see WithResumeFrom
+func (f broadcastFrames) forConnection(c *WebSocketConnection, key string) []byte {
+	if key != c.Key && f.unsequenced != nil {
+		return f.unsequenced().forConnection(c, key)
+	}
+	if c.envelope {
+		return f.envelope
+	}
+	return f.legacy
+}
+
+// encodeFrame encodes a control frame of the server in the wire format of the connection,
+// an Envelope for enveloped connections and an OutboundFrame for the others
+func (c *WebSocketConnection) encodeFrame(frameType string, payload any) ([]byte, error) {
+	if !c.envelope {
+		return json.Marshal(OutboundFrame[any]{Type: frameType, Payload: payload})
+	}
+
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(NewEnvelope(uuid.NewString(), frameType, rawPayload))
+}
@@ -0,0 +1,215 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEnvelopeConnPair returns both ends of a real WebSocket connection negotiated with the EnvelopeSubprotocol
+func newEnvelopeConnPair(t *testing.T) (server *websocket.Conn, client *websocket.Conn) {
+	serverConns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				upgrader := websocket.Upgrader{Subprotocols: []string{EnvelopeSubprotocol}}
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("failed to upgrade test connection: %v", err)
+					return
+				}
+				serverConns <- conn
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{EnvelopeSubprotocol}}
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return <-serverConns, client
+}
+
+func readEnvelope(t *testing.T, clientConn *websocket.Conn) (envelope Envelope) {
+	t.Helper()
+
+	_, data, err := clientConn.ReadMessage()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &envelope))
+	return envelope
+}
+
+func TestWebSocketManagerEnvelope(t *testing.T) {
+	cfg := WebSocketConfig{
+		PingInterval:     time.Minute,
+		PongWait:         time.Minute,
+		WriteWait:        time.Second,
+		SendQueueSize:    8,
+		ReplayBufferSize: 10,
+		ReplayBufferTTL:  time.Minute,
+	}
+	ctx := context.Background()
+
+	t.Run(
+		"enveloped and legacy connections receive the same broadcast in their format", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, envelopeConn := newEnvelopeConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+			serverConn, legacyConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(
+				ctx, "key", []byte(`{"n":1}`), WithMessageID("message-1"), WithMessageType("chat_message"),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.DeliveredCount)
+
+			envelope := readEnvelope(t, envelopeConn)
+			assert.Equal(t, EnvelopeVersion, envelope.Version)
+			assert.Equal(t, "message-1", envelope.ID)
+			assert.Equal(t, "chat_message", envelope.Type)
+			assert.NotZero(t, envelope.Seq)
+			assert.WithinDuration(t, time.Now(), envelope.Timestamp, time.Second)
+			assert.JSONEq(t, `{"n":1}`, string(envelope.Payload))
+
+			_, data, err := legacyConn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, envelope.Seq, SequenceOf(data))
+			assert.JSONEq(t, `{"seq":`+strconv.FormatUint(envelope.Seq, 10)+`,"n":1}`, string(data))
+		},
+	)
+
+	t.Run(
+		"replayed envelopes keep their ID", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, envelopeConn := newEnvelopeConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+
+			_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"n":1}`))
+			require.NoError(t, err)
+			live := readEnvelope(t, envelopeConn)
+			assert.Equal(t, DefaultMessageType, live.Type)
+			assert.NotEmpty(t, live.ID)
+
+			serverConn, envelopeConn = newEnvelopeConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn, WithResumeFrom(live.Seq-1))
+			replayed := readEnvelope(t, envelopeConn)
+			assert.Equal(t, live.ID, replayed.ID)
+			assert.Equal(t, live.Seq, replayed.Seq)
+		},
+	)
+
+	t.Run(
+		"control frames and inbound frames use the envelope", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, envelopeConn := newEnvelopeConnPair(t)
+			inboundIDs := make(chan string, 1)
+			m.RegisterConnection(
+				"key", Metadata{}, serverConn,
+				WithSubscriptionAuthorizer(
+					func(context.Context, *WebSocketConnection, SubscriptionRequest) error { return nil },
+				),
+				WithInboundHandlers(
+					InboundHandlers{
+						"echo": NewInboundHandler(
+							func(_ context.Context, msg InboundMessage[json.RawMessage]) error {
+								inboundIDs <- msg.ID
+								return nil
+							},
+						),
+					},
+				),
+			)
+
+			writeFrame(t, envelopeConn, `{"v":1,"id":"frame-1","type":"subscribe","payload":{"key":"other"}}`)
+			reply := readEnvelope(t, envelopeConn)
+			assert.Equal(t, SubscribedFrameType, reply.Type)
+			assert.NotEmpty(t, reply.ID)
+			assert.JSONEq(t, `{"key":"other"}`, string(reply.Payload))
+
+			writeFrame(t, envelopeConn, `{"v":1,"id":"frame-2","type":"echo","ts":"2026-01-01T00:00:00Z","payload":{}}`)
+			assert.Equal(t, "frame-2", <-inboundIDs)
+		},
+	)
+
+	t.Run(
+		"connections opt in to the envelope on other transports", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			transport := NewLongPollTransport(time.Minute, 8)
+			m.RegisterTransport("key", Metadata{}, transport, WithEnvelope())
+
+			_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"n":1}`), WithMessageID("message-1"))
+			require.NoError(t, err)
+			batch, err := transport.Poll(ctx, 0, time.Second)
+			require.NoError(t, err)
+			require.Len(t, batch.Frames, 1)
+
+			var envelope Envelope
+			require.NoError(t, json.Unmarshal(batch.Frames[0], &envelope))
+			assert.Equal(t, "message-1", envelope.ID)
+		},
+	)
+}
+
+func TestNewBroadcastFrames(t *testing.T) {
+	t.Run(
+		"connections subscribed to the key get the frames without seq", func(t *testing.T) {
+			wrapped, ok := stampSequence(wrapBroadcast([]byte(`{"n":1}`), BroadcastOptionalParams{}), 5)
+			require.True(t, ok)
+			frames := newBroadcastFrames(wrapped)
+			legacy := &WebSocketConnection{Key: "primary"}
+			enveloped := &WebSocketConnection{Key: "primary", envelope: true}
+
+			assert.Equal(t, `{"seq":5,"n":1}`, string(frames.forConnection(legacy, "primary")))
+			assert.Equal(t, uint64(5), SequenceOf(frames.forConnection(enveloped, "primary")))
+
+			assert.Equal(t, `{"n":1}`, string(frames.forConnection(legacy, "subscribed")))
+			var envelope Envelope
+			require.NoError(t, json.Unmarshal(frames.forConnection(enveloped, "subscribed"), &envelope))
+			assert.Zero(t, envelope.Seq)
+			assert.JSONEq(t, `{"n":1}`, string(envelope.Payload))
+		},
+	)
+
+	t.Run(
+		"payloads that are not JSON are sent as they are", func(t *testing.T) {
+			frames := newBroadcastFrames(wrapBroadcast([]byte("not json"), BroadcastOptionalParams{}))
+			assert.Equal(t, "not json", string(frames.legacy))
+			assert.Equal(t, "not json", string(frames.envelope))
+		},
+	)
+
+	t.Run(
+		"payloads that are not objects are not stamped for legacy connections", func(t *testing.T) {
+			wrapped, ok := stampSequence(wrapBroadcast([]byte(`"text"`), BroadcastOptionalParams{}), 3)
+			require.True(t, ok)
+			frames := newBroadcastFrames(wrapped)
+			assert.Equal(t, `"text"`, string(frames.legacy))
+			assert.Equal(t, uint64(3), SequenceOf(frames.envelope))
+		},
+	)
+}
+
+func TestInboundEnvelopeVersion(t *testing.T) {
+	handlers := InboundHandlers{
+		"echo": func(context.Context, *WebSocketConnection, json.RawMessage) error { return nil },
+	}
+	c := &WebSocketConnection{}
+
+	assert.NoError(t, handlers.Dispatch(context.Background(), c, []byte(`{"v":1,"id":"a","type":"echo","payload":{}}`)))
+	assert.ErrorIs(
+		t, handlers.Dispatch(context.Background(), c, []byte(`{"v":2,"id":"a","type":"echo","payload":{}}`)),
+		ErrUnsupportedVersion,
+	)
+}
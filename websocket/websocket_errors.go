@@ -0,0 +1,32 @@
+package websocket
+
+import "errors"
+
+var (
+	ErrConnectionClosed = errors.New("connection closed")
+	ErrSendQueueFull    = errors.New("send queue full")
+	ErrRateLimited      = errors.New("rate limit exceeded")
+
+	ErrConnectionLimitReached = errors.New("connection limit reached")
+	ErrDraining               = errors.New("server is draining connections")
+
+	ErrInvalidSubscriptionKey = errors.New("invalid subscription key")
+	ErrTooManySubscriptions   = errors.New("too many subscriptions")
+	ErrPrimaryKeyUnsubscribe  = errors.New("cannot unsubscribe from the key the connection was registered under")
+
+	ErrInvalidInboundFrame   = errors.New("invalid inbound frame")
+	ErrInvalidInboundPayload = errors.New("invalid inbound payload")
+	ErrUnknownInboundType    = errors.New("unknown inbound frame type")
+	ErrUnsupportedVersion    = errors.New("unsupported envelope version")
+
+	ErrUnacknowledged = errors.New("message not acknowledged by all connections")
+
+	ErrInvalidPollOffset = errors.New("poll offset is past the buffered frames")
+	ErrLongPollExpired   = errors.New("long-poll connection expired without poll")
+
+	ErrMissingRedisClient         = errors.New("the redis_pubsub backend requires a Redis client")
+	ErrUnsupportedBroadcastFilter = errors.New("connection filters are not supported by the redis_pubsub backend")
+
+	ErrDeliveryReportTimeout = errors.New("timed out waiting for delivery reports")
+	ErrRemoteBroadcastFailed = errors.New("broadcast failed on a remote pod")
+)
@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goccy/go-json"
+)
+
+// InboundFrame is the JSON frame sent by clients, Type selects which handler the payload is dispatched to.
+// Enveloped clients send an Envelope, whose ID and version are decoded along with it
+type InboundFrame struct {
+	Version int             `json:"v,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// InboundMessage is a decoded inbound payload along with the connection it was received from
+type InboundMessage[T any] struct {
+	Key        string
+	Metadata   Metadata
+	Connection *WebSocketConnection
+	// ID is the ID of the Envelope of the frame, empty for the frames sent without envelope
+	ID      string
+	Payload T
+}
+
+// inboundFrameIDKey is the context key of the ID of the inbound frame being dispatched
+type inboundFrameIDKey struct{}
+
+// InboundFrameID returns the ID of the Envelope of the inbound frame being handled, empty when it has none
+func InboundFrameID(ctx context.Context) string {
+	id, _ := ctx.Value(inboundFrameIDKey{}).(string)
+	return id
+}
+
+// InboundHandler handles the raw payload of an inbound frame, use NewInboundHandler to get a typed handler.
+// Handlers run off the read loop, one frame of a connection at a time, and ctx is done after INBOUND_HANDLER_TIMEOUT
+type InboundHandler func(ctx context.Context, c *WebSocketConnection, payload json.RawMessage) error
+
+// InboundHandlers maps an inbound frame type to its handler
+type InboundHandlers map[string]InboundHandler
+
+// NewInboundHandler creates an InboundHandler that decodes the frame payload into T before calling handle
+func NewInboundHandler[T any](handle func(ctx context.Context, msg InboundMessage[T]) error) InboundHandler {
+	return func(ctx context.Context, c *WebSocketConnection, payload json.RawMessage) error {
+		var value T
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidInboundPayload, err)
+		}
+
+		return handle(
+			ctx, InboundMessage[T]{
+				Key:        c.Key,
+				Metadata:   c.Metadata,
+				Connection: c,
+				ID:         InboundFrameID(ctx),
+				Payload:    value,
+			},
+		)
+	}
+}
+
+// Dispatch decodes a raw client frame and routes it to the handler registered for its type
+func (h InboundHandlers) Dispatch(ctx context.Context, c *WebSocketConnection, data []byte) error {
+	var frame InboundFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInboundFrame, err)
+	}
+	if frame.Version > EnvelopeVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, frame.Version)
+	}
+	if frame.ID != "" {
+		ctx = context.WithValue(ctx, inboundFrameIDKey{}, frame.ID)
+	}
+
+	handler, ok := h[frame.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownInboundType, frame.Type)
+	}
+
+	return handler(ctx, c, frame.Payload)
+}
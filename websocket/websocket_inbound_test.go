@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type typingIndicator struct {
+	IsTyping bool `json:"is_typing"`
+}
+
+func TestInboundHandlersDispatch(t *testing.T) {
+	metadata := Metadata{"user_id": {"user-1"}}
+	conn := NewWebSocketConnection("stream-1", nil, metadata, WebSocketConfig{})
+
+	var received []InboundMessage[typingIndicator]
+	handlers := InboundHandlers{
+		"typing": NewInboundHandler(
+			func(ctx context.Context, msg InboundMessage[typingIndicator]) error {
+				received = append(received, msg)
+				return nil
+			},
+		),
+		"failing": func(ctx context.Context, c *WebSocketConnection, payload json.RawMessage) error {
+			return errors.New("handler failed")
+		},
+	}
+
+	t.Run(
+		"decodes typed payload with connection key and metadata", func(t *testing.T) {
+			received = nil
+			err := handlers.Dispatch(context.Background(), conn, []byte(`{"type":"typing","payload":{"is_typing":true}}`))
+
+			assert.NoError(t, err)
+			assert.Len(t, received, 1)
+			assert.Equal(t, "stream-1", received[0].Key)
+			assert.Equal(t, metadata, received[0].Metadata)
+			assert.Same(t, conn, received[0].Connection)
+			assert.True(t, received[0].Payload.IsTyping)
+		},
+	)
+
+	t.Run(
+		"rejects frames that are not JSON", func(t *testing.T) {
+			err := handlers.Dispatch(context.Background(), conn, []byte(`not-json`))
+
+			assert.ErrorIs(t, err, ErrInvalidInboundFrame)
+		},
+	)
+
+	t.Run(
+		"rejects unknown frame types", func(t *testing.T) {
+			err := handlers.Dispatch(context.Background(), conn, []byte(`{"type":"unknown","payload":{}}`))
+
+			assert.ErrorIs(t, err, ErrUnknownInboundType)
+		},
+	)
+
+	t.Run(
+		"rejects payloads that do not match the handler type", func(t *testing.T) {
+			received = nil
+			err := handlers.Dispatch(context.Background(), conn, []byte(`{"type":"typing","payload":{"is_typing":"yes"}}`))
+
+			assert.ErrorIs(t, err, ErrInvalidInboundPayload)
+			assert.Empty(t, received)
+		},
+	)
+
+	t.Run(
+		"returns handler errors", func(t *testing.T) {
+			err := handlers.Dispatch(context.Background(), conn, []byte(`{"type":"failing","payload":{}}`))
+
+			assert.EqualError(t, err, "handler failed")
+		},
+	)
+}
+
+func TestWebSocketManagerInboundDispatch(t *testing.T) {
+	t.Run(
+		"a slow handler does not hold up the pongs", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(
+				WebSocketConfig{
+					PingInterval:          20 * time.Millisecond,
+					PongWait:              60 * time.Millisecond,
+					WriteWait:             time.Second,
+					SendQueueSize:         8,
+					InboundQueueSize:      8,
+					InboundHandlerTimeout: 150 * time.Millisecond,
+				},
+			)
+			t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+			serverConn, clientConn := newTestConnPair(t)
+
+			handlerErr := make(chan error, 1)
+			c := m.RegisterConnection(
+				"key", Metadata{}, serverConn, WithInboundHandlers(
+					InboundHandlers{
+						"slow": func(ctx context.Context, _ *WebSocketConnection, _ json.RawMessage) error {
+							<-ctx.Done()
+							handlerErr <- ctx.Err()
+							return ctx.Err()
+						},
+					},
+				),
+			)
+
+			// The client answers the pings while it reads
+			go func() {
+				for {
+					if _, _, err := clientConn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+			writeFrame(t, clientConn, `{"type":"slow","payload":{}}`)
+
+			// The handler outlives PongWait and is bounded by InboundHandlerTimeout
+			select {
+			case err := <-handlerErr:
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			case <-time.After(time.Second):
+				t.Fatal("the handler was not canceled")
+			}
+			require.Never(
+				t, func() bool {
+					select {
+					case <-c.CloseChan:
+						return true
+					default:
+						return false
+					}
+				}, 100*time.Millisecond, 10*time.Millisecond,
+			)
+		},
+	)
+}
@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeyConnections is the number of connections registered under a key
+type KeyConnections struct {
+	Key             string `json:"key"`
+	ConnectionCount int    `json:"connections"`
+}
+
+// ConnectionInfo describes a registered connection for introspection
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	Key         string    `json:"key"`
+	Keys        []string  `json:"keys,omitempty"` // Every key the connection is registered under, Key first
+	Route       string    `json:"route,omitempty"`
+	Metadata    Metadata  `json:"metadata"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+func (c *WebSocketConnection) info() ConnectionInfo {
+	return ConnectionInfo{
+		ID:          c.ID,
+		Key:         c.Key,
+		Keys:        c.Keys(),
+		Route:       c.Route,
+		Metadata:    c.Metadata,
+		ConnectedAt: c.ConnectedAt,
+	}
+}
+
+func (m *webSocketManager) ListKeys() []KeyConnections {
+	counts := m.connections.counts()
+
+	keys := make([]KeyConnections, 0, len(counts))
+	for key, count := range counts {
+		keys = append(keys, KeyConnections{Key: key, ConnectionCount: count})
+	}
+	slices.SortFunc(keys, func(a, b KeyConnections) int { return strings.Compare(a.Key, b.Key) })
+	return keys
+}
+
+func (m *webSocketManager) ListConnections(key string) []ConnectionInfo {
+	conns := m.connections.snapshot(key)
+
+	infos := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, c.info())
+	}
+	slices.SortFunc(infos, func(a, b ConnectionInfo) int { return a.ConnectedAt.Compare(b.ConnectedAt) })
+	return infos
+}
+
+func (m *webSocketManager) CloseConnections(key string, predicate ConnectionPredicate, code int, reason string) int {
+	removed := m.connections.removeMatching(key, predicate)
+	for _, c := range removed {
+		_ = c.closeWithCode(code, reason, DisconnectReasonForceClosed)
+	}
+	return len(removed)
+}
@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketManagerIntrospection(t *testing.T) {
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{
+			PingInterval:  time.Minute,
+			PongWait:      time.Minute,
+			WriteWait:     time.Second,
+			SendQueueSize: 8,
+		},
+	)
+	dial := newTestConnDialer(t)
+
+	serverConn, firstClientConn := dial()
+	first := m.RegisterConnection("key-b", Metadata{"user_id": {"user-1"}}, serverConn)
+	serverConn, _ = dial()
+	second := m.RegisterConnection("key-b", Metadata{"user_id": {"user-2"}}, serverConn)
+	serverConn, _ = dial()
+	m.RegisterConnection("key-a", Metadata{"user_id": {"user-3"}}, serverConn)
+
+	assert.Equal(
+		t, []KeyConnections{{Key: "key-a", ConnectionCount: 1}, {Key: "key-b", ConnectionCount: 2}}, m.ListKeys(),
+	)
+
+	conns := m.ListConnections("key-b")
+	require.Len(t, conns, 2)
+	assert.Equal(t, first.ID, conns[0].ID, "connections should be listed oldest first")
+	assert.Equal(t, Metadata{"user_id": {"user-1"}}, conns[0].Metadata)
+	assert.Equal(t, first.ConnectedAt, conns[0].ConnectedAt)
+	assert.Equal(t, second.ID, conns[1].ID)
+	assert.Empty(t, m.ListConnections("unknown"))
+
+	closed := m.CloseConnections(
+		"key-b", func(c *WebSocketConnection) bool { return c.ID == first.ID }, websocket.ClosePolicyViolation,
+		"kicked",
+	)
+	assert.Equal(t, 1, closed)
+	assert.Equal(t, DisconnectReasonForceClosed, first.CloseReason())
+
+	_, _, err := firstClientConn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, "kicked", closeErr.Text)
+
+	assert.Equal(
+		t, []KeyConnections{{Key: "key-a", ConnectionCount: 1}, {Key: "key-b", ConnectionCount: 1}}, m.ListKeys(),
+	)
+}
@@ -0,0 +1,40 @@
+package websocket
+
+// DisconnectReason describes why a WebSocket connection was removed from the manager
+type DisconnectReason string
+
+const (
+	// DisconnectReasonReadError is used when reading from the client fails, including a client initiated close
+	DisconnectReasonReadError DisconnectReason = "read_error"
+	// DisconnectReasonPingFailure is used when the heartbeat ping could not be sent
+	DisconnectReasonPingFailure DisconnectReason = "ping_failure"
+	// DisconnectReasonWriteError is used when writing a queued message fails
+	DisconnectReasonWriteError DisconnectReason = "write_error"
+	// DisconnectReasonSendQueueOverflow is used when a slow connection is disconnected, see OverflowPolicyDisconnect
+	DisconnectReasonSendQueueOverflow DisconnectReason = "send_queue_overflow"
+	// DisconnectReasonRateLimited is used when the connection exceeded a rate limit under RateLimitPolicyClose
+	DisconnectReasonRateLimited DisconnectReason = "rate_limited"
+	// DisconnectReasonUnregistered is used when the connection is removed by UnregisterConnection or UnregisterConnectionByID
+	DisconnectReasonUnregistered DisconnectReason = "unregistered"
+	// DisconnectReasonEvicted is used when the connection is evicted by a newer one, see ConnectionLimitPolicyEvictOldest
+	DisconnectReasonEvicted DisconnectReason = "evicted"
+	// DisconnectReasonConnectionLimit is used when a connection exceeding the connection limits is closed right after
+	// the upgrade, which happens when concurrent connections pass AdmitConnection at the same time
+	DisconnectReasonConnectionLimit DisconnectReason = "connection_limit"
+	// DisconnectReasonJoinFailed is used when a new connection is closed because the pod could not join its key,
+	// e.g. when the redis_pubsub backend could not subscribe to the broadcast channel of the key
+	DisconnectReasonJoinFailed DisconnectReason = "join_failed"
+	// DisconnectReasonForceClosed is used when the connection is closed through CloseConnections, e.g. by an operator
+	DisconnectReasonForceClosed DisconnectReason = "force_closed"
+	// DisconnectReasonDrained is used when the connection is closed by Drain while the pod shuts down
+	DisconnectReasonDrained DisconnectReason = "drained"
+	// DisconnectReasonServerClosed is used when the connection is closed by the server, e.g. through CloseAll
+	DisconnectReasonServerClosed DisconnectReason = "server_closed"
+)
+
+type (
+	// OnConnectHook is called once a connection is registered to the manager
+	OnConnectHook func(c *WebSocketConnection)
+	// OnDisconnectHook is called exactly once after a registered connection is closed and removed from the manager
+	OnDisconnectHook func(c *WebSocketConnection, reason DisconnectReason)
+)
@@ -0,0 +1,188 @@
+package websocket
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// LongPollBatch is the result of a poll, Offset is the offset of the first frame.
+// Frames are kept until a poll acknowledges them by asking for a greater offset, so that a lost response is repeated
+type LongPollBatch struct {
+	Offset uint64
+	Frames [][]byte
+	// Closed is set once the server closed the connection and every frame was returned
+	Closed *ClosePayload
+}
+
+// NextOffset is the offset the next poll should ask for to acknowledge the frames of this batch
+func (b LongPollBatch) NextOffset() uint64 {
+	return b.Offset + uint64(len(b.Frames))
+}
+
+// LongPollTransport buffers the frames of a connection between the polls of a client that can use neither WebSocket
+// nor SSE. The connection is closed when its buffer overflows, or when no poll happened for idleTimeout
+type LongPollTransport struct {
+	ID          string
+	idleTimeout time.Duration
+	bufferSize  int
+
+	mu      sync.Mutex
+	frames  [][]byte
+	offset  uint64        // Offset of frames[0]
+	arrived chan struct{} // Closed and replaced every time frames are written or the server closes the connection
+	polls   int           // Number of polls in flight, the connection doesn't expire while polled
+	closed  *ClosePayload
+
+	touched   chan struct{} // Resets the idle timer, see ReadMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewLongPollTransport(idleTimeout time.Duration, bufferSize int) *LongPollTransport {
+	return &LongPollTransport{
+		ID:          uuid.NewString(),
+		idleTimeout: idleTimeout,
+		bufferSize:  bufferSize,
+		arrived:     make(chan struct{}),
+		touched:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+// Done is closed once the transport is closed, the remaining frames can still be polled
+func (t *LongPollTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Poll acknowledges the frames before offset and returns the following ones, waiting up to wait for new frames.
+// Returns ErrInvalidPollOffset when offset is past the frames written so far
+func (t *LongPollTransport) Poll(ctx context.Context, offset uint64, wait time.Duration) (LongPollBatch, error) {
+	t.touch(1)
+	defer t.touch(-1)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		t.mu.Lock()
+		if offset > t.offset+uint64(len(t.frames)) || offset < t.offset {
+			t.mu.Unlock()
+			return LongPollBatch{}, ErrInvalidPollOffset
+		}
+		t.frames = t.frames[offset-t.offset:]
+		t.offset = offset
+
+		if len(t.frames) > 0 || t.closed != nil {
+			batch := LongPollBatch{Offset: t.offset, Frames: slices.Clone(t.frames)}
+			if len(t.frames) == 0 {
+				batch.Closed = t.closed
+			}
+			t.mu.Unlock()
+			return batch, nil
+		}
+		arrived := t.arrived
+		t.mu.Unlock()
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			return LongPollBatch{Offset: offset}, nil
+		case <-ctx.Done():
+			return LongPollBatch{Offset: offset}, ctx.Err()
+		}
+	}
+}
+
+// touch tracks the polls in flight and resets the idle timer
+func (t *LongPollTransport) touch(delta int) {
+	t.mu.Lock()
+	t.polls += delta
+	t.mu.Unlock()
+
+	select {
+	case t.touched <- struct{}{}:
+	default:
+	}
+}
+
+// ReadMessage returns once no poll happened for idleTimeout, long-poll clients can't send frames
+func (t *LongPollTransport) ReadMessage() ([]byte, error) {
+	timer := time.NewTimer(t.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-t.touched:
+			timer.Reset(t.idleTimeout)
+		case <-timer.C:
+			t.mu.Lock()
+			polled := t.polls > 0
+			t.mu.Unlock()
+			if !polled {
+				return nil, ErrLongPollExpired
+			}
+			timer.Reset(t.idleTimeout)
+		case <-t.done:
+			return nil, ErrConnectionClosed
+		}
+	}
+}
+
+// WriteMessage buffers the frame until it is polled, it fails once bufferSize frames are waiting for a poll
+func (t *LongPollTransport) WriteMessage(data []byte, _ time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed != nil {
+		return ErrConnectionClosed
+	}
+	if len(t.frames) >= t.bufferSize {
+		return ErrSendQueueFull
+	}
+	t.frames = append(t.frames, data)
+	t.notifyArrived()
+	return nil
+}
+
+// WriteClose is returned to the client by the poll following its last frame
+func (t *LongPollTransport) WriteClose(code int, text string, _ time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed == nil {
+		t.closed = &ClosePayload{Code: code, Reason: text}
+		t.notifyArrived()
+	}
+	return nil
+}
+
+// Ping is a no-op, the polls of the client keep the connection alive
+func (t *LongPollTransport) Ping(time.Time) error {
+	return nil
+}
+
+func (t *LongPollTransport) Close() error {
+	t.closeOnce.Do(
+		func() {
+			// The client learns about the close from the next poll even when the server did not send a close reason
+			_ = t.WriteClose(websocket.CloseNormalClosure, "", time.Time{})
+			close(t.done)
+		},
+	)
+	return nil
+}
+
+func (t *LongPollTransport) Bidirectional() bool {
+	return false
+}
+
+// notifyArrived wakes up the waiting polls, must be called with mu held
+func (t *LongPollTransport) notifyArrived() {
+	close(t.arrived)
+	t.arrived = make(chan struct{})
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLongPollTransport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run(
+		"frames are kept until a poll acknowledges them", func(t *testing.T) {
+			transport := NewLongPollTransport(time.Minute, 8)
+			require.NoError(t, transport.WriteMessage([]byte(`{"n":1}`), time.Time{}))
+			require.NoError(t, transport.WriteMessage([]byte(`{"n":2}`), time.Time{}))
+
+			batch, err := transport.Poll(ctx, 0, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte(`{"n":1}`), []byte(`{"n":2}`)}, batch.Frames)
+			assert.Equal(t, uint64(2), batch.NextOffset())
+
+			// The response was lost, polling the same offset returns the same frames
+			batch, err = transport.Poll(ctx, 0, time.Second)
+			require.NoError(t, err)
+			assert.Len(t, batch.Frames, 2)
+
+			_, err = transport.Poll(ctx, 3, time.Second)
+			assert.ErrorIs(t, err, ErrInvalidPollOffset)
+		},
+	)
+
+	t.Run(
+		"polls wait for the next frame", func(t *testing.T) {
+			transport := NewLongPollTransport(time.Minute, 8)
+
+			batch, err := transport.Poll(ctx, 0, 10*time.Millisecond)
+			require.NoError(t, err)
+			assert.Empty(t, batch.Frames)
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				_ = transport.WriteMessage([]byte(`{}`), time.Time{})
+			}()
+			batch, err = transport.Poll(ctx, 0, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte(`{}`)}, batch.Frames)
+		},
+	)
+
+	t.Run(
+		"the close is polled after the last frame", func(t *testing.T) {
+			transport := NewLongPollTransport(time.Minute, 1)
+			require.NoError(t, transport.WriteMessage([]byte(`{}`), time.Time{}))
+			assert.ErrorIs(t, transport.WriteMessage([]byte(`{}`), time.Time{}), ErrSendQueueFull)
+
+			require.NoError(t, transport.WriteClose(1001, "server shutting down", time.Time{}))
+			require.NoError(t, transport.Close())
+
+			batch, err := transport.Poll(ctx, 0, time.Second)
+			require.NoError(t, err)
+			assert.Len(t, batch.Frames, 1)
+			assert.Nil(t, batch.Closed)
+
+			batch, err = transport.Poll(ctx, batch.NextOffset(), time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, &ClosePayload{Code: 1001, Reason: "server shutting down"}, batch.Closed)
+		},
+	)
+
+	t.Run(
+		"expires without poll", func(t *testing.T) {
+			transport := NewLongPollTransport(20*time.Millisecond, 8)
+
+			_, err := transport.ReadMessage()
+			assert.ErrorIs(t, err, ErrLongPollExpired)
+		},
+	)
+}
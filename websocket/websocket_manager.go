@@ -2,8 +2,11 @@ package websocket
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/domesama/concurrent"
@@ -14,186 +17,609 @@ type WebSocketManager interface {
 	// RegisterConnection adds a new WebSocket connection to the manager
 	// key: The grouping key (e.g., stream_id, room_id, user_id)
 	// metadata: Connection metadata for logging and identification
-	RegisterConnection(key string, metadata Metadata, conn *websocket.Conn) *WebSocketConnection
+	// opts: Optional behaviors of the connection, e.g. WithInboundHandlers
+	// Connections exceeding the connection limits are closed right away, or make room by evicting older connections.
+	// Connections closed right away, e.g. while draining, are not registered: neither OnConnect nor OnDisconnect runs
+	RegisterConnection(key string, metadata Metadata, conn *websocket.Conn, opts ...ConnectionOptions) *WebSocketConnection
+
+	// RegisterTransport adds a connection writing to another transport than a WebSocket, e.g. an SSETransport.
+	// It shares the registry of the WebSocket connections, broadcasts reach both transparently
+	RegisterTransport(key string, metadata Metadata, transport Transport, opts ...ConnectionOptions) *WebSocketConnection
+
+	// AdmitConnection returns ErrConnectionLimitReached when a new connection with the key and metadata would be rejected,
+	// or ErrDraining once Drain was called. It is checked before the upgrade so that rejected clients get an HTTP error
+	AdmitConnection(key string, metadata Metadata) error
 
 	// UnregisterConnection removes WebSocket connections matching the predicate for the given key
+	// Connections are also removed automatically once they are closed, e.g. on read, ping or write failure
 	UnregisterConnection(key string, predicate ConnectionPredicate)
 
-	// BroadcastPayloadToLocalSubscribers sends a payload to all connections under the given key
-	// Returns the number of connections the message was delivered to and any errors encountered
-	BroadcastPayloadToLocalSubscribers(ctx context.Context, key string, message []byte) (deliveredCount int, err error)
+	// UnregisterConnectionByID removes the WebSocket connection with the given ID (see WebSocketConnection.ID) from the given key
+	UnregisterConnectionByID(key string, connectionID string)
+
+	// BroadcastPayloadToLocalSubscribers enqueues a payload to the send queue of all connections under the given key
+	// JSON payloads are wrapped in an Envelope and, when the replay buffer is enabled, stamped with the next sequence
+	// number of the key and kept for replay. Enveloped connections receive the Envelope, the others the payload with
+	// a "seq" field when it is a sequenced JSON object
+	// opts: Optional filters of the connections, e.g. WithMetadataExclude, or the ID and type of the Envelope, e.g.
+	// WithMessageID. Broadcasts filtered by metadata are only replayed to the resuming connections they select,
+	// the ones filtered by WithConnectionFilter are not replayed. The connections they skip see a gap in "seq"
+	// Returns the delivery counts of the broadcast and any errors encountered
+	BroadcastPayloadToLocalSubscribers(ctx context.Context, key string, message []byte, opts ...BroadcastOptions) (
+		result BroadcastResult, err error,
+	)
+
+	// MulticastPayloadToLocalSubscribers broadcasts a payload to the connections of each of the keys, e.g. to notify
+	// a list of users, with up to WebSocketConfig.MulticastParallelism broadcasts at a time. Each key is broadcast to
+	// as with BroadcastPayloadToLocalSubscribers, with its own sequence numbers.
+	// Returns the result of each key, the error joins the errors of the keys
+	MulticastPayloadToLocalSubscribers(ctx context.Context, keys []string, message []byte, opts ...BroadcastOptions) (
+		result MulticastResult, err error,
+	)
+
+	// Subscribe registers the connection under an additional key, broadcasts to the key are then delivered to it.
+	// Subscribing to a key twice is a no-op, returns ErrTooManySubscriptions above
+	// WebSocketConfig.MaxSubscriptionsPerConnection and ErrConnectionClosed once the connection is closed.
+	// Clients subscribe with control frames when the connection has a SubscriptionAuthorizer, see SubscribeFrameType
+	Subscribe(c *WebSocketConnection, key string) error
+
+	// Unsubscribe removes the connection from an additional key, unsubscribing from a key the connection is not
+	// subscribed to is a no-op. Returns ErrPrimaryKeyUnsubscribe for the key the connection was registered under
+	Unsubscribe(c *WebSocketConnection, key string) error
 
 	// CloseAll closes all WebSocket connections with the given close code and reason
 	CloseAll(code int, reason string)
+
+	// Drain stops accepting connections and, once WebSocketConfig.DrainReadinessDelay elapsed, sends a reconnect hint
+	// to every connection and closes them in jittered batches over WebSocketConfig.DrainWindow.
+	// It returns once every connection is closed, or closes the rest once ctx is done
+	Drain(ctx context.Context)
+
+	// IsDraining reports whether Drain was called, the pod should then be marked as not ready
+	IsDraining() bool
+
+	// ListKeys returns the keys with connections on this pod and their connection counts, sorted by key
+	ListKeys() []KeyConnections
+
+	// ListConnections returns the connections of this pod registered under the key, oldest first
+	ListConnections(key string) []ConnectionInfo
+
+	// CloseConnections closes the connections of the key matching the predicate with the given close code and reason,
+	// returns the number of closed connections
+	CloseConnections(key string, predicate ConnectionPredicate, code int, reason string) int
+}
+
+// BroadcastResult summarizes a broadcast, a message counts as delivered once it is enqueued to a connection's send queue,
+// or once the connection acknowledged it in ack mode
+type BroadcastResult struct {
+	// DeliveredCount is the number of connections the message was enqueued to
+	DeliveredCount int `json:"delivered"`
+	// OverflowedCount is the number of connections whose send queue was full, see OverflowPolicy
+	OverflowedCount int `json:"overflowed"`
+
+	// The counts below are only set in ack mode, see WebSocketConfig.AckModeEnabled
+	// AckedCount is the number of connections that acknowledged the message, DeliveredCount only includes them
+	AckedCount int `json:"acked,omitempty"`
+	// UnackedCount is the number of connections that did not acknowledge the message after all redeliveries
+	UnackedCount int `json:"unacked,omitempty"`
+	// RedeliveredCount is the number of frames redelivered because their ack timed out
+	RedeliveredCount int `json:"redelivered,omitempty"`
+
+	// Connections reports the delivery to each selected connection, on every pod with the redis_pubsub backend
+	Connections []ConnectionDeliveryReport `json:"connections,omitempty"`
+}
+
+// ConnectionDeliveryReport is the outcome of a broadcast for one connection
+type ConnectionDeliveryReport struct {
+	ConnectionID string   `json:"connection_id"`
+	Metadata     Metadata `json:"metadata"`
+	// Err is why the message was not delivered, e.g. ErrSendQueueFull or ErrUnacknowledged.
+	// Only Error is set on the reports of other pods
+	Err   error  `json:"-"`
+	Error string `json:"error,omitempty"`
+	// Latency is the time from the broadcast to the enqueue of the message, or to its ack in ack mode.
+	// Other pods measure it from the reception of the broadcast
+	Latency time.Duration `json:"latency_ns"`
+}
+
+func newConnectionDeliveryReport(c *WebSocketConnection, startedAt time.Time, err error) ConnectionDeliveryReport {
+	report := ConnectionDeliveryReport{
+		ConnectionID: c.ID,
+		Metadata:     c.Metadata,
+		Err:          err,
+		Latency:      time.Since(startedAt),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
 }
 
 type webSocketManager struct {
-	connections sync.Map // map[key][]WebSocketConnection
+	connections *connectionRegistry
+	replay      ReplayStore // nil when the replay buffer is disabled
+	limiter     *connectionLimiter
+	metric      *WebSocketMetric
+	draining    atomic.Bool
+	observer    keyObserver // nil when nothing needs to know which keys have local connections
+	// keyRateLimiter holds the outbound rate limit of each key, nil when disabled
+	keyRateLimiter *keyRateLimiter
 	WebSocketConfig
 }
 
+// keyObserver is notified every time a connection joins or leaves a key, including the keys it subscribed to.
+// A connection failing to join its key is not registered under it, connectionLeft is only called for joined keys
+type keyObserver interface {
+	connectionJoined(key string) error
+	connectionLeft(key string)
+}
+
+// ProvideDefaultWebSocketManager provides a local WebSocketManager without metrics, see ProvideWebSocketManager
 func ProvideDefaultWebSocketManager(cfg WebSocketConfig) WebSocketManager {
-	return &webSocketManager{
-		connections:     sync.Map{},
+	return newWebSocketManager(cfg, newNoopWebSocketMetric())
+}
+
+func newWebSocketManager(cfg WebSocketConfig, metric *WebSocketMetric) *webSocketManager {
+	m := &webSocketManager{
+		connections:     newConnectionRegistry(),
+		limiter:         newConnectionLimiter(cfg),
+		keyRateLimiter:  newKeyRateLimiter(cfg.OutboundRateLimitPerKey, cfg.OutboundRateLimitBurstPerKey),
+		metric:          metric,
 		WebSocketConfig: cfg,
 	}
+	m.connections.keysChanged = metric.keysChanged
+	if cfg.ReplayBufferSize > 0 {
+		m.replay = newMemoryReplayStore(cfg.ReplayBufferSize, cfg.ReplayBufferTTL)
+	}
+	return m
 }
 
 // ConnectionPredicate is a function that returns true if a connection should be removed
 type ConnectionPredicate func(*WebSocketConnection) bool
 
 func (m *webSocketManager) RegisterConnection(key string, metadata Metadata,
-	conn *websocket.Conn) *WebSocketConnection {
-	c := NewWebSocketConnection(conn, metadata, m.WriteWait)
+	conn *websocket.Conn, opts ...ConnectionOptions) *WebSocketConnection {
+	if conn.Subprotocol() == EnvelopeSubprotocol {
+		opts = append([]ConnectionOptions{WithEnvelope()}, opts...)
+	}
+	return m.RegisterTransport(key, metadata, newWebSocketTransport(conn, m.PongWait), opts...)
+}
 
-	connsInterface, _ := m.connections.LoadOrStore(key, []*WebSocketConnection{})
-	conns := connsInterface.([]*WebSocketConnection)
+func (m *webSocketManager) RegisterTransport(key string, metadata Metadata,
+	transport Transport, opts ...ConnectionOptions) *WebSocketConnection {
+	optionalParam := bindConnectionOptions(opts...)
 
-	conns = append(conns, c)
-	m.connections.Store(key, conns)
+	c := NewConnection(key, transport, metadata, m.WebSocketConfig)
+	c.Route = optionalParam.Route
+	c.envelope = optionalParam.Envelope
+	c.onRateLimited = func(limit MetricLabelValue, policy RateLimitPolicy) {
+		m.metric.rateLimited(c.Route, limit, policy)
+	}
+	c.inboundHandlers = optionalParam.InboundHandlers
+	if m.ackEnabled(c) {
+		c.inboundHandlers = withAckHandler(optionalParam.InboundHandlers)
+	}
+	if optionalParam.Authorize != nil && transport.Bidirectional() {
+		c.inboundHandlers = m.withSubscriptionHandlers(c.inboundHandlers, optionalParam.Authorize)
+	}
+	c.onDisconnect = optionalParam.OnDisconnect
+	c.onSubscribe = optionalParam.OnSubscribe
+	c.onUnsubscribe = optionalParam.OnUnsubscribe
+
+	var evicted []*WebSocketConnection
+	var err error
+	if m.draining.Load() {
+		err = ErrDraining
+	} else {
+		evicted, err = m.limiter.admit(c)
+	}
+
+	// Connections that are not admitted are closed right away, without the hooks and metrics of registered ones
+	switch {
+	case errors.Is(err, ErrDraining):
+		_ = c.closeWithCode(websocket.CloseGoingAway, "server shutting down", DisconnectReasonDrained)
+		return c
+	case err != nil:
+		slog.Warn("WebSocket connection limit reached, closing new connection", "error", err, "key", key,
+			"metadata", metadata)
+		_ = c.closeWithCode(websocket.CloseTryAgainLater, "connection limit reached", DisconnectReasonConnectionLimit)
+		return c
+	}
+
+	registered := m.register(c, optionalParam)
+	for _, victim := range evicted {
+		slog.Info("evicting WebSocket connection for a newer one", "key", victim.Key, "connection_id", victim.ID,
+			"metadata", victim.Metadata)
+		_ = victim.closeWithCode(m.ConnectionEvictedCloseCode, "evicted by a newer connection", DisconnectReasonEvicted)
+	}
+	if !registered {
+		return c
+	}
 
 	slog.Info(
 		"WebSocket connection registered",
 		"key", key,
+		"connection_id", c.ID,
 		"metadata", metadata,
 		"connected_at", c.ConnectedAt,
 	)
+	m.metric.connectionRegistered(c)
+
+	if optionalParam.OnConnect != nil {
+		optionalParam.OnConnect(c)
+	}
 
-	go m.handleHeartbeat(c, conn)
+	go c.writePump()
+	go m.handleHeartbeat(c)
 
 	return c
 }
 
+// ackEnabled reports whether the broadcasts to the connection wait for its acks, one-way transports can't ack
+func (m *webSocketManager) ackEnabled(c *WebSocketConnection) bool {
+	return m.AckModeEnabled && c.transport.Bidirectional()
+}
+
+// register adds an admitted connection to the registry, replaying the broadcasts it missed when it resumes.
+// Returns false after closing the connection when this pod could not join its key, e.g. when Redis is unreachable
+func (m *webSocketManager) register(c *WebSocketConnection, optionalParam ConnectionOptionalParams) bool {
+	if err := m.joinPrimaryKey(c); err != nil {
+		slog.Error("failed to join WebSocket key, closing new connection", "error", err, "key", c.Key,
+			"metadata", c.Metadata)
+		m.limiter.release(c)
+		_ = c.closeWithCode(websocket.CloseTryAgainLater, "failed to join key", DisconnectReasonJoinFailed)
+		return false
+	}
+
+	if optionalParam.Resume && m.replay != nil {
+		m.registerAndReplay(c, optionalParam.LastSeq)
+	} else {
+		m.connections.add(c)
+	}
+
+	// Drain started after the admission, its snapshot of the connections may have missed this one
+	if m.draining.Load() {
+		_ = c.closeWithCode(websocket.CloseGoingAway, "server shutting down", DisconnectReasonDrained)
+	}
+	return true
+}
+
+// registerAndReplay registers the connection and enqueues the buffered broadcasts newer than lastSeq before the live
+// ones. The replay is read without holding the broadcast lock of the key, the live broadcasts enqueued meanwhile are
+// held back in the resume buffer of the connection and enqueued after the replay
+func (m *webSocketManager) registerAndReplay(c *WebSocketConnection, lastSeq uint64) {
+	unlock := m.connections.lockBroadcast(c.Key)
+	c.resuming = true
+	m.connections.add(c)
+	unlock()
+
+	payloads, err := m.replay.Since(context.Background(), c.Key, lastSeq)
+	if err != nil {
+		slog.Warn("failed to read replay buffer", "error", err, "key", c.Key, "last_seq", lastSeq)
+	}
+
+	unlock = m.connections.lockBroadcast(c.Key)
+	defer unlock()
+
+	for _, payload := range payloads {
+		// Broadcasts targeted at other connections of the key are not replayed to this one
+		if !payload.Match.matches(c) {
+			continue
+		}
+		if _, err := c.enqueue(newBroadcastFrames(payload.Payload).forConnection(c, c.Key)); err != nil {
+			slog.Warn("failed to replay broadcast", "error", err, "key", c.Key, "seq", payload.Seq)
+			break
+		}
+		c.replayedSeq = payload.Seq
+	}
+
+	for _, live := range c.resumeBuffer {
+		// Live broadcasts kept in the replay buffer before it was read are already replayed
+		if live.seq != 0 && live.seq <= c.replayedSeq {
+			continue
+		}
+		if _, err := c.enqueue(live.frame); err != nil {
+			slog.Warn("failed to enqueue broadcast held back by the replay", "error", err, "key", c.Key,
+				"seq", live.seq)
+			break
+		}
+	}
+	c.resuming = false
+	c.resumeBuffer = nil
+}
+
+// joinPrimaryKey records the key the connection is registered under, connections rejected on registration have no key
+func (m *webSocketManager) joinPrimaryKey(c *WebSocketConnection) error {
+	if err := m.keyJoined(c.Key); err != nil {
+		return err
+	}
+
+	c.keys.mu.Lock()
+	defer c.keys.mu.Unlock()
+	c.keys.keys = []string{c.Key}
+	return nil
+}
+
+func (m *webSocketManager) AdmitConnection(key string, metadata Metadata) error {
+	if m.draining.Load() {
+		return ErrDraining
+	}
+	return m.limiter.check(key, metadata)
+}
+
 func (m *webSocketManager) UnregisterConnection(key string, predicate ConnectionPredicate) {
-	connsInterface, ok := m.connections.Load(key)
-	if !ok {
-		return
+	for _, c := range m.connections.removeMatching(key, predicate) {
+		_ = c.closeWithReason(DisconnectReasonUnregistered)
+	}
+}
+
+func (m *webSocketManager) UnregisterConnectionByID(key string, connectionID string) {
+	if c := m.connections.remove(key, connectionID); c != nil {
+		_ = c.closeWithReason(DisconnectReasonUnregistered)
 	}
+}
 
-	conns := connsInterface.([]*WebSocketConnection)
-	newConns := make([]*WebSocketConnection, 0, len(conns))
+// removeClosedConnection removes a closed connection from every key it is registered under and notifies the
+// OnUnsubscribe and OnDisconnect hooks, it is called once per connection after CloseChan is closed
+func (m *webSocketManager) removeClosedConnection(c *WebSocketConnection) {
+	keys := m.leaveAllKeys(c)
+	m.limiter.release(c)
 
-	for _, c := range conns {
-		if predicate(c) {
-			_ = c.Close()
-			slog.Info(
-				"WebSocket connection unregistered",
-				"key", key,
-				"metadata", c.Metadata,
-			)
-		} else {
-			newConns = append(newConns, c)
+	slog.Info(
+		"WebSocket connection unregistered",
+		"key", c.Key,
+		"connection_id", c.ID,
+		"metadata", c.Metadata,
+		"reason", c.closeReason,
+	)
+	m.metric.connectionRemoved(c, c.closeReason)
+
+	if c.onUnsubscribe != nil && len(keys) > 1 {
+		for _, key := range keys[1:] {
+			c.onUnsubscribe(c, key)
 		}
 	}
+	if c.onDisconnect != nil {
+		c.onDisconnect(c, c.closeReason)
+	}
+}
 
-	if len(newConns) == 0 {
-		m.connections.Delete(key)
-	} else {
-		m.connections.Store(key, &newConns)
+func (m *webSocketManager) BroadcastPayloadToLocalSubscribers(ctx context.Context, key string, message []byte,
+	opts ...BroadcastOptions) (result BroadcastResult, err error) {
+	optionalParam := bindBroadcastOptions(opts...)
+	startedAt := time.Now()
+	message = wrapBroadcast(message, optionalParam)
+	// The key rate limit may delay the broadcast, it is applied before taking the broadcast lock of the key
+	if limited, limitErr := m.applyKeyRateLimit(ctx, key, optionalParam, true); limitErr != nil {
+		m.metric.broadcastCompleted(ctx, limited.route, limited.fanOut, startedAt)
+		return limited.result, limitErr
+	}
+	unlock := m.connections.lockBroadcast(key)
+	var seq uint64
+	// Predicates can't be applied to the connections resuming later, the broadcasts they filter are not kept
+	if m.replay != nil && optionalParam.Filter == nil {
+		var appendErr error
+		if seq, message, appendErr = m.replay.Append(ctx, key, message, optionalParam.Match); appendErr != nil {
+			slog.Warn("failed to keep broadcast for replay", "error", appendErr, "key", key)
+		}
 	}
+	enqueued := m.enqueueToLocalSubscribers(ctx, key, message, seq, optionalParam)
+	unlock()
+
+	// Acks are awaited outside of the broadcast lock so that the next broadcasts of the key are not held back
+	result, err = m.awaitAcks(ctx, enqueued)
+	m.metric.broadcastCompleted(ctx, enqueued.route, enqueued.fanOut, startedAt)
+	return
 }
 
-func (m *webSocketManager) BroadcastPayloadToLocalSubscribers(ctx context.Context, key string, message []byte) (
-	deliveredCount int, err error,
-) {
-	connsInterface, ok := m.connections.Load(key)
-	if !ok {
+// enqueueSequenced enqueues a broadcast already wrapped and stamped with its sequence number, e.g. by another pod.
+// The caller awaits the acks with awaitAcks
+func (m *webSocketManager) enqueueSequenced(ctx context.Context, key string, message []byte,
+	seq uint64, optionalParam BroadcastOptionalParams) enqueuedBroadcast {
+	unlock := m.connections.lockBroadcast(key)
+	defer unlock()
+
+	return m.enqueueToLocalSubscribers(ctx, key, message, seq, optionalParam)
+}
+
+// enqueueToLocalSubscribers must be called with the broadcast lock of the key held,
+// the message is wrapped by wrapBroadcast and sent in the wire format of each connection
+func (m *webSocketManager) enqueueToLocalSubscribers(ctx context.Context, key string, message []byte,
+	seq uint64, optionalParam BroadcastOptionalParams) (enqueued enqueuedBroadcast) {
+	conns := m.connections.snapshot(key)
+	if len(conns) == 0 {
 		slog.Debug("no connections found for key", "key", key)
-		return 0, nil
+		return enqueuedBroadcast{}
 	}
-
-	conns := connsInterface.([]*WebSocketConnection)
+	enqueued.route = conns[0].Route
+	conns = slices.DeleteFunc(conns, func(c *WebSocketConnection) bool { return !optionalParam.selects(c) })
+	enqueued.fanOut = len(conns)
 	if len(conns) == 0 {
-		return 0, nil
+		slog.Debug("no connections selected by the broadcast filters", "key", key)
+		return
 	}
+	frames := newBroadcastFrames(message)
 
-	// Setup concurrent websocket writes for each WebSocketConnection this key output
+	// Setup concurrent enqueues for each WebSocketConnection this key output
 	emptyResult := map[string]struct{}{}
+	var overflowedCount atomic.Int64
+	var acksMu sync.Mutex
+	enqueued.startedAt = time.Now()
+	reports := make([]ConnectionDeliveryReport, len(conns))
+
+	enqueueToEachWebSocket := func(ctx context.Context, i int, connection *WebSocketConnection) (struct{}, error) {
+		// Already enqueued by the replay of a resuming connection, only the key it was registered under is replayed
+		if seq != 0 && key == connection.Key && seq <= connection.replayedSeq {
+			reports[i] = newConnectionDeliveryReport(connection, enqueued.startedAt, nil)
+			return struct{}{}, nil
+		}
+		frame := frames.forConnection(connection, key)
+		// Held back until the replay of the resuming connection is enqueued, these frames are not acked
+		if key == connection.Key && connection.resuming {
+			connection.resumeBuffer = append(connection.resumeBuffer, sequencedFrame{seq: seq, frame: frame})
+			reports[i] = newConnectionDeliveryReport(connection, enqueued.startedAt, nil)
+			return struct{}{}, nil
+		}
+		var ack *pendingAck
+		if m.ackEnabled(connection) {
+			if ack = frameWithAck(connection, frame); ack != nil {
+				frame = ack.frame
+			}
+		}
 
-	publishToEachWebSocket := func(ctx context.Context, i int, connection *WebSocketConnection) (struct{}, error) {
-		return struct{}{}, connection.send(message)
+		overflowed, err := connection.enqueue(frame)
+		reports[i] = newConnectionDeliveryReport(connection, enqueued.startedAt, err)
+		if overflowed {
+			overflowedCount.Add(1)
+		}
+		switch {
+		case errors.Is(err, ErrSendQueueFull):
+			m.metric.sendFailed(connection.Route, SendErrorSendQueueFull)
+		case errors.Is(err, ErrConnectionClosed):
+			m.metric.sendFailed(connection.Route, SendErrorConnectionClosed)
+		case errors.Is(err, ErrRateLimited):
+			m.metric.sendFailed(connection.Route, SendErrorRateLimited)
+		}
+		if ack != nil {
+			if err != nil {
+				connection.acks.untrack(ack.ackID)
+			} else {
+				ack.report = i
+				acksMu.Lock()
+				enqueued.acks = append(enqueued.acks, ack)
+				acksMu.Unlock()
+			}
+		}
+		return struct{}{}, err
 	}
 
-	useMetadataAsKey := func(i int, from *WebSocketConnection) string {
-		return from.Metadata.ToString()
+	// Connections of the same user share their metadata, only their ID tells them apart
+	useConnectionIDAsKey := func(i int, from *WebSocketConnection) string {
+		return from.ID
 	}
 
-	publishToEachWebSocketTask := concurrent.NewSliceTask(
+	enqueueToEachWebSocketTask := concurrent.NewSliceTask(
 		conns,
 		emptyResult,
-		publishToEachWebSocket,
-		useMetadataAsKey,
+		enqueueToEachWebSocket,
+		useConnectionIDAsKey,
 	)
 
-	// Concurrently publish to all WebSocket connections and wait for completion
-	multiError := concurrent.NewGroup(ctx).Exec(publishToEachWebSocketTask)
-	deliveredCount = len(conns)
+	// Concurrently enqueue to all WebSocket connections and wait for completion
+	multiError := concurrent.NewGroup(ctx).Exec(enqueueToEachWebSocketTask)
+	enqueued.result.DeliveredCount = len(conns)
 
 	if multiError != nil && multiError.ErrorOrNil() != nil {
-		deliveredCount = deliveredCount - multiError.Len()
+		enqueued.result.DeliveredCount = enqueued.result.DeliveredCount - multiError.Len()
 	}
+	enqueued.result.OverflowedCount = int(overflowedCount.Load())
+	enqueued.result.Connections = reports
+	enqueued.err = multiError.ErrorOrNil()
 
-	return deliveredCount, multiError.ErrorOrNil()
+	return enqueued
 }
 
 func (m *webSocketManager) CloseAll(code int, reason string) {
 	slog.Info("closing all WebSocket connections", "code", code, "reason", reason)
 
-	m.connections.Range(
-		func(key, value interface{}) bool {
-			conns := value.([]*WebSocketConnection)
-			for _, c := range conns {
-				closeMsg := websocket.FormatCloseMessage(code, reason)
-				_ = c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(5*time.Second))
-				_ = c.Close()
-			}
-			return true
-		},
-	)
-
-	m.connections = sync.Map{}
+	for _, c := range m.connections.drain() {
+		_ = c.CloseWithCode(code, reason)
+	}
 }
 
-// handleHeartbeat manages ping/pong heartbeat for a connection
-func (m *webSocketManager) handleHeartbeat(c *WebSocketConnection, conn *websocket.Conn) {
+// handleHeartbeat pings the connection every PingInterval and removes the connection once it is closed
+func (m *webSocketManager) handleHeartbeat(c *WebSocketConnection) {
 	ticker := time.NewTicker(m.PingInterval)
 	defer ticker.Stop()
+	defer m.removeClosedConnection(c)
 
-	_ = conn.SetReadDeadline(time.Now().Add(m.PongWait))
-	conn.SetPongHandler(
-		func(string) error {
-			_ = conn.SetReadDeadline(time.Now().Add(m.PongWait))
-			return nil
-		},
-	)
+	go m.readInboundMessages(c)
+	if len(c.inboundHandlers) > 0 {
+		go m.dispatchInboundMessages(c)
+	}
 
-	go func() {
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.transport.Ping(time.Now().Add(m.WriteWait)); err != nil {
 				slog.Info(
-					"WebSocket read error, closing connection",
+					"failed to send ping, closing connection",
 					"error", err,
 					"metadata", c.Metadata,
 				)
+				m.metric.pingFailed(c)
+				_ = c.closeWithReason(DisconnectReasonPingFailure)
 				return
 			}
+		case <-c.CloseChan:
+			return
 		}
-	}()
+	}
+}
 
+// readInboundMessages reads client frames until the connection fails and dispatches text frames to the inbound handlers
+func (m *webSocketManager) readInboundMessages(c *WebSocketConnection) {
 	for {
-		select {
-		case <-ticker.C:
-			_ = conn.SetWriteDeadline(time.Now().Add(m.WriteWait))
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				slog.Info(
-					"failed to send ping, closing connection",
-					"error", err,
-					"metadata", c.Metadata,
-				)
+		data, err := c.transport.ReadMessage()
+		if err != nil {
+			slog.Info(
+				"WebSocket read error, closing connection",
+				"error", err,
+				"metadata", c.Metadata,
+			)
+			_ = c.closeWithReason(DisconnectReasonReadError)
+			return
+		}
+
+		// Under RateLimitPolicyDelay the next frames are not read until the limit allows it
+		if !c.applyRateLimit(c.inboundLimiter, c.inboundLimitPolicy, RateLimitInboundConnection) {
+			if c.inboundLimitPolicy == RateLimitPolicyClose {
+				c.closeRateLimited(RateLimitInboundConnection)
 				return
 			}
+			continue
+		}
+
+		if len(c.inboundHandlers) == 0 {
+			continue
+		}
+
+		// The handlers run on dispatchInboundMessages, the reads only wait for them once the queue is full
+		select {
+		case c.inboundQueue <- data:
+		case <-c.CloseChan:
+			return
+		}
+	}
+}
+
+// dispatchInboundMessages runs the inbound handlers on the queued frames one at a time, in the order they were read,
+// until the connection is closed
+func (m *webSocketManager) dispatchInboundMessages(c *WebSocketConnection) {
+	for {
+		select {
+		case data := <-c.inboundQueue:
+			m.dispatchInboundMessage(c, data)
 		case <-c.CloseChan:
 			return
 		}
 	}
 }
+
+func (m *webSocketManager) dispatchInboundMessage(c *WebSocketConnection, data []byte) {
+	ctx := context.Background()
+	if m.InboundHandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.InboundHandlerTimeout)
+		defer cancel()
+	}
+
+	if err := c.inboundHandlers.Dispatch(ctx, c, data); err != nil {
+		slog.Warn(
+			"failed to handle inbound WebSocket message",
+			"error", err,
+			"key", c.Key,
+			"metadata", c.Metadata,
+		)
+	}
+}
@@ -0,0 +1,254 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketManagerConnectionLifecycle(t *testing.T) {
+	cfg := WebSocketConfig{
+		PingInterval:  time.Minute,
+		PongWait:      time.Minute,
+		WriteWait:     time.Second,
+		SendQueueSize: 8,
+	}
+
+	type disconnect struct {
+		connectionID string
+		reason       DisconnectReason
+	}
+
+	registerWithHooks := func(m WebSocketManager, serverConn *websocket.Conn) (
+		c *WebSocketConnection, connected chan string, disconnected chan disconnect,
+	) {
+		connected = make(chan string, 1)
+		disconnected = make(chan disconnect, 2)
+		c = m.RegisterConnection(
+			"key", Metadata{"user_id": {"user-1"}}, serverConn,
+			WithOnConnect(func(c *WebSocketConnection) { connected <- c.Key }),
+			WithOnDisconnect(
+				func(c *WebSocketConnection, reason DisconnectReason) {
+					disconnected <- disconnect{connectionID: c.ID, reason: reason}
+				},
+			),
+		)
+		return
+	}
+
+	awaitDisconnect := func(t *testing.T, disconnected chan disconnect) disconnect {
+		select {
+		case d := <-disconnected:
+			return d
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "OnDisconnect was not called")
+			return disconnect{}
+		}
+	}
+
+	t.Run(
+		"client going away removes the connection", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+			c, connected, disconnected := registerWithHooks(m, serverConn)
+			assert.Equal(t, "key", <-connected)
+
+			require.NoError(t, clientConn.Close())
+
+			d := awaitDisconnect(t, disconnected)
+			assert.Equal(t, disconnect{connectionID: c.ID, reason: DisconnectReasonReadError}, d)
+			assert.Equal(t, DisconnectReasonReadError, c.CloseReason())
+			<-c.CloseChan
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(`{}`))
+			assert.NoError(t, err)
+			assert.Zero(t, result.DeliveredCount, "the closed connection should no longer receive broadcasts")
+		},
+	)
+
+	t.Run(
+		"OnDisconnect is called once when unregistered", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, _ := newTestConnPair(t)
+			c, _, disconnected := registerWithHooks(m, serverConn)
+
+			m.UnregisterConnectionByID("key", c.ID)
+			m.UnregisterConnectionByID("key", c.ID)
+
+			d := awaitDisconnect(t, disconnected)
+			assert.Equal(t, DisconnectReasonUnregistered, d.reason)
+			assert.Never(t, func() bool { return len(disconnected) > 0 }, 200*time.Millisecond, 20*time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"slow consumer disconnect is reported", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, _ := newTestConnPair(t)
+			c, _, disconnected := registerWithHooks(m, serverConn)
+
+			// Close the connection the same way the send queue overflow does
+			_ = c.closeWithCode(websocket.CloseTryAgainLater, "send queue overflow", DisconnectReasonSendQueueOverflow)
+
+			d := awaitDisconnect(t, disconnected)
+			assert.Equal(t, DisconnectReasonSendQueueOverflow, d.reason)
+		},
+	)
+
+	t.Run(
+		"CloseAll reports a server close", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, _ := newTestConnPair(t)
+			_, _, disconnected := registerWithHooks(m, serverConn)
+
+			m.CloseAll(websocket.CloseGoingAway, "server shutting down")
+
+			d := awaitDisconnect(t, disconnected)
+			assert.Equal(t, DisconnectReasonServerClosed, d.reason)
+		},
+	)
+}
+
+func TestWebSocketManagerResumeFromLastSeq(t *testing.T) {
+	ctx := context.Background()
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueueSize:    8,
+			ReplayBufferSize: 8,
+			ReplayBufferTTL:  time.Minute,
+		},
+	)
+	t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+	readSeq := func(t *testing.T, clientConn *websocket.Conn) (seq uint64, content string) {
+		var msg struct {
+			Seq     uint64 `json:"seq"`
+			Content string `json:"content"`
+		}
+		require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, clientConn.ReadJSON(&msg))
+		return msg.Seq, msg.Content
+	}
+
+	// The client receives the first broadcast, then drops before the next two
+	serverConn, clientConn := newTestConnPair(t)
+	first := m.RegisterConnection("key", Metadata{}, serverConn)
+	_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"first"}`))
+	require.NoError(t, err)
+	lastSeq, content := readSeq(t, clientConn)
+	require.Equal(t, "first", content)
+
+	m.UnregisterConnectionByID("key", first.ID)
+	_, _ = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"missed 1"}`))
+	_, _ = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"missed 2"}`))
+
+	// Reconnecting with last_seq replays the gap before live broadcasts
+	serverConn, clientConn = newTestConnPair(t)
+	m.RegisterConnection("key", Metadata{}, serverConn, WithResumeFrom(lastSeq))
+	_, err = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"live"}`))
+	require.NoError(t, err)
+
+	for _, expected := range []string{"missed 1", "missed 2", "live"} {
+		seq, content := readSeq(t, clientConn)
+		assert.Equal(t, expected, content)
+		assert.Equal(t, lastSeq+1, seq)
+		lastSeq = seq
+	}
+}
+
+func TestWebSocketManagerResumeDoesNotHoldBroadcastsBack(t *testing.T) {
+	ctx := context.Background()
+	m := newWebSocketManager(
+		WebSocketConfig{
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueueSize:    8,
+			ReplayBufferSize: 8,
+			ReplayBufferTTL:  time.Minute,
+		}, newNoopWebSocketMetric(),
+	)
+	t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+	store := &blockingReplayStore{ReplayStore: m.replay, reading: make(chan struct{}), release: make(chan struct{})}
+	m.replay = store
+
+	_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"missed"}`))
+	require.NoError(t, err)
+
+	serverConn, clientConn := newTestConnPair(t)
+	go m.RegisterConnection("key", Metadata{}, serverConn, WithResumeFrom(0))
+	<-store.reading
+
+	// Broadcasts are not held back while the replay buffer is read, the live ones are enqueued after the replay
+	result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"live"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DeliveredCount)
+	close(store.release)
+
+	for _, expected := range []string{"missed", "live"} {
+		var msg struct {
+			Content string `json:"content"`
+		}
+		require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, clientConn.ReadJSON(&msg))
+		assert.Equal(t, expected, msg.Content)
+	}
+}
+
+// blockingReplayStore blocks Since until released, reading is closed once Since is called
+type blockingReplayStore struct {
+	ReplayStore
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingReplayStore) Since(ctx context.Context, key string, lastSeq uint64) ([]SequencedPayload, error) {
+	close(s.reading)
+	<-s.release
+	return s.ReplayStore.Since(ctx, key, lastSeq)
+}
+
+// withoutReports moves the connection reports out of the result, so that the counts can be compared as a whole
+func withoutReports(result *BroadcastResult) []ConnectionDeliveryReport {
+	reports := result.Connections
+	result.Connections = nil
+	return reports
+}
+
+func TestWebSocketManagerDeliveryReport(t *testing.T) {
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{PingInterval: time.Minute, PongWait: time.Minute, WriteWait: time.Second, SendQueueSize: 8},
+	)
+	t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+	// Two devices of the same user share their metadata
+	metadata := Metadata{"user_id": {"user-1"}}
+	phoneServerConn, _ := newTestConnPair(t)
+	phone := m.RegisterConnection("key", metadata, phoneServerConn)
+	laptopServerConn, _ := newTestConnPair(t)
+	laptop := m.RegisterConnection("key", metadata, laptopServerConn)
+
+	result, err := m.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(`{"content":"Hello"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.DeliveredCount)
+
+	reported := map[string]ConnectionDeliveryReport{}
+	for _, report := range result.Connections {
+		reported[report.ConnectionID] = report
+	}
+	require.Len(t, reported, 2)
+	for _, c := range []*WebSocketConnection{phone, laptop} {
+		report := reported[c.ID]
+		assert.Equal(t, metadata, report.Metadata)
+		assert.NoError(t, report.Err)
+		assert.Empty(t, report.Error)
+		assert.Positive(t, report.Latency)
+	}
+}
@@ -0,0 +1,211 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	doakesmetrics "github.com/domesama/doakes/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+type (
+	MetricType       string
+	MetricLabel      string
+	MetricLabelValue string
+)
+
+const (
+	ActiveConnectionsMetricType MetricType = "active_connections"
+	ActiveKeysMetricType        MetricType = "active_keys"
+	RegistrationsMetricType     MetricType = "registrations"
+	DisconnectsMetricType       MetricType = "disconnects"
+	PingFailuresMetricType      MetricType = "ping_failures"
+	SendErrorsMetricType        MetricType = "send_errors"
+	BroadcastLatencyMetricType  MetricType = "broadcast_latency_seconds"
+	BroadcastFanOutMetricType   MetricType = "broadcast_fan_out"
+	RateLimitedMetricType       MetricType = "rate_limited"
+)
+
+const (
+	MetricAttributeRoute            MetricLabel = "route"
+	MetricAttributeDisconnectReason MetricLabel = "reason"
+	MetricAttributeSendError        MetricLabel = "error"
+	MetricAttributeRateLimit        MetricLabel = "limit"
+	MetricAttributeRateLimitPolicy  MetricLabel = "policy"
+)
+
+const (
+	// MetricRouteUnknown labels connections registered without WithRoute and broadcasts to keys without connections
+	MetricRouteUnknown MetricLabelValue = "unknown"
+
+	SendErrorSendQueueFull    MetricLabelValue = "send_queue_full"
+	SendErrorConnectionClosed MetricLabelValue = "connection_closed"
+	SendErrorWrite            MetricLabelValue = "write_error"
+	SendErrorRateLimited      MetricLabelValue = "rate_limited"
+
+	RateLimitOutboundConnection MetricLabelValue = "outbound_connection"
+	RateLimitOutboundKey        MetricLabelValue = "outbound_key"
+	RateLimitInboundConnection  MetricLabelValue = "inbound_connection"
+)
+
+func (m MetricType) GetMetricName(name string) string {
+	return fmt.Sprintf("%v_%v", name, string(m))
+}
+
+func (m MetricType) GetMetricTotalName() string {
+	return fmt.Sprintf("%v_total", string(m))
+}
+
+func (m MetricLabel) ToString() string {
+	return string(m)
+}
+
+func (m MetricLabelValue) ToString() string {
+	return string(m)
+}
+
+// WebSocketMetric holds the instruments of the WebSocket subsystem, every measurement is labelled by route
+type WebSocketMetric struct {
+	Name              string
+	ActiveConnections metric.Int64UpDownCounter
+	ActiveKeys        metric.Int64UpDownCounter
+	Registrations     metric.Int64Counter
+	Disconnects       metric.Int64Counter
+	PingFailures      metric.Int64Counter
+	SendErrors        metric.Int64Counter
+	BroadcastLatency  metric.Float64Histogram
+	BroadcastFanOut   metric.Int64Histogram
+	RateLimited       metric.Int64Counter
+}
+
+func ProvideWebSocketMetric() (*WebSocketMetric, error) {
+	return CreateWebSocketMetrics("websocket")
+}
+
+// CreateWebSocketMetrics registers the instruments through the default meter, names are prefixed with name
+func CreateWebSocketMetrics(name string) (*WebSocketMetric, error) {
+	return createWebSocketMetrics(doakesmetrics.GetDefaultMeter(), name)
+}
+
+// newNoopWebSocketMetric records nothing, it is used by managers created without metrics
+func newNoopWebSocketMetric() *WebSocketMetric {
+	// The noop meter never fails to create an instrument
+	m, _ := createWebSocketMetrics(noop.NewMeterProvider().Meter(""), "websocket")
+	return m
+}
+
+func createWebSocketMetrics(meter metric.Meter, name string) (*WebSocketMetric, error) {
+	var errs []error
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	activeConnections, err := meter.Int64UpDownCounter(ActiveConnectionsMetricType.GetMetricName(name))
+	collect(err)
+	activeKeys, err := meter.Int64UpDownCounter(ActiveKeysMetricType.GetMetricName(name))
+	collect(err)
+	registrations, err := meter.Int64Counter(RegistrationsMetricType.GetMetricName(name))
+	collect(err)
+	disconnects, err := meter.Int64Counter(DisconnectsMetricType.GetMetricName(name))
+	collect(err)
+	pingFailures, err := meter.Int64Counter(PingFailuresMetricType.GetMetricName(name))
+	collect(err)
+	sendErrors, err := meter.Int64Counter(SendErrorsMetricType.GetMetricName(name))
+	collect(err)
+	broadcastLatency, err := meter.Float64Histogram(
+		BroadcastLatencyMetricType.GetMetricName(name), metric.WithUnit("s"),
+	)
+	collect(err)
+	broadcastFanOut, err := meter.Int64Histogram(BroadcastFanOutMetricType.GetMetricName(name))
+	collect(err)
+	rateLimited, err := meter.Int64Counter(RateLimitedMetricType.GetMetricName(name))
+	collect(err)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to create WebSocket metrics: %w", errors.Join(errs...))
+	}
+	return &WebSocketMetric{
+		Name:              name,
+		ActiveConnections: activeConnections,
+		ActiveKeys:        activeKeys,
+		Registrations:     registrations,
+		Disconnects:       disconnects,
+		PingFailures:      pingFailures,
+		SendErrors:        sendErrors,
+		BroadcastLatency:  broadcastLatency,
+		BroadcastFanOut:   broadcastFanOut,
+		RateLimited:       rateLimited,
+	}, nil
+}
+
+func (m *WebSocketMetric) connectionRegistered(c *WebSocketConnection) {
+	ctx := context.Background()
+	m.Registrations.Add(ctx, 1, routeLabel(c.Route))
+	m.ActiveConnections.Add(ctx, 1, routeLabel(c.Route))
+}
+
+func (m *WebSocketMetric) connectionRemoved(c *WebSocketConnection, reason DisconnectReason) {
+	ctx := context.Background()
+	m.ActiveConnections.Add(ctx, -1, routeLabel(c.Route))
+	m.Disconnects.Add(
+		ctx, 1, metric.WithAttributes(
+			attribute.String(MetricAttributeRoute.ToString(), routeOrUnknown(c.Route)),
+			attribute.String(MetricAttributeDisconnectReason.ToString(), string(reason)),
+		),
+	)
+	if reason == DisconnectReasonWriteError {
+		m.sendFailed(c.Route, SendErrorWrite)
+	}
+}
+
+// keysChanged records keys gaining their first connection (delta > 0) or losing their last one (delta < 0)
+func (m *WebSocketMetric) keysChanged(route string, delta int64) {
+	m.ActiveKeys.Add(context.Background(), delta, routeLabel(route))
+}
+
+func (m *WebSocketMetric) pingFailed(c *WebSocketConnection) {
+	m.PingFailures.Add(context.Background(), 1, routeLabel(c.Route))
+}
+
+func (m *WebSocketMetric) sendFailed(route string, sendError MetricLabelValue) {
+	m.SendErrors.Add(
+		context.Background(), 1, metric.WithAttributes(
+			attribute.String(MetricAttributeRoute.ToString(), routeOrUnknown(route)),
+			attribute.String(MetricAttributeSendError.ToString(), sendError.ToString()),
+		),
+	)
+}
+
+// rateLimited records a message exceeding a rate limit, policy is what was done with it
+func (m *WebSocketMetric) rateLimited(route string, limit MetricLabelValue, policy RateLimitPolicy) {
+	m.RateLimited.Add(
+		context.Background(), 1, metric.WithAttributes(
+			attribute.String(MetricAttributeRoute.ToString(), routeOrUnknown(route)),
+			attribute.String(MetricAttributeRateLimit.ToString(), limit.ToString()),
+			attribute.String(MetricAttributeRateLimitPolicy.ToString(), string(policy)),
+		),
+	)
+}
+
+// broadcastCompleted records the local fan-out of a broadcast and how long it took to enqueue it, acks included
+func (m *WebSocketMetric) broadcastCompleted(ctx context.Context, route string, fanOut int, startedAt time.Time) {
+	m.BroadcastFanOut.Record(ctx, int64(fanOut), routeLabel(route))
+	m.BroadcastLatency.Record(ctx, time.Since(startedAt).Seconds(), routeLabel(route))
+}
+
+func routeLabel(route string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String(MetricAttributeRoute.ToString(), routeOrUnknown(route)))
+}
+
+func routeOrUnknown(route string) string {
+	if route == "" {
+		return MetricRouteUnknown.ToString()
+	}
+	return route
+}
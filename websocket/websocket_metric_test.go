@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestWebSocketMetric(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metric, err := createWebSocketMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"), "test")
+	require.NoError(t, err)
+	m := newWebSocketManager(
+		WebSocketConfig{
+			PingInterval:  time.Minute,
+			PongWait:      time.Minute,
+			WriteWait:     time.Second,
+			SendQueueSize: 8,
+		}, metric,
+	)
+	dial := newTestConnDialer(t)
+
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+
+		res := map[string]metricdata.Aggregation{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				res[m.Name] = m.Data
+			}
+		}
+		return res
+	}
+	sumOf := func(data metricdata.Aggregation, attrs ...attribute.KeyValue) int64 {
+		set := attribute.NewSet(attrs...)
+		for _, point := range data.(metricdata.Sum[int64]).DataPoints {
+			if point.Attributes.Equals(&set) {
+				return point.Value
+			}
+		}
+		return 0
+	}
+	route := attribute.String(MetricAttributeRoute.ToString(), "/subscribe")
+
+	serverConn, clientConn := dial()
+	disconnected := make(chan struct{})
+	m.RegisterConnection(
+		"key-1", Metadata{}, serverConn, WithRoute("/subscribe"),
+		WithOnDisconnect(func(*WebSocketConnection, DisconnectReason) { close(disconnected) }),
+	)
+	serverConn, _ = dial()
+	m.RegisterConnection("key-1", Metadata{}, serverConn, WithRoute("/subscribe"))
+	serverConn, _ = dial()
+	m.RegisterConnection("key-2", Metadata{}, serverConn, WithRoute("/subscribe"))
+
+	_, err = m.BroadcastPayloadToLocalSubscribers(context.Background(), "key-1", []byte(`{}`))
+	require.NoError(t, err)
+
+	data := collect()
+	assert.Equal(t, int64(3), sumOf(data[RegistrationsMetricType.GetMetricName("test")], route))
+	assert.Equal(t, int64(3), sumOf(data[ActiveConnectionsMetricType.GetMetricName("test")], route))
+	assert.Equal(t, int64(2), sumOf(data[ActiveKeysMetricType.GetMetricName("test")], route))
+
+	fanOut := data[BroadcastFanOutMetricType.GetMetricName("test")].(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, fanOut, 1)
+	assert.Equal(t, uint64(1), fanOut[0].Count)
+	assert.Equal(t, int64(2), fanOut[0].Sum)
+	latency := data[BroadcastLatencyMetricType.GetMetricName("test")].(metricdata.Histogram[float64]).DataPoints
+	require.Len(t, latency, 1)
+	assert.Equal(t, uint64(1), latency[0].Count)
+
+	require.NoError(t, clientConn.Close())
+	<-disconnected
+
+	data = collect()
+	assert.Equal(t, int64(2), sumOf(data[ActiveConnectionsMetricType.GetMetricName("test")], route))
+	assert.Equal(t, int64(2), sumOf(data[ActiveKeysMetricType.GetMetricName("test")], route))
+	assert.Equal(
+		t, int64(1), sumOf(
+			data[DisconnectsMetricType.GetMetricName("test")], route,
+			attribute.String(MetricAttributeDisconnectReason.ToString(), string(DisconnectReasonReadError)),
+		),
+	)
+
+	m.CloseAll(1001, "shutting down")
+	assert.Eventually(
+		t, func() bool {
+			data := collect()
+			return sumOf(data[ActiveConnectionsMetricType.GetMetricName("test")], route) == 0 &&
+				sumOf(data[ActiveKeysMetricType.GetMetricName("test")], route) == 0
+		}, 5*time.Second, 10*time.Millisecond,
+	)
+}
+
+func TestWebSocketMetricInvalidName(t *testing.T) {
+	_, err := createWebSocketMetrics(sdkmetric.NewMeterProvider().Meter("test"), "invalid name")
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// MulticastResult summarizes a multicast, Keys holds the result of each key in the order they were given
+type MulticastResult struct {
+	// DeliveredCount is the number of connections the message was delivered to, across every key
+	DeliveredCount int                  `json:"delivered"`
+	Keys           []KeyBroadcastResult `json:"keys"`
+}
+
+// KeyBroadcastResult is the outcome of a multicast for one key
+type KeyBroadcastResult struct {
+	Key string `json:"key"`
+	BroadcastResult
+	// Err is the error of the broadcast to the key, Error its message
+	Err   error  `json:"-"`
+	Error string `json:"error,omitempty"`
+}
+
+// BroadcastFunc broadcasts a payload to the subscribers of a key, e.g. WebSocketManager.BroadcastPayloadToLocalSubscribers
+type BroadcastFunc func(ctx context.Context, key string, message []byte, opts ...BroadcastOptions) (
+	BroadcastResult, error,
+)
+
+// Multicast broadcasts the payload to each of the keys with broadcast, at most parallelism keys at a time
+// (every key at once when parallelism is 0). Duplicated and empty keys are skipped.
+// The error joins the errors of the keys, each wrapped with its key. Keys still waiting for a slot when ctx is done
+// fail with the error of ctx
+func Multicast(ctx context.Context, broadcast BroadcastFunc, parallelism int, keys []string, message []byte,
+	opts ...BroadcastOptions) (MulticastResult, error) {
+	keys = uniqueKeys(keys)
+	if parallelism <= 0 || parallelism > len(keys) {
+		parallelism = len(keys)
+	}
+
+	results := make([]KeyBroadcastResult, len(keys))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		if err := acquireSlot(ctx, slots); err != nil {
+			// The remaining keys are not broadcast to
+			results[i] = KeyBroadcastResult{Key: key, Err: err, Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result, err := broadcast(ctx, key, message, opts...)
+			results[i] = KeyBroadcastResult{Key: key, BroadcastResult: result, Err: err}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	multicast := MulticastResult{Keys: results}
+	var errs []error
+	for _, result := range results {
+		multicast.DeliveredCount += result.DeliveredCount
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", result.Key, result.Err))
+		}
+	}
+	return multicast, errors.Join(errs...)
+}
+
+// acquireSlot waits for a free slot, a done ctx wins over a slot freed at the same time
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		<-slots
+		return err
+	}
+	return nil
+}
+
+// uniqueKeys returns the non-empty keys without duplicates, in the order they were given
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]struct{}, len(keys))
+	return slices.DeleteFunc(
+		slices.Clone(keys), func(key string) bool {
+			if _, ok := seen[key]; ok || key == "" {
+				return true
+			}
+			seen[key] = struct{}{}
+			return false
+		},
+	)
+}
+
+func (m *webSocketManager) MulticastPayloadToLocalSubscribers(ctx context.Context, keys []string, message []byte,
+	opts ...BroadcastOptions) (MulticastResult, error) {
+	return Multicast(ctx, m.BroadcastPayloadToLocalSubscribers, m.MulticastParallelism, keys, message, opts...)
+}
@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMulticast(t *testing.T) {
+	t.Run(
+		"broadcasts to each key once with bounded parallelism", func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int64
+			var mu sync.Mutex
+			var broadcasted []string
+			broadcast := func(_ context.Context, key string, _ []byte, _ ...BroadcastOptions) (BroadcastResult, error) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					current := maxInFlight.Load()
+					if n <= current || maxInFlight.CompareAndSwap(current, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				broadcasted = append(broadcasted, key)
+				mu.Unlock()
+				return BroadcastResult{DeliveredCount: 1}, nil
+			}
+
+			keys := []string{"a", "b", "", "c", "a", "d", "e"}
+			result, err := Multicast(context.Background(), broadcast, 2, keys, []byte(`{}`))
+			require.NoError(t, err)
+
+			assert.Equal(t, 5, result.DeliveredCount)
+			assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, broadcasted)
+			assert.LessOrEqual(t, maxInFlight.Load(), int64(2))
+
+			// The results follow the order of the keys
+			var resultKeys []string
+			for _, keyResult := range result.Keys {
+				resultKeys = append(resultKeys, keyResult.Key)
+			}
+			assert.Equal(t, []string{"a", "b", "c", "d", "e"}, resultKeys)
+		},
+	)
+
+	t.Run(
+		"reports the error of each key", func(t *testing.T) {
+			errDelivery := errors.New("delivery failed")
+			broadcast := func(_ context.Context, key string, _ []byte, _ ...BroadcastOptions) (BroadcastResult, error) {
+				if key == "b" {
+					return BroadcastResult{DeliveredCount: 1, OverflowedCount: 1}, errDelivery
+				}
+				return BroadcastResult{DeliveredCount: 2}, nil
+			}
+
+			result, err := Multicast(context.Background(), broadcast, 0, []string{"a", "b"}, []byte(`{}`))
+			require.ErrorIs(t, err, errDelivery)
+			assert.ErrorContains(t, err, "key b")
+
+			assert.Equal(t, 3, result.DeliveredCount)
+			assert.Equal(
+				t, []KeyBroadcastResult{
+					{Key: "a", BroadcastResult: BroadcastResult{DeliveredCount: 2}},
+					{
+						Key:             "b",
+						BroadcastResult: BroadcastResult{DeliveredCount: 1, OverflowedCount: 1},
+						Err:             errDelivery,
+						Error:           errDelivery.Error(),
+					},
+				}, result.Keys,
+			)
+		},
+	)
+
+	t.Run(
+		"stops waiting for a slot once the context is done", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			started := make(chan struct{})
+			var calls atomic.Int64
+			broadcast := func(ctx context.Context, _ string, _ []byte, _ ...BroadcastOptions) (BroadcastResult, error) {
+				calls.Add(1)
+				close(started)
+				<-ctx.Done()
+				return BroadcastResult{}, ctx.Err()
+			}
+
+			go func() {
+				<-started
+				cancel()
+			}()
+			result, err := Multicast(ctx, broadcast, 1, []string{"a", "b", "c"}, []byte(`{}`))
+			require.ErrorIs(t, err, context.Canceled)
+
+			// Only the key holding the slot was broadcast to
+			assert.Equal(t, int64(1), calls.Load())
+			require.Len(t, result.Keys, 3)
+			for _, keyResult := range result.Keys {
+				assert.ErrorIs(t, keyResult.Err, context.Canceled)
+			}
+		},
+	)
+
+	t.Run(
+		"delivers to the connections of every key", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(
+				WebSocketConfig{
+					PingInterval:         time.Minute,
+					PongWait:             time.Minute,
+					WriteWait:            time.Second,
+					SendQueueSize:        8,
+					MulticastParallelism: 1,
+				},
+			)
+			t.Cleanup(func() { m.CloseAll(websocket.CloseGoingAway, "test finished") })
+
+			var clientConns []*websocket.Conn
+			for _, key := range []string{"user-1", "user-2"} {
+				serverConn, clientConn := newTestConnPair(t)
+				m.RegisterConnection(key, Metadata{}, serverConn)
+				clientConns = append(clientConns, clientConn)
+			}
+
+			result, err := m.MulticastPayloadToLocalSubscribers(
+				context.Background(), []string{"user-1", "user-2", "user-3"}, []byte(`{"content":"Hello"}`),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.DeliveredCount)
+			require.Len(t, result.Keys, 3)
+			assert.Equal(t, 0, result.Keys[2].DeliveredCount)
+
+			for _, clientConn := range clientConns {
+				var msg struct {
+					Content string `json:"content"`
+				}
+				require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+				require.NoError(t, clientConn.ReadJSON(&msg))
+				assert.Equal(t, "Hello", msg.Content)
+			}
+		},
+	)
+}
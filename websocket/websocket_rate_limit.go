@@ -0,0 +1,317 @@
+package websocket
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RateLimitPolicy decides what happens to a message exceeding a rate limit, see WebSocketConfig.OutboundRateLimitPolicy
+type RateLimitPolicy string
+
+const (
+	// RateLimitPolicyDelay holds the message until the limit allows it: outbound messages wait in the send queue,
+	// whose overflow policy applies, and inbound frames stop being read. Broadcasts over the limit of their key wait
+	// before being enqueued, except the ones received by the redis_pubsub backend which are dropped.
+	// Messages that would wait longer than a burst or a second worth of messages are dropped
+	RateLimitPolicyDelay RateLimitPolicy = "delay"
+	// RateLimitPolicyDrop drops the message, outbound broadcasts report it as undelivered with ErrRateLimited
+	RateLimitPolicyDrop RateLimitPolicy = "drop"
+	// RateLimitPolicyClose closes the connections exceeding the limit with 1008 (policy violation)
+	RateLimitPolicyClose RateLimitPolicy = "close"
+)
+
+// Decode implements envconfig.Decoder to reject unknown policies at startup
+func (p *RateLimitPolicy) Decode(value string) error {
+	switch policy := RateLimitPolicy(value); policy {
+	case RateLimitPolicyDelay, RateLimitPolicyDrop, RateLimitPolicyClose:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown rate limit policy %q", value)
+	}
+}
+
+// tokenBucket allows rate messages per second on average with bursts of up to burst messages.
+// A nil bucket is an unlimited one
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	// maxDebt bounds how far reservations take tokens below zero, i.e. the delay of a reserved token
+	maxDebt float64
+	last    time.Time
+	// lastUsed is in the future while reserved tokens are waited for
+	lastUsed time.Time
+}
+
+// newTokenBucket returns nil when rate is not positive. A burst below 1 defaults to one second worth of messages
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+
+	now := time.Now()
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		// Delays are bounded by a burst or a second worth of messages, whichever is longer
+		maxDebt:  max(float64(burst), rate),
+		last:     now,
+		lastUsed: now,
+	}
+}
+
+// refill must be called with mu held
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if now.After(b.lastUsed) {
+		b.lastUsed = now
+	}
+}
+
+// allow takes a token if one is available
+func (b *tokenBucket) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token and returns how long to wait before using it, the tokens of concurrent callers are
+// reserved one after the other. Returns false without taking a token when the wait would exceed maxDebt
+func (b *tokenBucket) reserve() (delay time.Duration, ok bool) {
+	if b == nil {
+		return 0, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+	if b.tokens-1 < -b.maxDebt {
+		return 0, false
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	// The bucket is in use until the reserved token is
+	b.lastUsed = now.Add(delay)
+	return delay, true
+}
+
+// idleSince reports whether the bucket was not used since the given time, its tokens are then back to burst
+// as long as the idle time covers a full refill
+func (b *tokenBucket) idleSince(t time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lastUsed.Before(t)
+}
+
+// keyRateLimiter holds the outbound token bucket of each key, buckets of keys without broadcast for idleTTL are
+// evicted so that short-lived keys don't accumulate
+type keyRateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	idleTTL   time.Duration
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newKeyRateLimiter returns nil when rate is not positive
+func newKeyRateLimiter(rate float64, burst int) *keyRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	probe := newTokenBucket(rate, burst)
+	// An idle bucket is refilled after burst/rate, it can then be recreated without changing the limit
+	idleTTL := max(time.Minute, time.Duration(probe.burst/rate*float64(time.Second)))
+	return &keyRateLimiter{
+		rate:      rate,
+		burst:     burst,
+		idleTTL:   idleTTL,
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// bucket returns the token bucket of the key, nil when the limiter is disabled
+func (l *keyRateLimiter) bucket(key string) *tokenBucket {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep evicts the buckets of idle keys, at most once per idleTTL
+func (l *keyRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.idleSince(now.Add(-l.idleTTL)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// waitFor waits for the delay of a reserved token, returns false when done is closed first
+func waitFor(delay time.Duration, done <-chan struct{}) bool {
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// applyRateLimit takes a token of the bucket for a message of the connection, returns false when the message is
+// dropped, the caller closes the connection under RateLimitPolicyClose, see closeRateLimited.
+// Under RateLimitPolicyDelay it waits for the token and returns false once the connection is closed, or when the
+// delay would exceed the bound of the bucket in which case the message is dropped
+func (c *WebSocketConnection) applyRateLimit(b *tokenBucket, policy RateLimitPolicy, limit MetricLabelValue) bool {
+	if b == nil {
+		return true
+	}
+
+	if policy == RateLimitPolicyDelay {
+		delay, ok := b.reserve()
+		if !ok {
+			c.onRateLimited(limit, RateLimitPolicyDrop)
+			return false
+		}
+		if delay > 0 {
+			c.onRateLimited(limit, policy)
+		}
+		return waitFor(delay, c.CloseChan)
+	}
+
+	if b.allow() {
+		return true
+	}
+	c.onRateLimited(limit, policy)
+	return false
+}
+
+// closeRateLimited closes a connection that exceeded a rate limit under RateLimitPolicyClose. Writing the close frame
+// can take up to writeWait, callers holding locks run it in its own goroutine
+func (c *WebSocketConnection) closeRateLimited(limit MetricLabelValue) {
+	slog.Warn("WebSocket rate limit exceeded, closing connection", "limit", limit, "key", c.Key,
+		"metadata", c.Metadata)
+	_ = c.closeWithCode(websocket.ClosePolicyViolation, "rate limit exceeded", DisconnectReasonRateLimited)
+}
+
+// applyKeyRateLimit takes a token of the outbound limit of the key for a broadcast, it must be called without
+// holding the broadcast lock of the key. Under RateLimitPolicyDelay it waits for the token when wait is set and drops
+// the broadcast otherwise, e.g. on the receive path of the redis_pubsub backend which must not stall.
+// Returns ErrRateLimited along with the dropped broadcast to report, the selected connections are closed in the
+// background under RateLimitPolicyClose. Returns the error of ctx when it is done while delayed
+func (m *webSocketManager) applyKeyRateLimit(ctx context.Context, key string, optionalParam BroadcastOptionalParams,
+	wait bool) (dropped enqueuedBroadcast, err error) {
+	b := m.keyRateLimiter.bucket(key)
+	if b == nil {
+		return enqueuedBroadcast{}, nil
+	}
+	// Broadcasts selecting no connection don't take a token
+	conns := m.connections.snapshot(key)
+	if len(conns) == 0 {
+		return enqueuedBroadcast{}, nil
+	}
+	dropped.route = conns[0].Route
+	conns = slices.DeleteFunc(conns, func(c *WebSocketConnection) bool { return !optionalParam.selects(c) })
+	dropped.fanOut = len(conns)
+	if len(conns) == 0 {
+		return enqueuedBroadcast{}, nil
+	}
+
+	policy := m.outboundRateLimitPolicy()
+	if policy == RateLimitPolicyDelay && wait {
+		if delay, ok := b.reserve(); ok {
+			if delay > 0 {
+				m.metric.rateLimited(dropped.route, RateLimitOutboundKey, policy)
+			}
+			if !waitFor(delay, ctx.Done()) {
+				return m.dropRateLimited(dropped, conns, ctx.Err())
+			}
+			return enqueuedBroadcast{}, nil
+		}
+	} else if b.allow() {
+		return enqueuedBroadcast{}, nil
+	}
+	// Broadcasts that would be delayed beyond the bound of the bucket are dropped
+	if policy == RateLimitPolicyDelay {
+		policy = RateLimitPolicyDrop
+	}
+	m.metric.rateLimited(dropped.route, RateLimitOutboundKey, policy)
+	if policy == RateLimitPolicyClose {
+		slog.Warn("WebSocket rate limit of key exceeded, closing its connections", "key", key)
+		for _, c := range conns {
+			go c.closeRateLimited(RateLimitOutboundKey)
+		}
+	}
+	return m.dropRateLimited(dropped, conns, ErrRateLimited)
+}
+
+func (m *webSocketManager) dropRateLimited(dropped enqueuedBroadcast, conns []*WebSocketConnection,
+	err error) (enqueuedBroadcast, error) {
+	for _, c := range conns {
+		m.metric.sendFailed(c.Route, SendErrorRateLimited)
+	}
+	dropped.err = err
+	return dropped, err
+}
+
+// outboundRateLimitPolicy and inboundRateLimitPolicy default to the envconfig defaults for configs built in code
+func (cfg WebSocketConfig) outboundRateLimitPolicy() RateLimitPolicy {
+	return cmp.Or(cfg.OutboundRateLimitPolicy, RateLimitPolicyDelay)
+}
+
+func (cfg WebSocketConfig) inboundRateLimitPolicy() RateLimitPolicy {
+	return cmp.Or(cfg.InboundRateLimitPolicy, RateLimitPolicyClose)
+}
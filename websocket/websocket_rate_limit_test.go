@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var unlimited *tokenBucket
+	assert.True(t, unlimited.allow())
+	delay, ok := unlimited.reserve()
+	assert.True(t, ok)
+	assert.Zero(t, delay)
+	assert.Nil(t, newTokenBucket(0, 10))
+
+	b := newTokenBucket(10, 2)
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+
+	// The reservations of a drained bucket are spaced by 1/rate
+	delay, ok = b.reserve()
+	assert.True(t, ok)
+	assert.InDelta(t, 100*time.Millisecond, delay, float64(10*time.Millisecond))
+	delay, _ = b.reserve()
+	assert.InDelta(t, 200*time.Millisecond, delay, float64(10*time.Millisecond))
+
+	// A bucket is in use until its reserved tokens are
+	assert.False(t, b.idleSince(time.Now().Add(100*time.Millisecond)))
+}
+
+func TestTokenBucketBoundsDelays(t *testing.T) {
+	// Delays are bounded by a second worth of messages
+	b := newTokenBucket(2, 1)
+	assert.True(t, b.allow())
+	for _, expected := range []time.Duration{500 * time.Millisecond, time.Second} {
+		delay, ok := b.reserve()
+		require.True(t, ok)
+		assert.InDelta(t, expected, delay, float64(10*time.Millisecond))
+	}
+	_, ok := b.reserve()
+	assert.False(t, ok)
+
+	// or by a burst worth of messages when it is longer
+	b = newTokenBucket(1, 3)
+	for range 6 {
+		_, ok := b.reserve()
+		require.True(t, ok)
+	}
+	_, ok = b.reserve()
+	assert.False(t, ok)
+}
+
+func TestWebSocketManagerRateLimits(t *testing.T) {
+	baseCfg := WebSocketConfig{
+		PingInterval:  time.Minute,
+		PongWait:      time.Minute,
+		WriteWait:     time.Second,
+		SendQueueSize: 8,
+	}
+	ctx := context.Background()
+
+	t.Run(
+		"outbound messages over the connection limit are dropped", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerConnection = 0.001
+			cfg.OutboundRateLimitBurstPerConnection = 1
+			cfg.OutboundRateLimitPolicy = RateLimitPolicyDrop
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+			c := m.RegisterConnection("key", Metadata{}, serverConn)
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"n":1}`))
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.DeliveredCount)
+			assertReply(t, clientConn, `{"n":1}`)
+
+			result, err = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"n":2}`))
+			assert.ErrorIs(t, err, ErrRateLimited)
+			assert.Equal(t, 0, result.DeliveredCount)
+			assert.ErrorIs(t, c.Send([]byte(`{}`)), ErrRateLimited)
+
+			select {
+			case <-c.CloseChan:
+				t.Fatal("connection closed under the drop policy")
+			default:
+			}
+		},
+	)
+
+	t.Run(
+		"outbound messages over the connection limit close the connection", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerConnection = 0.001
+			cfg.OutboundRateLimitBurstPerConnection = 1
+			cfg.OutboundRateLimitPolicy = RateLimitPolicyClose
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+			c := m.RegisterConnection("key", Metadata{}, serverConn)
+
+			require.NoError(t, c.Send([]byte(`{}`)))
+			assertReply(t, clientConn, `{}`)
+			assert.ErrorIs(t, c.Send([]byte(`{}`)), ErrRateLimited)
+
+			_, _, err := clientConn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonRateLimited, c.CloseReason())
+		},
+	)
+
+	t.Run(
+		"outbound messages over the connection limit are delayed", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerConnection = 20
+			cfg.OutboundRateLimitBurstPerConnection = 1
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+
+			startedAt := time.Now()
+			for range 3 {
+				result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+				require.NoError(t, err)
+				assert.Equal(t, 1, result.DeliveredCount)
+			}
+			for range 3 {
+				assertReply(t, clientConn, `{}`)
+			}
+			assert.GreaterOrEqual(t, time.Since(startedAt), 90*time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"broadcasts over the key limit are dropped", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerKey = 0.001
+			cfg.OutboundRateLimitBurstPerKey = 1
+			cfg.OutboundRateLimitPolicy = RateLimitPolicyDrop
+			m := ProvideDefaultWebSocketManager(cfg)
+			for range 2 {
+				serverConn, _ := newTestConnPair(t)
+				m.RegisterConnection("key", Metadata{}, serverConn)
+			}
+			serverConn, _ := newTestConnPair(t)
+			m.RegisterConnection("other-key", Metadata{}, serverConn)
+
+			result, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.DeliveredCount)
+
+			result, err = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			assert.ErrorIs(t, err, ErrRateLimited)
+			assert.Equal(t, 0, result.DeliveredCount)
+
+			// Each key has its own bucket
+			result, err = m.BroadcastPayloadToLocalSubscribers(ctx, "other-key", []byte(`{}`))
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.DeliveredCount)
+		},
+	)
+
+	t.Run(
+		"broadcasts over the key limit close the connections of the key", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerKey = 0.001
+			cfg.OutboundRateLimitBurstPerKey = 1
+			cfg.OutboundRateLimitPolicy = RateLimitPolicyClose
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+			c := m.RegisterConnection("key", Metadata{}, serverConn)
+
+			_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			require.NoError(t, err)
+			assertReply(t, clientConn, `{}`)
+
+			_, err = m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			assert.ErrorIs(t, err, ErrRateLimited)
+			_, _, err = clientConn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonRateLimited, c.CloseReason())
+		},
+	)
+
+	t.Run(
+		"broadcasts delayed by the key limit don't hold the broadcast lock of the key", func(t *testing.T) {
+			cfg := baseCfg
+			cfg.OutboundRateLimitPerKey = 0.001
+			cfg.OutboundRateLimitBurstPerKey = 1
+			m := ProvideDefaultWebSocketManager(cfg).(*webSocketManager)
+			serverConn, _ := newTestConnPair(t)
+			m.RegisterConnection("key", Metadata{}, serverConn)
+			_, err := m.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			require.NoError(t, err)
+
+			delayedCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				_, err := m.BroadcastPayloadToLocalSubscribers(delayedCtx, "key", []byte(`{}`))
+				done <- err
+			}()
+
+			// The delayed broadcast waits for its token without holding back the resumes and broadcasts of the key
+			locked := make(chan struct{})
+			go func() {
+				m.connections.lockBroadcast("key")()
+				close(locked)
+			}()
+			select {
+			case <-locked:
+			case err := <-done:
+				t.Fatalf("broadcast was not delayed: %v", err)
+			case <-time.After(time.Second):
+				t.Fatal("the broadcast lock of the key is held while the broadcast is delayed")
+			}
+
+			cancel()
+			assert.ErrorIs(t, <-done, context.Canceled)
+		},
+	)
+
+	inboundTest := func(t *testing.T, policy RateLimitPolicy) (c *WebSocketConnection, clientConn *websocket.Conn,
+		handled *atomic.Int64) {
+		cfg := baseCfg
+		cfg.InboundRateLimitPerConnection = 0.001
+		cfg.InboundRateLimitBurstPerConnection = 1
+		cfg.InboundRateLimitPolicy = policy
+		m := ProvideDefaultWebSocketManager(cfg)
+		var serverConn *websocket.Conn
+		serverConn, clientConn = newTestConnPair(t)
+
+		handled = &atomic.Int64{}
+		c = m.RegisterConnection(
+			"key", Metadata{}, serverConn, WithInboundHandlers(
+				InboundHandlers{
+					"echo": func(_ context.Context, c *WebSocketConnection, payload json.RawMessage) error {
+						handled.Add(1)
+						return c.Send(payload)
+					},
+				},
+			),
+		)
+
+		for range 3 {
+			writeFrame(t, clientConn, `{"type":"echo","payload":{}}`)
+		}
+		return c, clientConn, handled
+	}
+
+	t.Run(
+		"inbound frames over the connection limit are dropped", func(t *testing.T) {
+			c, clientConn, handled := inboundTest(t, RateLimitPolicyDrop)
+
+			assertReply(t, clientConn, `{}`)
+			require.Never(t, func() bool { return handled.Load() > 1 }, 50*time.Millisecond, 10*time.Millisecond)
+			select {
+			case <-c.CloseChan:
+				t.Fatal("connection closed under the drop policy")
+			default:
+			}
+		},
+	)
+
+	t.Run(
+		"inbound frames over the connection limit close the connection", func(t *testing.T) {
+			c, _, handled := inboundTest(t, RateLimitPolicyClose)
+
+			<-c.CloseChan
+			assert.Equal(t, DisconnectReasonRateLimited, c.CloseReason())
+			// The handlers run off the read loop, the frame read before the close may not be handled anymore
+			assert.LessOrEqual(t, handled.Load(), int64(1))
+		},
+	)
+}
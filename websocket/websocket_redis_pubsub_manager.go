@@ -0,0 +1,466 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// ProvideWebSocketManager provides the WebSocketManager selected by WebSocketConfig.ManagerBackend,
+// redisClient is only needed by the redis_pubsub backend and may be nil otherwise
+func ProvideWebSocketManager(cfg WebSocketConfig, redisClient *redis.Client, metric *WebSocketMetric) (
+	WebSocketManager, func(), error,
+) {
+	switch cfg.ManagerBackend {
+	case ManagerBackendRedisPubSub:
+		if redisClient == nil {
+			return nil, func() {}, ErrMissingRedisClient
+		}
+		return NewRedisPubSubWebSocketManager(cfg, redisClient, metric)
+	default:
+		return newWebSocketManager(cfg, metric), func() {}, nil
+	}
+}
+
+// redisPubSubWebSocketManager delivers broadcasts across pods through Redis pub/sub.
+// Every pod subscribes to the broadcast channel of the keys it holds connections for, and to its own report channel.
+// A broadcast is published to the channel of its key, each receiving pod delivers to its local connections
+// and publishes a delivery report back to the report channel of the publishing pod
+type redisPubSubWebSocketManager struct {
+	local         *webSocketManager
+	redisClient   *redis.Client
+	replay        *redisReplayStore // nil when the replay buffer is disabled, the local manager replays from it
+	pubSub        *redis.PubSub
+	channelPrefix string
+	reportChannel string
+	reportTimeout time.Duration
+
+	// subscriptionLocks serialize the subscriptions to the channel of each key, subscriptionsMu only guards the map
+	subscriptionLocks *keyLocks
+	subscriptionsMu   sync.Mutex
+	subscriptions     map[string]int // Number of local connections per key, the key channel is subscribed while positive
+
+	pendingMu sync.Mutex
+	pending   map[string]*pendingBroadcast // Broadcasts published by this pod waiting for reports, by broadcast ID
+}
+
+// pubSubBroadcast is published to the broadcast channel of a key
+type pubSubBroadcast struct {
+	BroadcastID string `json:"broadcast_id"`
+	ReplyTo     string `json:"reply_to"`
+	Payload     []byte `json:"payload"`
+	// Seq is assigned when publishing, see appendAndPublish, the receiving pods stamp the payload with it.
+	// 0 when not sequenced
+	Seq uint64 `json:"seq,omitempty"`
+	// Match selects the connections the payload is delivered to, nil delivers to every connection of the key
+	Match *MetadataMatch `json:"match,omitempty"`
+}
+
+// deliveryReport is published by each pod that received a pubSubBroadcast
+type deliveryReport struct {
+	BroadcastID     string `json:"broadcast_id"`
+	DeliveredCount  int    `json:"delivered"`
+	OverflowedCount int    `json:"overflowed"`
+	AckedCount      int    `json:"acked,omitempty"`
+	UnackedCount    int    `json:"unacked,omitempty"`
+	Redelivered     int    `json:"redelivered,omitempty"`
+	Error           string `json:"error,omitempty"`
+
+	Connections []ConnectionDeliveryReport `json:"connections,omitempty"`
+}
+
+// NewRedisPubSubWebSocketManager subscribes to the report channel of this pod and starts receiving broadcasts.
+// Returns the manager and a cleanup function closing the subscription
+func NewRedisPubSubWebSocketManager(cfg WebSocketConfig, redisClient *redis.Client, metric *WebSocketMetric) (
+	WebSocketManager, func(), error,
+) {
+	m := &redisPubSubWebSocketManager{
+		local:             newWebSocketManager(cfg, metric),
+		redisClient:       redisClient,
+		channelPrefix:     cfg.RedisPubSubChannelPrefix,
+		reportChannel:     fmt.Sprintf("%s:report:%s", cfg.RedisPubSubChannelPrefix, uuid.NewString()),
+		reportTimeout:     cfg.RedisPubSubReportTimeout,
+		subscriptionLocks: newKeyLocks(),
+		subscriptions:     map[string]int{},
+		pending:           map[string]*pendingBroadcast{},
+	}
+	m.local.observer = m
+	// Sequence numbers and replay buffers are shared by the pods through Redis
+	if cfg.ReplayBufferSize > 0 {
+		m.replay = newRedisReplayStore(
+			redisClient, cfg.RedisPubSubChannelPrefix, cfg.ReplayBufferSize, cfg.ReplayBufferTTL,
+		)
+		m.local.replay = m.replay
+	}
+
+	ctx := context.Background()
+	m.pubSub = redisClient.Subscribe(ctx, m.reportChannel)
+	// Wait for the subscription confirmation so that no report is missed
+	if _, err := m.pubSub.Receive(ctx); err != nil {
+		_ = m.pubSub.Close()
+		return nil, func() {}, fmt.Errorf("failed to subscribe to WebSocket report channel: %w", err)
+	}
+
+	go m.receive()
+
+	cleanup := func() {
+		if err := m.pubSub.Close(); err != nil {
+			slog.Error("failed to close WebSocket Redis subscription", "error", err)
+		}
+	}
+	return m, cleanup, nil
+}
+
+// RegisterConnection registers the connection locally, this pod subscribes to the broadcast channel of every key
+// the connection joins through connectionJoined
+func (m *redisPubSubWebSocketManager) RegisterConnection(key string, metadata Metadata,
+	conn *websocket.Conn, opts ...ConnectionOptions) *WebSocketConnection {
+	return m.local.RegisterConnection(key, metadata, conn, opts...)
+}
+
+func (m *redisPubSubWebSocketManager) RegisterTransport(key string, metadata Metadata,
+	transport Transport, opts ...ConnectionOptions) *WebSocketConnection {
+	return m.local.RegisterTransport(key, metadata, transport, opts...)
+}
+
+// AdmitConnection checks the limits of this pod only, connections of other pods are not counted
+func (m *redisPubSubWebSocketManager) AdmitConnection(key string, metadata Metadata) error {
+	return m.local.AdmitConnection(key, metadata)
+}
+
+func (m *redisPubSubWebSocketManager) UnregisterConnection(key string, predicate ConnectionPredicate) {
+	m.local.UnregisterConnection(key, predicate)
+}
+
+func (m *redisPubSubWebSocketManager) UnregisterConnectionByID(key string, connectionID string) {
+	m.local.UnregisterConnectionByID(key, connectionID)
+}
+
+// BroadcastPayloadToLocalSubscribers publishes the payload to the subscribers of the key on every pod.
+// The result aggregates the delivery reports of the pods, returns ErrDeliveryReportTimeout
+// if some pods did not report in time and ErrRemoteBroadcastFailed if some pods failed to deliver.
+// Only the metadata filters are sent to the other pods, WithConnectionFilter returns ErrUnsupportedBroadcastFilter
+func (m *redisPubSubWebSocketManager) BroadcastPayloadToLocalSubscribers(ctx context.Context, key string,
+	message []byte, opts ...BroadcastOptions) (result BroadcastResult, err error) {
+	optionalParam := bindBroadcastOptions(opts...)
+	if optionalParam.Filter != nil {
+		return BroadcastResult{}, ErrUnsupportedBroadcastFilter
+	}
+
+	message = wrapBroadcast(message, optionalParam)
+	broadcast := pubSubBroadcast{
+		BroadcastID: uuid.NewString(),
+		ReplyTo:     m.reportChannel,
+		Payload:     message,
+	}
+	if !optionalParam.Match.isEmpty() {
+		broadcast.Match = &optionalParam.Match
+	}
+
+	// Track the broadcast before publishing since reports may arrive before PUBLISH returns
+	pending := newPendingBroadcast()
+	m.pendingMu.Lock()
+	m.pending[broadcast.BroadcastID] = pending
+	m.pendingMu.Unlock()
+	defer func() {
+		m.pendingMu.Lock()
+		delete(m.pending, broadcast.BroadcastID)
+		m.pendingMu.Unlock()
+	}()
+
+	// PUBLISH returns the number of pods subscribed to the key, which is the number of reports to wait for
+	receivers, err := m.publish(ctx, key, broadcast)
+	if err != nil {
+		return BroadcastResult{}, fmt.Errorf("failed to publish WebSocket broadcast: %w", err)
+	}
+	if receivers == 0 {
+		slog.Debug("no pods subscribed to key", "key", key)
+		return BroadcastResult{}, nil
+	}
+	pending.expect(int(receivers))
+
+	timer := time.NewTimer(m.reportTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-pending.done:
+		return pending.result()
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	result, err = pending.result()
+	return result, errors.Join(err, ErrDeliveryReportTimeout)
+}
+
+// publish publishes the broadcast to the channel of the key, sequencing it when the replay buffer is enabled.
+// The sequence number is assigned along with the PUBLISH so that the pods receive the broadcasts in sequence order
+func (m *redisPubSubWebSocketManager) publish(ctx context.Context, key string, broadcast pubSubBroadcast) (
+	int64, error,
+) {
+	if m.replay != nil && isJSONObject(broadcast.Payload) {
+		return m.replay.appendAndPublish(ctx, key, m.broadcastChannel(key), broadcast)
+	}
+
+	data, err := json.Marshal(broadcast)
+	if err != nil {
+		return 0, err
+	}
+	return m.redisClient.Publish(ctx, m.broadcastChannel(key), data).Result()
+}
+
+func (m *redisPubSubWebSocketManager) Subscribe(c *WebSocketConnection, key string) error {
+	return m.local.Subscribe(c, key)
+}
+
+func (m *redisPubSubWebSocketManager) Unsubscribe(c *WebSocketConnection, key string) error {
+	return m.local.Unsubscribe(c, key)
+}
+
+func (m *redisPubSubWebSocketManager) CloseAll(code int, reason string) {
+	m.local.CloseAll(code, reason)
+}
+
+// Drain only drains the connections of this pod, the other pods keep delivering broadcasts to theirs
+func (m *redisPubSubWebSocketManager) Drain(ctx context.Context) {
+	m.local.Drain(ctx)
+}
+
+func (m *redisPubSubWebSocketManager) IsDraining() bool {
+	return m.local.IsDraining()
+}
+
+// ListKeys only lists the keys with connections on this pod
+func (m *redisPubSubWebSocketManager) ListKeys() []KeyConnections {
+	return m.local.ListKeys()
+}
+
+func (m *redisPubSubWebSocketManager) ListConnections(key string) []ConnectionInfo {
+	return m.local.ListConnections(key)
+}
+
+func (m *redisPubSubWebSocketManager) CloseConnections(key string, predicate ConnectionPredicate, code int,
+	reason string) int {
+	return m.local.CloseConnections(key, predicate, code, reason)
+}
+
+func (m *redisPubSubWebSocketManager) broadcastChannel(key string) string {
+	return fmt.Sprintf("%s:broadcast:%s", m.channelPrefix, key)
+}
+
+// connectionJoined subscribes this pod to the broadcast channel of the key, see keyObserver
+func (m *redisPubSubWebSocketManager) connectionJoined(key string) error {
+	if err := m.subscribe(key); err != nil {
+		return fmt.Errorf("failed to subscribe to WebSocket broadcast channel: %w", err)
+	}
+	return nil
+}
+
+// connectionLeft unsubscribes this pod from the broadcast channel once the last local connection of the key is gone
+func (m *redisPubSubWebSocketManager) connectionLeft(key string) {
+	if err := m.unsubscribe(key); err != nil {
+		slog.Error("failed to unsubscribe from WebSocket broadcast channel", "error", err, "key", key)
+	}
+}
+
+// subscribe subscribes this pod to the broadcast channel of the key when it gets its first local connection.
+// The connection is only counted once the subscription succeeded, so that the next connection retries it
+func (m *redisPubSubWebSocketManager) subscribe(key string) error {
+	unlock := m.subscriptionLocks.lock(key)
+	defer unlock()
+
+	if m.subscriptionCount(key) == 0 {
+		if err := m.pubSub.Subscribe(context.Background(), m.broadcastChannel(key)); err != nil {
+			return err
+		}
+	}
+
+	m.subscriptionsMu.Lock()
+	defer m.subscriptionsMu.Unlock()
+	m.subscriptions[key]++
+	return nil
+}
+
+// unsubscribe unsubscribes this pod from the broadcast channel of the key once its last local connection is gone
+func (m *redisPubSubWebSocketManager) unsubscribe(key string) error {
+	unlock := m.subscriptionLocks.lock(key)
+	defer unlock()
+
+	m.subscriptionsMu.Lock()
+	m.subscriptions[key]--
+	last := m.subscriptions[key] <= 0
+	if last {
+		delete(m.subscriptions, key)
+	}
+	m.subscriptionsMu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return m.pubSub.Unsubscribe(context.Background(), m.broadcastChannel(key))
+}
+
+func (m *redisPubSubWebSocketManager) subscriptionCount(key string) int {
+	m.subscriptionsMu.Lock()
+	defer m.subscriptionsMu.Unlock()
+
+	return m.subscriptions[key]
+}
+
+// receive handles the broadcasts and reports received by this pod until the subscription is closed
+func (m *redisPubSubWebSocketManager) receive() {
+	broadcastChannelPrefix := m.broadcastChannel("")
+
+	for msg := range m.pubSub.Channel() {
+		if msg.Channel == m.reportChannel {
+			m.handleReport(msg.Payload)
+			continue
+		}
+
+		key, ok := strings.CutPrefix(msg.Channel, broadcastChannelPrefix)
+		if !ok {
+			continue
+		}
+		// Broadcasts are delivered in the order they are received to keep the message order of each key
+		m.handleBroadcast(key, msg.Payload)
+	}
+}
+
+func (m *redisPubSubWebSocketManager) handleBroadcast(key string, data string) {
+	var broadcast pubSubBroadcast
+	if err := json.Unmarshal([]byte(data), &broadcast); err != nil {
+		slog.Error("failed to unmarshal WebSocket broadcast", "error", err, "key", key)
+		return
+	}
+
+	// Enqueued in the order broadcasts are received, acks are awaited in the background
+	startedAt := time.Now()
+	var optionalParam BroadcastOptionalParams
+	if broadcast.Match != nil {
+		optionalParam.Match = *broadcast.Match
+	}
+	payload := broadcast.Payload
+	// Sequenced broadcasts are published unstamped, see redisReplayStore.appendAndPublish
+	if broadcast.Seq != 0 {
+		payload, _ = stampSequence(payload, broadcast.Seq)
+	}
+	// The receive loop must not stall, the broadcasts over the key rate limit are dropped rather than delayed
+	enqueued, err := m.local.applyKeyRateLimit(context.Background(), key, optionalParam, false)
+	if err == nil {
+		enqueued = m.local.enqueueSequenced(context.Background(), key, payload, broadcast.Seq, optionalParam)
+	}
+
+	go func() {
+		result, err := m.local.awaitAcks(context.Background(), enqueued)
+		m.local.metric.broadcastCompleted(context.Background(), enqueued.route, enqueued.fanOut, startedAt)
+		report := deliveryReport{
+			BroadcastID:     broadcast.BroadcastID,
+			DeliveredCount:  result.DeliveredCount,
+			OverflowedCount: result.OverflowedCount,
+			AckedCount:      result.AckedCount,
+			UnackedCount:    result.UnackedCount,
+			Redelivered:     result.RedeliveredCount,
+			Connections:     result.Connections,
+		}
+		if err != nil {
+			report.Error = err.Error()
+		}
+
+		reportData, err := json.Marshal(report)
+		if err != nil {
+			slog.Error("failed to marshal WebSocket delivery report", "error", err, "key", key)
+			return
+		}
+
+		if err := m.redisClient.Publish(context.Background(), broadcast.ReplyTo, reportData).Err(); err != nil {
+			slog.Error("failed to publish WebSocket delivery report", "error", err, "key", key)
+		}
+	}()
+}
+
+// MulticastPayloadToLocalSubscribers broadcasts the payload to each key on every pod, see BroadcastPayloadToLocalSubscribers
+func (m *redisPubSubWebSocketManager) MulticastPayloadToLocalSubscribers(ctx context.Context, keys []string,
+	message []byte, opts ...BroadcastOptions) (MulticastResult, error) {
+	return Multicast(ctx, m.BroadcastPayloadToLocalSubscribers, m.local.MulticastParallelism, keys, message, opts...)
+}
+
+func (m *redisPubSubWebSocketManager) handleReport(data string) {
+	var report deliveryReport
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		slog.Error("failed to unmarshal WebSocket delivery report", "error", err)
+		return
+	}
+
+	m.pendingMu.Lock()
+	pending, ok := m.pending[report.BroadcastID]
+	m.pendingMu.Unlock()
+
+	// The broadcast may have timed out already
+	if ok {
+		pending.add(report)
+	}
+}
+
+// pendingBroadcast aggregates the delivery reports of a broadcast, done is closed once every expected report arrived
+type pendingBroadcast struct {
+	mu       sync.Mutex
+	expected int // Unknown until PUBLISH returns
+	received int
+	reports  BroadcastResult
+	errs     []error
+	done     chan struct{}
+	closed   bool
+}
+
+func newPendingBroadcast() *pendingBroadcast {
+	return &pendingBroadcast{done: make(chan struct{})}
+}
+
+func (p *pendingBroadcast) expect(expected int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expected = expected
+	p.closeIfComplete()
+}
+
+func (p *pendingBroadcast) add(report deliveryReport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.received++
+	p.reports.DeliveredCount += report.DeliveredCount
+	p.reports.OverflowedCount += report.OverflowedCount
+	p.reports.AckedCount += report.AckedCount
+	p.reports.UnackedCount += report.UnackedCount
+	p.reports.RedeliveredCount += report.Redelivered
+	p.reports.Connections = append(p.reports.Connections, report.Connections...)
+	if report.Error != "" {
+		p.errs = append(p.errs, fmt.Errorf("%w: %s", ErrRemoteBroadcastFailed, report.Error))
+	}
+	p.closeIfComplete()
+}
+
+func (p *pendingBroadcast) closeIfComplete() {
+	// More reports than expected arrive when a pod subscribes to the key while the broadcast is published
+	if !p.closed && p.expected > 0 && p.received >= p.expected {
+		p.closed = true
+		close(p.done)
+	}
+}
+
+func (p *pendingBroadcast) result() (BroadcastResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.reports, errors.Join(p.errs...)
+}
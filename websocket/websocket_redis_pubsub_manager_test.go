@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingBroadcast(t *testing.T) {
+	t.Run(
+		"completes once every expected report arrived", func(t *testing.T) {
+			p := newPendingBroadcast()
+			// Reports may arrive before the number of receivers is known
+			p.add(deliveryReport{DeliveredCount: 2, OverflowedCount: 1})
+			p.expect(2)
+			assert.False(t, isDone(p))
+
+			p.add(deliveryReport{DeliveredCount: 3})
+			assert.True(t, isDone(p))
+
+			result, err := p.result()
+			assert.NoError(t, err)
+			assert.Equal(t, BroadcastResult{DeliveredCount: 5, OverflowedCount: 1}, result)
+
+			// Late reports are still aggregated without closing done twice
+			p.add(deliveryReport{DeliveredCount: 1})
+			result, _ = p.result()
+			assert.Equal(t, 6, result.DeliveredCount)
+		},
+	)
+
+	t.Run(
+		"reports the failures of remote pods", func(t *testing.T) {
+			p := newPendingBroadcast()
+			p.expect(2)
+			p.add(deliveryReport{DeliveredCount: 1, Connections: []ConnectionDeliveryReport{{ConnectionID: "c1"}}})
+			p.add(
+				deliveryReport{
+					DeliveredCount: 1,
+					Error:          "send queue full",
+					Connections: []ConnectionDeliveryReport{
+						{ConnectionID: "c2"}, {ConnectionID: "c3", Error: "send queue full"},
+					},
+				},
+			)
+
+			result, err := p.result()
+			assert.ErrorIs(t, err, ErrRemoteBroadcastFailed)
+			assert.Equal(t, 2, result.DeliveredCount)
+			assert.Equal(
+				t, []ConnectionDeliveryReport{
+					{ConnectionID: "c1"}, {ConnectionID: "c2"}, {ConnectionID: "c3", Error: "send queue full"},
+				}, result.Connections,
+			)
+		},
+	)
+}
+
+func isDone(p *pendingBroadcast) bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisReplayStore keeps the replay buffers in Redis so that every pod of the redis_pubsub backend shares
+// the sequence numbers and buffers of a key. Each buffer is a sorted set of the replayEntry of the stamped payloads
+// scored by sequence number
+type redisReplayStore struct {
+	redisClient *redis.Client
+	keyPrefix   string
+	size        int
+	ttl         time.Duration
+}
+
+func newRedisReplayStore(redisClient *redis.Client, keyPrefix string, size int, ttl time.Duration) *redisReplayStore {
+	return &redisReplayStore{
+		redisClient: redisClient,
+		keyPrefix:   keyPrefix,
+		size:        size,
+		ttl:         ttl,
+	}
+}
+
+// replayEntry is a member of a Redis replay buffer
+type replayEntry struct {
+	Payload json.RawMessage `json:"payload"`
+	Match   *MetadataMatch  `json:"match,omitempty"`
+}
+
+func (s *redisReplayStore) Append(ctx context.Context, key string, payload []byte, match MetadataMatch) (
+	uint64, []byte, error,
+) {
+	if !isJSONObject(payload) {
+		return 0, payload, nil
+	}
+
+	var kept *MetadataMatch
+	if !match.isEmpty() {
+		kept = &match
+	}
+	afterSeq, encodedMatch, err := replayScriptArgs(payload, kept)
+	if err != nil {
+		return 0, payload, fmt.Errorf("failed to keep payload for replay: %w", err)
+	}
+
+	seq, err := appendScript.Run(
+		ctx, s.redisClient, []string{s.seqKey(key), s.bufferKey(key)},
+		afterSeq, encodedMatch, s.size, s.ttl.Milliseconds(),
+	).Uint64()
+	if err != nil {
+		return 0, payload, fmt.Errorf("failed to keep payload for replay: %w", err)
+	}
+
+	stamped, _ := stampSequence(payload, seq)
+	return seq, stamped, nil
+}
+
+// appendLua assigns the next sequence number of the key and keeps the stamped payload in the replay buffer, in the
+// same script so that a sequence number is never assigned without being kept.
+// The sequence counter never expires so that sequence numbers keep increasing after the buffer expired.
+// KEYS: sequence counter, replay buffer. ARGV: the stamped payload after its "seq" value, match or "",
+// buffer size, buffer TTL in milliseconds
+const appendLua = `
+local seq = redis.call('INCR', KEYS[1])
+local member = '{"payload":{"seq":' .. string.format('%d', seq) .. ARGV[1]
+if ARGV[2] ~= '' then
+	member = member .. ',"match":' .. ARGV[2]
+end
+redis.call('ZADD', KEYS[2], seq, member .. '}')
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[3]) - 1)
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+`
+
+// appendScript runs appendLua, returns the seq
+var appendScript = redis.NewScript(appendLua + `return seq`)
+
+// appendAndPublishScript runs appendLua and publishes the broadcast in the same step, so that the broadcasts of a key
+// reach every pod in sequence order. ARGV, after the ones of appendLua: channel, broadcast message without "seq".
+// Returns the seq and the receivers
+var appendAndPublishScript = redis.NewScript(
+	appendLua + `
+local receivers = redis.call('PUBLISH', ARGV[5], '{"seq":' .. string.format('%d', seq) .. ',' .. string.sub(ARGV[6], 2))
+return {seq, receivers}
+`,
+)
+
+// replayScriptArgs returns the arguments of appendLua: the payload after its "seq" value, which the script stamps,
+// and the encoded match or nil
+func replayScriptArgs(payload []byte, match *MetadataMatch) (afterSeq []byte, encodedMatch []byte, err error) {
+	// The placeholder value is replaced by the sequence number in the script
+	placeholder, ok := injectField(payload, "seq", nil)
+	if !ok {
+		return nil, nil, fmt.Errorf("payload is not a JSON object")
+	}
+	if match != nil {
+		if encodedMatch, err = json.Marshal(match); err != nil {
+			return nil, nil, err
+		}
+	}
+	return placeholder[len(`{"seq":`):], encodedMatch, nil
+}
+
+// appendAndPublish stamps the payload of the broadcast with the next sequence number of the key, keeps it for replay
+// and publishes the broadcast to the channel, see appendAndPublishScript. The published payload is not stamped,
+// the receiving pods stamp it with the "seq" of the broadcast. Returns the number of pods that received it
+func (s *redisReplayStore) appendAndPublish(ctx context.Context, key string, channel string,
+	broadcast pubSubBroadcast) (receivers int64, err error) {
+	afterSeq, match, err := replayScriptArgs(broadcast.Payload, broadcast.Match)
+	if err != nil {
+		return 0, err
+	}
+	broadcast.Seq = 0
+	message, err := json.Marshal(broadcast)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := appendAndPublishScript.Run(
+		ctx, s.redisClient, []string{s.seqKey(key), s.bufferKey(key)},
+		afterSeq, match, s.size, s.ttl.Milliseconds(), channel, message,
+	).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	return res[1], nil
+}
+
+func (s *redisReplayStore) Since(ctx context.Context, key string, lastSeq uint64) ([]SequencedPayload, error) {
+	entries, err := s.redisClient.ZRangeByScoreWithScores(
+		ctx, s.bufferKey(key), &redis.ZRangeBy{
+			Min: "(" + strconv.FormatUint(lastSeq, 10),
+			Max: "+inf",
+		},
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay buffer: %w", err)
+	}
+
+	payloads := make([]SequencedPayload, 0, len(entries))
+	for _, entry := range entries {
+		member, _ := entry.Member.(string)
+		payload, err := decodeReplayEntry(uint64(entry.Score), []byte(member))
+		if err != nil {
+			slog.Warn("skipping undecodable replay buffer entry", "error", err, "key", key, "seq", payload.Seq)
+			continue
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+// decodeReplayEntry decodes a member of a replay buffer
+func decodeReplayEntry(seq uint64, member []byte) (SequencedPayload, error) {
+	payload := SequencedPayload{Seq: seq}
+	var entry replayEntry
+	if err := json.Unmarshal(member, &entry); err != nil {
+		return payload, err
+	}
+
+	payload.Payload = entry.Payload
+	if entry.Match != nil {
+		payload.Match = *entry.Match
+	}
+	return payload, nil
+}
+
+func (s *redisReplayStore) seqKey(key string) string {
+	return fmt.Sprintf("%s:seq:%s", s.keyPrefix, key)
+}
+
+func (s *redisReplayStore) bufferKey(key string) string {
+	return fmt.Sprintf("%s:replay:%s", s.keyPrefix, key)
+}
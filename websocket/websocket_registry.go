@@ -0,0 +1,218 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const registryShardCount = 32
+
+// connectionRegistry indexes connections by key and connection ID.
+// Keys are spread over lock-sharded maps so that registrations on different keys don't contend on the same lock
+type connectionRegistry struct {
+	shards [registryShardCount]registryShard
+
+	// broadcastLocks serialize the broadcasts and replays of each key, see lockBroadcast
+	broadcastLocks *keyLocks
+
+	// keysChanged is notified when a key gets its first connection or loses its last one, optional
+	keysChanged func(route string, delta int64)
+}
+
+type registryShard struct {
+	mu          sync.RWMutex
+	connections map[string]map[string]*WebSocketConnection // map[key]map[connectionID]*WebSocketConnection
+}
+
+func newConnectionRegistry() *connectionRegistry {
+	r := &connectionRegistry{broadcastLocks: newKeyLocks()}
+	for i := range r.shards {
+		r.shards[i].connections = make(map[string]map[string]*WebSocketConnection)
+	}
+	return r
+}
+
+func (r *connectionRegistry) shardFor(key string) *registryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &r.shards[h.Sum32()%registryShardCount]
+}
+
+// lockBroadcast keeps the broadcasts of the key in sequence order and prevents them from interleaving with a replay,
+// returns the unlock function. Broadcasts to other keys are not held back
+func (r *connectionRegistry) lockBroadcast(key string) (unlock func()) {
+	return r.broadcastLocks.lock(key)
+}
+
+// add registers the connection under the key it was registered with, see addUnder for the keys it subscribes to
+func (r *connectionRegistry) add(c *WebSocketConnection) {
+	r.addUnder(c.Key, c)
+}
+
+func (r *connectionRegistry) addUnder(key string, c *WebSocketConnection) {
+	shard := r.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	conns, ok := shard.connections[key]
+	if !ok {
+		conns = make(map[string]*WebSocketConnection)
+		shard.connections[key] = conns
+		r.notifyKeysChanged(c.Route, 1)
+	}
+	conns[c.ID] = c
+}
+
+func (r *connectionRegistry) notifyKeysChanged(route string, delta int64) {
+	if r.keysChanged != nil {
+		r.keysChanged(route, delta)
+	}
+}
+
+// remove deletes the connection with the given ID, returns nil when it is not registered under the key
+func (r *connectionRegistry) remove(key string, connectionID string) *WebSocketConnection {
+	shard := r.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	conns := shard.connections[key]
+	c, ok := conns[connectionID]
+	if !ok {
+		return nil
+	}
+
+	delete(conns, connectionID)
+	if len(conns) == 0 {
+		delete(shard.connections, key)
+		r.notifyKeysChanged(c.Route, -1)
+	}
+	return c
+}
+
+// removeMatching deletes and returns the connections of the key matching the predicate
+func (r *connectionRegistry) removeMatching(key string, predicate ConnectionPredicate) (removed []*WebSocketConnection) {
+	shard := r.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	conns := shard.connections[key]
+	for id, c := range conns {
+		if predicate(c) {
+			delete(conns, id)
+			removed = append(removed, c)
+		}
+	}
+
+	if len(conns) == 0 && len(removed) > 0 {
+		delete(shard.connections, key)
+		r.notifyKeysChanged(removed[0].Route, -1)
+	}
+	return
+}
+
+// snapshot returns the connections currently registered under the key, the slice is safe to use without holding locks
+func (r *connectionRegistry) snapshot(key string) []*WebSocketConnection {
+	shard := r.shardFor(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	conns := shard.connections[key]
+	res := make([]*WebSocketConnection, 0, len(conns))
+	for _, c := range conns {
+		res = append(res, c)
+	}
+	return res
+}
+
+// all returns every registered connection without removing them, connections registered under several keys once
+func (r *connectionRegistry) all() (res []*WebSocketConnection) {
+	seen := make(map[string]struct{})
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.RLock()
+		for _, conns := range shard.connections {
+			for id, c := range conns {
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				seen[id] = struct{}{}
+				res = append(res, c)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return
+}
+
+// counts returns the number of connections of every key
+func (r *connectionRegistry) counts() map[string]int {
+	res := make(map[string]int)
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.RLock()
+		for key, conns := range shard.connections {
+			res[key] = len(conns)
+		}
+		shard.mu.RUnlock()
+	}
+	return res
+}
+
+// drain removes and returns every registered connection, connections registered under several keys are returned
+// once per key
+func (r *connectionRegistry) drain() (removed []*WebSocketConnection) {
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.mu.Lock()
+		for _, conns := range shard.connections {
+			route := ""
+			for _, c := range conns {
+				removed = append(removed, c)
+				route = c.Route
+			}
+			r.notifyKeysChanged(route, -1)
+		}
+		shard.connections = make(map[string]map[string]*WebSocketConnection)
+		shard.mu.Unlock()
+	}
+	return
+}
+
+// keyLocks hands out one mutex per key, a mutex is kept only while it is held or waited for
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int // Number of goroutines holding or waiting for mu, guarded by keyLocks.mu
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// lock locks the mutex of the key, returns the unlock function
+func (l *keyLocks) lock(key string) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
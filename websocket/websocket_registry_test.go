@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionRegistry(t *testing.T) {
+	t.Run(
+		"add, snapshot and remove by ID", func(t *testing.T) {
+			r := newConnectionRegistry()
+			first := NewWebSocketConnection("key", nil, Metadata{}, WebSocketConfig{})
+			second := NewWebSocketConnection("key", nil, Metadata{}, WebSocketConfig{})
+
+			r.add(first)
+			r.add(second)
+			assert.ElementsMatch(t, []*WebSocketConnection{first, second}, r.snapshot("key"))
+
+			assert.Same(t, first, r.remove("key", first.ID))
+			assert.Nil(t, r.remove("key", first.ID), "removing twice should be a no-op")
+			assert.Nil(t, r.remove("other-key", second.ID), "connection IDs are scoped by key")
+			assert.Equal(t, []*WebSocketConnection{second}, r.snapshot("key"))
+		},
+	)
+
+	t.Run(
+		"connections with identical metadata are kept apart", func(t *testing.T) {
+			r := newConnectionRegistry()
+			metadata := Metadata{"user_id": {"user-1"}}
+			r.add(NewWebSocketConnection("key", nil, metadata, WebSocketConfig{}))
+			r.add(NewWebSocketConnection("key", nil, metadata, WebSocketConfig{}))
+
+			assert.Len(t, r.snapshot("key"), 2)
+		},
+	)
+
+	t.Run(
+		"removeMatching and drain", func(t *testing.T) {
+			r := newConnectionRegistry()
+			keep := NewWebSocketConnection("key", nil, Metadata{"device": {"keep"}}, WebSocketConfig{})
+			drop := NewWebSocketConnection("key", nil, Metadata{"device": {"drop"}}, WebSocketConfig{})
+			other := NewWebSocketConnection("other-key", nil, Metadata{}, WebSocketConfig{})
+			r.add(keep)
+			r.add(drop)
+			r.add(other)
+
+			removed := r.removeMatching(
+				"key", func(c *WebSocketConnection) bool {
+					return c.Metadata["device"][0] == "drop"
+				},
+			)
+			assert.Equal(t, []*WebSocketConnection{drop}, removed)
+			assert.Equal(t, []*WebSocketConnection{keep}, r.snapshot("key"))
+
+			assert.ElementsMatch(t, []*WebSocketConnection{keep, other}, r.drain())
+			assert.Empty(t, r.snapshot("key"))
+			assert.Empty(t, r.snapshot("other-key"))
+		},
+	)
+}
+
+func TestKeyLocks(t *testing.T) {
+	l := newKeyLocks()
+	unlock := l.lock("key")
+
+	// Other keys are not held back by the lock of the key
+	l.lock("other-key")()
+
+	locked := make(chan struct{})
+	go func() {
+		defer l.lock("key")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the key should still be locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	<-locked
+	assert.Eventually(
+		t, func() bool {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return len(l.locks) == 0
+		}, time.Second, 10*time.Millisecond, "released locks should not be kept",
+	)
+}
+
+func TestConnectionRegistryConcurrentStress(t *testing.T) {
+	const (
+		keyCount       = 50
+		connsPerKey    = 100
+		snapshotWorker = 8
+	)
+
+	r := newConnectionRegistry()
+	conns := make([]*WebSocketConnection, 0, keyCount*connsPerKey)
+	for i := 0; i < keyCount*connsPerKey; i++ {
+		key := fmt.Sprintf("key-%d", i%keyCount)
+		conns = append(conns, NewWebSocketConnection(key, nil, Metadata{}, WebSocketConfig{}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var snapshots sync.WaitGroup
+	for w := 0; w < snapshotWorker; w++ {
+		snapshots.Add(1)
+		go func() {
+			defer snapshots.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				for _, c := range r.snapshot(fmt.Sprintf("key-%d", i%keyCount)) {
+					_ = c.ID
+				}
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	for _, c := range conns {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			r.add(c)
+		}()
+	}
+	writers.Wait()
+
+	for i := 0; i < keyCount; i++ {
+		require.Len(t, r.snapshot(fmt.Sprintf("key-%d", i)), connsPerKey)
+	}
+
+	// Remove half of the connections of every key concurrently
+	for i, c := range conns {
+		if (i/keyCount)%2 == 1 {
+			continue
+		}
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			assert.Same(t, c, r.remove(c.Key, c.ID))
+		}()
+	}
+	writers.Wait()
+
+	cancel()
+	snapshots.Wait()
+
+	for i := 0; i < keyCount; i++ {
+		assert.Len(t, r.snapshot(fmt.Sprintf("key-%d", i)), connsPerKey/2)
+	}
+}
+
+func TestWebSocketManagerConcurrentStress(t *testing.T) {
+	const (
+		keyCount    = 10
+		connsPerKey = 100
+		broadcasts  = 20
+	)
+
+	cfg := WebSocketConfig{
+		PingInterval:            time.Minute,
+		PongWait:                time.Minute,
+		WriteWait:               time.Second,
+		SendQueueSize:           connsPerKey * broadcasts,
+		SendQueueOverflowPolicy: OverflowPolicyDropNewest,
+	}
+	m := ProvideDefaultWebSocketManager(cfg)
+	t.Cleanup(func() { m.CloseAll(1001, "test finished") })
+
+	dial := newTestConnDialer(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	registered := make([]*WebSocketConnection, 0, keyCount*connsPerKey)
+
+	broadcastAll := func() {
+		defer wg.Done()
+		for i := 0; i < broadcasts; i++ {
+			_, _ = m.BroadcastPayloadToLocalSubscribers(ctx, fmt.Sprintf("key-%d", i%keyCount), []byte(`{}`))
+		}
+	}
+
+	// Connect while broadcasting
+	for i := 0; i < keyCount*connsPerKey; i++ {
+		serverConn, _ := dial()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := m.RegisterConnection(fmt.Sprintf("key-%d", i%keyCount), Metadata{}, serverConn)
+			mu.Lock()
+			registered = append(registered, c)
+			mu.Unlock()
+		}()
+		if i%connsPerKey == 0 {
+			wg.Add(1)
+			go broadcastAll()
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < keyCount; i++ {
+		result, err := m.BroadcastPayloadToLocalSubscribers(ctx, fmt.Sprintf("key-%d", i), []byte(`{}`))
+		require.NoError(t, err)
+		require.Equal(t, connsPerKey, result.DeliveredCount)
+	}
+
+	// Disconnect while broadcasting
+	for i, c := range registered {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.UnregisterConnectionByID(c.Key, c.ID)
+		}()
+		if i%connsPerKey == 0 {
+			wg.Add(1)
+			go broadcastAll()
+		}
+	}
+	wg.Wait()
+
+	for i := 0; i < keyCount; i++ {
+		result, err := m.BroadcastPayloadToLocalSubscribers(ctx, fmt.Sprintf("key-%d", i), []byte(`{}`))
+		assert.NoError(t, err)
+		assert.Zero(t, result.DeliveredCount)
+	}
+	for _, c := range registered {
+		assert.Eventually(
+			t, func() bool {
+				select {
+				case <-c.CloseChan:
+					return true
+				default:
+					return false
+				}
+			}, time.Second, 10*time.Millisecond,
+		)
+	}
+}
@@ -0,0 +1,180 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// SequencedPayload is a broadcast payload stamped with the sequence number of its key
+type SequencedPayload struct {
+	Seq     uint64
+	Payload []byte
+	// Match selects the connections the payload is replayed to, as it selected the connections of the broadcast
+	Match MetadataMatch
+}
+
+// sequencedFrame is a frame of a broadcast along with its sequence number, 0 when not sequenced
+type sequencedFrame struct {
+	seq   uint64
+	frame []byte
+}
+
+// ReplayStore assigns the per-key sequence numbers of broadcasts and keeps the recent payloads of each key,
+// so that a reconnecting client can resume from the last sequence number it received
+type ReplayStore interface {
+	// Append stamps the payload with the next sequence number of the key as a top-level "seq" field and keeps it
+	// along with the metadata match of the broadcast.
+	// Payloads that are not JSON objects are returned as is with seq 0 and are not kept
+	Append(ctx context.Context, key string, payload []byte, match MetadataMatch) (
+		seq uint64, stamped []byte, err error,
+	)
+
+	// Since returns the kept payloads of the key with a sequence number greater than lastSeq, oldest first
+	Since(ctx context.Context, key string, lastSeq uint64) ([]SequencedPayload, error)
+}
+
+func isJSONObject(payload []byte) bool {
+	trimmed := bytes.TrimSpace(payload)
+	return len(trimmed) >= 2 && trimmed[0] == '{' && trimmed[len(trimmed)-1] == '}'
+}
+
+// SequenceOf returns the "seq" field of a payload stamped by the ReplayStore, 0 when the payload is not sequenced
+func SequenceOf(payload []byte) uint64 {
+	if !isJSONObject(payload) {
+		return 0
+	}
+
+	var sequenced struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(payload, &sequenced); err != nil {
+		return 0
+	}
+	return sequenced.Seq
+}
+
+// stampSequence injects the sequence number as the first field of a JSON object payload
+func stampSequence(payload []byte, seq uint64) (stamped []byte, ok bool) {
+	return injectField(payload, "seq", strconv.AppendUint(nil, seq, 10))
+}
+
+// injectField adds a top-level field with an already encoded JSON value at the start of a JSON object payload
+func injectField(payload []byte, name string, value []byte) (injected []byte, ok bool) {
+	if !isJSONObject(payload) {
+		return payload, false
+	}
+
+	trimmed := bytes.TrimSpace(payload)
+	rest := bytes.TrimSpace(trimmed[1:])
+	injected = make([]byte, 0, len(trimmed)+len(name)+len(value)+4)
+	injected = append(injected, `{"`...)
+	injected = append(injected, name...)
+	injected = append(injected, `":`...)
+	injected = append(injected, value...)
+	if rest[0] != '}' {
+		injected = append(injected, ',')
+	}
+	return append(injected, rest...), true
+}
+
+// memoryReplayStore keeps the replay buffers in the memory of the pod, used by the local backend.
+// Buffers of keys without broadcast for ttl are evicted, sequence numbers are seeded from the clock
+// so that they keep increasing after an eviction or a restart
+type memoryReplayStore struct {
+	mu        sync.Mutex
+	size      int
+	ttl       time.Duration
+	buffers   map[string]*replayBuffer
+	lastSweep time.Time
+}
+
+// replayBuffer is a ring buffer of the last payloads of a key
+type replayBuffer struct {
+	lastSeq      uint64
+	entries      []SequencedPayload
+	next         int // Index the next payload is written to
+	count        int
+	lastAppendAt time.Time
+}
+
+func newMemoryReplayStore(size int, ttl time.Duration) *memoryReplayStore {
+	return &memoryReplayStore{
+		size:      size,
+		ttl:       ttl,
+		buffers:   map[string]*replayBuffer{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryReplayStore) Append(_ context.Context, key string, payload []byte, match MetadataMatch) (
+	uint64, []byte, error,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	buffer, ok := s.buffers[key]
+	if !ok {
+		buffer = &replayBuffer{
+			lastSeq: uint64(now.UnixMicro()),
+			entries: make([]SequencedPayload, s.size),
+		}
+		s.buffers[key] = buffer
+	}
+
+	if !isJSONObject(payload) {
+		return 0, payload, nil
+	}
+
+	seq := buffer.lastSeq + 1
+	stamped, _ := stampSequence(payload, seq)
+
+	buffer.lastSeq = seq
+	buffer.lastAppendAt = now
+	buffer.entries[buffer.next] = SequencedPayload{Seq: seq, Payload: stamped, Match: match}
+	buffer.next = (buffer.next + 1) % s.size
+	buffer.count = min(buffer.count+1, s.size)
+
+	return seq, stamped, nil
+}
+
+func (s *memoryReplayStore) Since(_ context.Context, key string, lastSeq uint64) ([]SequencedPayload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffer, ok := s.buffers[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var payloads []SequencedPayload
+	oldest := (buffer.next - buffer.count + s.size) % s.size
+	for i := 0; i < buffer.count; i++ {
+		entry := buffer.entries[(oldest+i)%s.size]
+		if entry.Seq > lastSeq {
+			payloads = append(payloads, entry)
+		}
+	}
+	return payloads, nil
+}
+
+// sweep evicts the buffers of idle keys, at most once per ttl
+func (s *memoryReplayStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+
+	for key, buffer := range s.buffers {
+		if now.Sub(buffer.lastAppendAt) >= s.ttl {
+			delete(s.buffers, key)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStampSequence(t *testing.T) {
+	testCases := []struct {
+		name     string
+		payload  string
+		expected string
+		ok       bool
+	}{
+		{name: "object", payload: `{"content":"Hello"}`, expected: `{"seq":7,"content":"Hello"}`, ok: true},
+		{name: "empty object", payload: `{}`, expected: `{"seq":7}`, ok: true},
+		{name: "object with whitespace", payload: " { \"a\":1 }\n", expected: `{"seq":7,"a":1 }`, ok: true},
+		{name: "array", payload: `[1,2]`, expected: `[1,2]`, ok: false},
+		{name: "plain text", payload: `hello`, expected: `hello`, ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(
+			tc.name, func(t *testing.T) {
+				stamped, ok := stampSequence([]byte(tc.payload), 7)
+				assert.Equal(t, tc.ok, ok)
+				assert.Equal(t, tc.expected, string(stamped))
+			},
+		)
+	}
+}
+
+func TestMemoryReplayStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run(
+		"sequence numbers increase per key and the buffer keeps the newest payloads", func(t *testing.T) {
+			s := newMemoryReplayStore(2, time.Minute)
+
+			first, _, err := s.Append(ctx, "key", []byte(`{"n":1}`), MetadataMatch{})
+			require.NoError(t, err)
+			second, _, _ := s.Append(ctx, "key", []byte(`{"n":2}`), MetadataMatch{})
+			third, stamped, _ := s.Append(ctx, "key", []byte(`{"n":3}`), MetadataMatch{})
+			otherKey, _, _ := s.Append(ctx, "other-key", []byte(`{"n":1}`), MetadataMatch{})
+
+			assert.Equal(t, first+1, second)
+			assert.Equal(t, second+1, third)
+			assert.NotZero(t, otherKey)
+
+			payloads, err := s.Since(ctx, "key", 0)
+			require.NoError(t, err)
+			assert.Equal(
+				t, []SequencedPayload{
+					{Seq: second, Payload: []byte(`{"seq":` + strconv.FormatUint(second, 10) + `,"n":2}`)},
+					{Seq: third, Payload: stamped},
+				}, payloads,
+			)
+
+			payloads, _ = s.Since(ctx, "key", second)
+			assert.Equal(t, []SequencedPayload{{Seq: third, Payload: stamped}}, payloads)
+
+			payloads, _ = s.Since(ctx, "key", third)
+			assert.Empty(t, payloads)
+		},
+	)
+
+	t.Run(
+		"payloads that are not JSON objects are not sequenced", func(t *testing.T) {
+			s := newMemoryReplayStore(2, time.Minute)
+
+			seq, stamped, err := s.Append(ctx, "key", []byte(`plain text`), MetadataMatch{})
+			assert.NoError(t, err)
+			assert.Zero(t, seq)
+			assert.Equal(t, `plain text`, string(stamped))
+
+			payloads, _ := s.Since(ctx, "key", 0)
+			assert.Empty(t, payloads)
+		},
+	)
+
+	t.Run(
+		"sequence numbers keep increasing after idle buffers are evicted", func(t *testing.T) {
+			s := newMemoryReplayStore(2, 10*time.Millisecond)
+
+			before, _, _ := s.Append(ctx, "key", []byte(`{}`), MetadataMatch{})
+			time.Sleep(20 * time.Millisecond)
+			// Evicts the idle buffer of key
+			_, _, _ = s.Append(ctx, "other-key", []byte(`{}`), MetadataMatch{})
+
+			payloads, _ := s.Since(ctx, "key", 0)
+			assert.Empty(t, payloads)
+
+			after, _, _ := s.Append(ctx, "key", []byte(`{}`), MetadataMatch{})
+			assert.Greater(t, after, before)
+		},
+	)
+
+	t.Run(
+		"keeps the metadata match of the broadcast", func(t *testing.T) {
+			s := newMemoryReplayStore(2, time.Minute)
+			match := MetadataMatch{Exclude: Metadata{"device": {"phone"}}}
+
+			seq, stamped, _ := s.Append(ctx, "key", []byte(`{}`), match)
+
+			payloads, _ := s.Since(ctx, "key", 0)
+			assert.Equal(t, []SequencedPayload{{Seq: seq, Payload: stamped, Match: match}}, payloads)
+		},
+	)
+}
+
+func TestDecodeReplayEntry(t *testing.T) {
+	match := MetadataMatch{Include: Metadata{"device": {"phone"}}}
+	tests := []struct {
+		name     string
+		member   string
+		expected SequencedPayload
+	}{
+		{
+			name:     "entry with a match",
+			member:   `{"payload":{"seq":3,"n":1},"match":{"include":{"device":["phone"]}}}`,
+			expected: SequencedPayload{Seq: 3, Payload: []byte(`{"seq":3,"n":1}`), Match: match},
+		},
+		{
+			name:     "entry without match",
+			member:   `{"payload":{"seq":3,"n":1}}`,
+			expected: SequencedPayload{Seq: 3, Payload: []byte(`{"seq":3,"n":1}`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				payload, err := decodeReplayEntry(3, []byte(tt.member))
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, payload)
+			},
+		)
+	}
+
+	_, err := decodeReplayEntry(3, []byte(`not json`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// SSECloseEventType is the event sent to Server-Sent Events clients when the server closes the stream:
+// event: close, data: {"code": 1001, "reason": "server shutting down"}. The codes are the WebSocket close codes
+const SSECloseEventType = "close"
+
+// ClosePayload tells a one-way client why the server closed its connection, it is the data of the SSE close event
+// and the closed field of long-poll responses
+type ClosePayload struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// SSETransport streams the frames of a connection as Server-Sent Events, for clients whose proxies drop WebSocket
+// upgrades. Frames stamped with a "seq" carry it as event ID, so that reconnecting EventSource clients resume through
+// the Last-Event-ID header. Pings are sent as comments, clients can't send frames over SSE
+type SSETransport struct {
+	mu         sync.Mutex // Serializes the writes of the write pump, the pings and the close event
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	requestCtx context.Context
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewSSETransport writes the headers of the event stream, the handler must not return before Done is closed.
+// The 200 header is written even when flushing it fails
+func NewSSETransport(w http.ResponseWriter, r *http.Request) (*SSETransport, error) {
+	t := &SSETransport{
+		w:          w,
+		controller: http.NewResponseController(w),
+		requestCtx: r.Context(),
+		done:       make(chan struct{}),
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disables the response buffering of nginx based proxies
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := t.controller.Flush(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Done is closed once the transport is closed and no write is in flight anymore
+func (t *SSETransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// ReadMessage returns once the client is gone, SSE clients can't send frames
+func (t *SSETransport) ReadMessage() ([]byte, error) {
+	select {
+	case <-t.requestCtx.Done():
+		return nil, context.Cause(t.requestCtx)
+	case <-t.done:
+		return nil, ErrConnectionClosed
+	}
+}
+
+func (t *SSETransport) WriteMessage(data []byte, deadline time.Time) error {
+	var event bytes.Buffer
+	if seq := SequenceOf(data); seq != 0 {
+		event.WriteString("id: ")
+		event.WriteString(strconv.FormatUint(seq, 10))
+		event.WriteByte('\n')
+	}
+	writeSSEData(&event, data)
+
+	return t.write(event.Bytes(), deadline)
+}
+
+func (t *SSETransport) WriteClose(code int, text string, deadline time.Time) error {
+	data, err := json.Marshal(ClosePayload{Code: code, Reason: text})
+	if err != nil {
+		return err
+	}
+
+	var event bytes.Buffer
+	event.WriteString("event: " + SSECloseEventType + "\n")
+	writeSSEData(&event, data)
+	return t.write(event.Bytes(), deadline)
+}
+
+func (t *SSETransport) Ping(deadline time.Time) error {
+	return t.write([]byte(": heartbeat\n\n"), deadline)
+}
+
+func (t *SSETransport) Close() error {
+	t.closeOnce.Do(
+		func() {
+			// Waits for the write in flight, the response must not be written once the handler returned
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			close(t.done)
+		},
+	)
+	return nil
+}
+
+func (t *SSETransport) Bidirectional() bool {
+	return false
+}
+
+func (t *SSETransport) write(event []byte, deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return ErrConnectionClosed
+	default:
+	}
+
+	// Every write extends the deadline, the WRITE_TIMEOUT of the server would otherwise end the stream
+	if err := t.controller.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := t.w.Write(event); err != nil {
+		return err
+	}
+	return t.controller.Flush()
+}
+
+// writeSSEData writes the payload as the data of an event, each line of the payload in its own data field
+func writeSSEData(event *bytes.Buffer, data []byte) {
+	for line := range bytes.Lines(data) {
+		event.WriteString("data: ")
+		event.Write(bytes.TrimRight(line, "\r\n"))
+		event.WriteByte('\n')
+	}
+	if len(data) == 0 {
+		event.WriteString("data: \n")
+	}
+	event.WriteByte('\n')
+}
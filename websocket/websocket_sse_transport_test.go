@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSSEData(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{name: "single line", data: `{"content":"hello"}`, expected: "data: {\"content\":\"hello\"}\n\n"},
+		{name: "multiple lines", data: "first\r\nsecond\n", expected: "data: first\ndata: second\n\n"},
+		{name: "empty", data: "", expected: "data: \n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var event bytes.Buffer
+				writeSSEData(&event, []byte(tt.data))
+				assert.Equal(t, tt.expected, event.String())
+			},
+		)
+	}
+}
+
+func TestSSETransport(t *testing.T) {
+	m := ProvideDefaultWebSocketManager(
+		WebSocketConfig{
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueueSize:    8,
+			ReplayBufferSize: 10,
+			ReplayBufferTTL:  time.Minute,
+		},
+	)
+
+	registered := make(chan *WebSocketConnection, 1)
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				transport, err := NewSSETransport(w, r)
+				if err != nil {
+					t.Errorf("failed to start SSE stream: %v", err)
+					return
+				}
+
+				var opts []ConnectionOptions
+				if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+					seq, _ := strconv.ParseUint(lastEventID, 10, 64)
+					opts = append(opts, WithResumeFrom(seq))
+				}
+				registered <- m.RegisterTransport("key", Metadata{}, transport, opts...)
+				<-transport.Done()
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+
+	subscribe := func(lastEventID string) (*bufio.Reader, func()) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body), func() { _ = resp.Body.Close() }
+	}
+
+	events, closeBody := subscribe("")
+	c := <-registered
+
+	_, err := m.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(`{"content":"hello"}`))
+	require.NoError(t, err)
+	id, data := readSSEEvent(t, events)
+	assert.Equal(t, `{"seq":`+id+`,"content":"hello"}`, data)
+
+	// The connection is removed once the client is gone, the next broadcast is only kept for replay
+	closeBody()
+	<-c.CloseChan
+	assert.Equal(t, DisconnectReasonReadError, c.CloseReason())
+	require.Eventually(t, func() bool { return len(m.ListKeys()) == 0 }, time.Second, 10*time.Millisecond)
+	_, err = m.BroadcastPayloadToLocalSubscribers(context.Background(), "key", []byte(`{"content":"missed"}`))
+	require.NoError(t, err)
+
+	events, closeBody = subscribe(id)
+	defer closeBody()
+	c = <-registered
+
+	_, data = readSSEEvent(t, events)
+	assert.Contains(t, data, `"content":"missed"`)
+
+	require.NoError(t, c.CloseWithCode(websocket.CloseGoingAway, "bye"))
+	line, err := events.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: close\n", line)
+	line, err = events.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: {\"code\":1001,\"reason\":\"bye\"}\n", line)
+}
+
+// readSSEEvent reads the next event of the stream, skipping the heartbeat comments
+func readSSEEvent(t *testing.T, events *bufio.Reader) (id string, data string) {
+	t.Helper()
+
+	for {
+		line, err := events.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && data != "":
+			return
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Control frames clients manage their subscriptions with when the route has a SubscriptionAuthorizer:
+// {"type": "subscribe", "payload": {"key": "<key>", "params": {...}}} and {"type": "unsubscribe", "payload": {"key": "<key>"}}.
+// The server replies with a "subscribed", "unsubscribed" or "subscription_error" frame carrying the key
+const (
+	SubscribeFrameType         = "subscribe"
+	UnsubscribeFrameType       = "unsubscribe"
+	SubscribedFrameType        = "subscribed"
+	UnsubscribedFrameType      = "unsubscribed"
+	SubscriptionErrorFrameType = "subscription_error"
+)
+
+// SubscriptionRequest is the payload of the subscription control frames,
+// Params carries whatever the SubscriptionAuthorizer of the route needs to authorize the key
+type SubscriptionRequest struct {
+	Key    string            `json:"key"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// SubscriptionReply is the payload of the frames replying to the subscription control frames
+type SubscriptionReply struct {
+	Key   string `json:"key"`
+	Error string `json:"error,omitempty"`
+}
+
+type (
+	// SubscriptionAuthorizer returns an error when the connection is not allowed to subscribe to the requested key
+	SubscriptionAuthorizer func(ctx context.Context, c *WebSocketConnection, req SubscriptionRequest) error
+	// SubscriptionHook is called once a connection subscribed to or unsubscribed from an additional key
+	SubscriptionHook func(c *WebSocketConnection, key string)
+)
+
+// connectionKeys are the keys a connection is registered under, the primary key first
+type connectionKeys struct {
+	mu     sync.Mutex
+	keys   []string
+	closed bool // Set once the connection is removed from the manager, no key can be added afterwards
+}
+
+// Keys returns the keys the connection is registered under, its primary Key first
+func (c *WebSocketConnection) Keys() []string {
+	c.keys.mu.Lock()
+	defer c.keys.mu.Unlock()
+
+	return slices.Clone(c.keys.keys)
+}
+
+func (m *webSocketManager) Subscribe(c *WebSocketConnection, key string) error {
+	if key == "" {
+		return ErrInvalidSubscriptionKey
+	}
+
+	c.keys.mu.Lock()
+	subscribed, err := m.checkSubscription(c, key)
+	c.keys.mu.Unlock()
+	if subscribed || err != nil {
+		return err
+	}
+
+	// Joining the key may subscribe to Redis, the connection keys are not locked meanwhile
+	if err := m.keyJoined(key); err != nil {
+		return err
+	}
+
+	c.keys.mu.Lock()
+	// The connection may have been closed or subscribed to the key concurrently
+	if subscribed, err := m.checkSubscription(c, key); subscribed || err != nil {
+		c.keys.mu.Unlock()
+		m.keyLeft(key)
+		return err
+	}
+	m.connections.addUnder(key, c)
+	c.keys.keys = append(c.keys.keys, key)
+	c.keys.mu.Unlock()
+
+	slog.Info("WebSocket connection subscribed", "key", key, "connection_id", c.ID, "metadata", c.Metadata)
+	if c.onSubscribe != nil {
+		c.onSubscribe(c, key)
+	}
+	return nil
+}
+
+// checkSubscription reports whether the connection is already registered under the key or returns an error when
+// it can't subscribe to another key, it must be called with the connection keys locked
+func (m *webSocketManager) checkSubscription(c *WebSocketConnection, key string) (subscribed bool, err error) {
+	// Connections rejected on registration have no key
+	if c.keys.closed || len(c.keys.keys) == 0 {
+		return false, ErrConnectionClosed
+	}
+	if slices.Contains(c.keys.keys, key) {
+		return true, nil
+	}
+	if m.MaxSubscriptionsPerConnection > 0 && len(c.keys.keys)-1 >= m.MaxSubscriptionsPerConnection {
+		return false, fmt.Errorf(
+			"%w: %d additional keys per connection", ErrTooManySubscriptions, m.MaxSubscriptionsPerConnection,
+		)
+	}
+	return false, nil
+}
+
+func (m *webSocketManager) Unsubscribe(c *WebSocketConnection, key string) error {
+	if key == c.Key {
+		return ErrPrimaryKeyUnsubscribe
+	}
+
+	c.keys.mu.Lock()
+	i := slices.Index(c.keys.keys, key)
+	// Closed connections leave their keys in removeClosedConnection
+	if c.keys.closed || i < 0 {
+		c.keys.mu.Unlock()
+		return nil
+	}
+
+	c.keys.keys = slices.Delete(c.keys.keys, i, i+1)
+	m.connections.remove(key, c.ID)
+	c.keys.mu.Unlock()
+	m.keyLeft(key)
+
+	slog.Info("WebSocket connection unsubscribed", "key", key, "connection_id", c.ID, "metadata", c.Metadata)
+	if c.onUnsubscribe != nil {
+		c.onUnsubscribe(c, key)
+	}
+	return nil
+}
+
+// leaveAllKeys removes the connection from every key it is registered under and prevents new subscriptions,
+// returns the keys it was registered under
+func (m *webSocketManager) leaveAllKeys(c *WebSocketConnection) []string {
+	c.keys.mu.Lock()
+	c.keys.closed = true
+	keys := c.keys.keys
+	for _, key := range keys {
+		m.connections.remove(key, c.ID)
+	}
+	c.keys.mu.Unlock()
+
+	for _, key := range keys {
+		m.keyLeft(key)
+	}
+	return keys
+}
+
+// keyJoined and keyLeft notify the key observer, they are called once per connection joining or leaving a key.
+// They may do I/O and are called without holding the connection keys
+func (m *webSocketManager) keyJoined(key string) error {
+	if m.observer != nil {
+		return m.observer.connectionJoined(key)
+	}
+	return nil
+}
+
+func (m *webSocketManager) keyLeft(key string) {
+	if m.observer != nil {
+		m.observer.connectionLeft(key)
+	}
+}
+
+// withSubscriptionHandlers adds the handlers of the subscription control frames to the inbound handlers
+func (m *webSocketManager) withSubscriptionHandlers(handlers InboundHandlers,
+	authorize SubscriptionAuthorizer) InboundHandlers {
+	withSubscriptions := make(InboundHandlers, len(handlers)+2)
+	for frameType, handler := range handlers {
+		withSubscriptions[frameType] = handler
+	}
+
+	withSubscriptions[SubscribeFrameType] = NewInboundHandler(
+		func(ctx context.Context, msg InboundMessage[SubscriptionRequest]) error {
+			err := authorize(ctx, msg.Connection, msg.Payload)
+			if err == nil {
+				err = m.Subscribe(msg.Connection, msg.Payload.Key)
+			}
+			return replySubscription(msg.Connection, SubscribedFrameType, msg.Payload.Key, err)
+		},
+	)
+	withSubscriptions[UnsubscribeFrameType] = NewInboundHandler(
+		func(ctx context.Context, msg InboundMessage[SubscriptionRequest]) error {
+			err := m.Unsubscribe(msg.Connection, msg.Payload.Key)
+			return replySubscription(msg.Connection, UnsubscribedFrameType, msg.Payload.Key, err)
+		},
+	)
+	return withSubscriptions
+}
+
+// replySubscription tells the client the outcome of its control frame, the error is returned to be logged
+func replySubscription(c *WebSocketConnection, frameType string, key string, err error) error {
+	reply := SubscriptionReply{Key: key}
+	if err != nil {
+		frameType = SubscriptionErrorFrameType
+		reply.Error = err.Error()
+	}
+
+	data, marshalErr := c.encodeFrame(frameType, reply)
+	if marshalErr != nil {
+		// This should never happen
+		slog.Error("failed to marshal subscription reply", "error", marshalErr)
+		return err
+	}
+	if sendErr := c.Send(data); sendErr != nil {
+		slog.Warn("failed to send subscription reply", "error", sendErr, "key", key, "connection_id", c.ID)
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketManagerSubscriptions(t *testing.T) {
+	cfg := WebSocketConfig{
+		PingInterval:                  time.Minute,
+		PongWait:                      time.Minute,
+		WriteWait:                     time.Second,
+		SendQueueSize:                 8,
+		MaxSubscriptionsPerConnection: 1,
+	}
+	authorize := func(_ context.Context, _ *WebSocketConnection, req SubscriptionRequest) error {
+		if !strings.HasPrefix(req.Key, "allowed-") {
+			return errors.New("forbidden")
+		}
+		return nil
+	}
+
+	t.Run(
+		"subscribe and unsubscribe with control frames", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, clientConn := newTestConnPair(t)
+
+			unsubscribed := make(chan string, 1)
+			c := m.RegisterConnection(
+				"primary", Metadata{}, serverConn,
+				WithSubscriptionAuthorizer(authorize),
+				WithOnUnsubscribe(func(c *WebSocketConnection, key string) { unsubscribed <- key }),
+			)
+
+			writeFrame(t, clientConn, `{"type":"subscribe","payload":{"key":"denied"}}`)
+			assertReply(t, clientConn, `{"type":"subscription_error","payload":{"key":"denied","error":"forbidden"}}`)
+
+			writeFrame(t, clientConn, `{"type":"subscribe","payload":{"key":"allowed-1"}}`)
+			assertReply(t, clientConn, `{"type":"subscribed","payload":{"key":"allowed-1"}}`)
+			assert.Equal(t, []string{"primary", "allowed-1"}, c.Keys())
+			assert.Equal(t, []string{"primary", "allowed-1"}, m.ListConnections("allowed-1")[0].Keys)
+
+			writeFrame(t, clientConn, `{"type":"subscribe","payload":{"key":"allowed-2"}}`)
+			assertReply(
+				t, clientConn,
+				`{"type":"subscription_error","payload":{"key":"allowed-2","error":"too many subscriptions: 1 additional keys per connection"}}`,
+			)
+
+			for _, key := range []string{"primary", "allowed-1"} {
+				result, err := m.BroadcastPayloadToLocalSubscribers(context.Background(), key, []byte(`{}`))
+				require.NoError(t, err)
+				assert.Equal(t, 1, result.DeliveredCount)
+				assertReply(t, clientConn, `{}`)
+			}
+
+			writeFrame(t, clientConn, `{"type":"unsubscribe","payload":{"key":"allowed-1"}}`)
+			assertReply(t, clientConn, `{"type":"unsubscribed","payload":{"key":"allowed-1"}}`)
+			assert.Equal(t, "allowed-1", <-unsubscribed)
+			assert.Equal(t, []KeyConnections{{Key: "primary", ConnectionCount: 1}}, m.ListKeys())
+			assert.ErrorIs(t, m.Unsubscribe(c, "primary"), ErrPrimaryKeyUnsubscribe)
+		},
+	)
+
+	t.Run(
+		"closed connections leave every key", func(t *testing.T) {
+			m := ProvideDefaultWebSocketManager(cfg)
+			serverConn, _ := newTestConnPair(t)
+
+			unsubscribed := make(chan string, 1)
+			disconnected := make(chan []string, 1)
+			c := m.RegisterConnection(
+				"primary", Metadata{}, serverConn,
+				WithOnUnsubscribe(func(c *WebSocketConnection, key string) { unsubscribed <- key }),
+				WithOnDisconnect(func(c *WebSocketConnection, _ DisconnectReason) { disconnected <- c.Keys() }),
+			)
+			require.NoError(t, m.Subscribe(c, "extra"))
+			require.NoError(t, m.Subscribe(c, "extra"), "subscribing twice should be a no-op")
+			assert.Len(t, m.ListKeys(), 2)
+
+			require.NoError(t, c.Close())
+			assert.Equal(t, "extra", <-unsubscribed)
+			assert.Equal(t, []string{"primary", "extra"}, <-disconnected)
+			assert.Empty(t, m.ListKeys())
+			assert.ErrorIs(t, m.Subscribe(c, "other"), ErrConnectionClosed)
+		},
+	)
+
+	t.Run(
+		"keys that could not be joined are not registered", func(t *testing.T) {
+			m := newWebSocketManager(cfg, newNoopWebSocketMetric())
+			observer := &failingKeyObserver{failing: map[string]bool{"unreachable": true}, joined: map[string]int{}}
+			m.observer = observer
+
+			serverConn, _ := newTestConnPair(t)
+			c := m.RegisterConnection("primary", Metadata{}, serverConn)
+			assert.ErrorIs(t, m.Subscribe(c, "unreachable"), errKeyUnreachable)
+			assert.Equal(t, []string{"primary"}, c.Keys())
+			assert.Equal(t, map[string]int{"primary": 1}, observer.counts())
+
+			// The failure is not counted, the next subscription tries to join the key again
+			delete(observer.failing, "unreachable")
+			require.NoError(t, m.Subscribe(c, "unreachable"))
+			assert.Equal(t, map[string]int{"primary": 1, "unreachable": 1}, observer.counts())
+
+			serverConn, _ = newTestConnPair(t)
+			observer.failing["rejected"] = true
+			var hooked atomic.Int64
+			rejected := m.RegisterConnection(
+				"rejected", Metadata{}, serverConn,
+				WithOnConnect(func(*WebSocketConnection) { hooked.Add(1) }),
+				WithOnDisconnect(func(*WebSocketConnection, DisconnectReason) { hooked.Add(1) }),
+			)
+			<-rejected.CloseChan
+			assert.Equal(t, DisconnectReasonJoinFailed, rejected.CloseReason())
+			assert.Zero(t, hooked.Load())
+			assert.NotContains(t, observer.counts(), "rejected")
+		},
+	)
+}
+
+var errKeyUnreachable = errors.New("key unreachable")
+
+// failingKeyObserver counts the connections of each key and fails to join the failing keys
+type failingKeyObserver struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	joined  map[string]int
+}
+
+func (o *failingKeyObserver) connectionJoined(key string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failing[key] {
+		return errKeyUnreachable
+	}
+	o.joined[key]++
+	return nil
+}
+
+func (o *failingKeyObserver) connectionLeft(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.joined[key]--
+	if o.joined[key] == 0 {
+		delete(o.joined, key)
+	}
+}
+
+func (o *failingKeyObserver) counts() map[string]int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return maps.Clone(o.joined)
+}
+
+func writeFrame(t *testing.T, clientConn *websocket.Conn, frame string) {
+	t.Helper()
+
+	require.NoError(t, clientConn.WriteMessage(websocket.TextMessage, []byte(frame)))
+}
+
+func assertReply(t *testing.T, clientConn *websocket.Conn, expected string) {
+	t.Helper()
+
+	_, data, err := clientConn.ReadMessage()
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(data))
+}
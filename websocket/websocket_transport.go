@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport is the stream the frames of a connection are written to, a WebSocket, a Server-Sent Events response
+// or the buffer of a long-polling client.
+// WriteMessage is only called by the write pump, Ping and WriteClose may be called concurrently with it
+type Transport interface {
+	// ReadMessage blocks until the client sends a text frame and returns an error once the client is gone.
+	// Transports without inbound frames only return once the client is gone
+	ReadMessage() ([]byte, error)
+
+	// WriteMessage writes a data frame, it fails if the frame is not written before the deadline
+	WriteMessage(data []byte, deadline time.Time) error
+
+	// WriteClose tells the client why the server is closing the connection, right before Close
+	WriteClose(code int, text string, deadline time.Time) error
+
+	// Ping keeps the connection alive, the connection is closed when it fails
+	Ping(deadline time.Time) error
+
+	// Close releases the underlying connection, closing an already closed transport is a no-op
+	Close() error
+
+	// Bidirectional reports whether the client can send frames, ack mode and control frames require it
+	Bidirectional() bool
+}
+
+// webSocketTransport writes the frames as WebSocket text messages, the client must answer pings before pongWait
+type webSocketTransport struct {
+	conn      *websocket.Conn
+	pongWait  time.Duration
+	startOnce sync.Once
+}
+
+func newWebSocketTransport(conn *websocket.Conn, pongWait time.Duration) *webSocketTransport {
+	return &webSocketTransport{conn: conn, pongWait: pongWait}
+}
+
+func (t *webSocketTransport) ReadMessage() ([]byte, error) {
+	// The read deadline is extended by every pong, it is only armed once the manager starts reading
+	t.startOnce.Do(
+		func() {
+			_ = t.conn.SetReadDeadline(time.Now().Add(t.pongWait))
+			t.conn.SetPongHandler(
+				func(string) error {
+					_ = t.conn.SetReadDeadline(time.Now().Add(t.pongWait))
+					return nil
+				},
+			)
+		},
+	)
+
+	for {
+		messageType, data, err := t.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType == websocket.TextMessage {
+			return data, nil
+		}
+	}
+}
+
+func (t *webSocketTransport) WriteMessage(data []byte, deadline time.Time) error {
+	if err := t.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteClose and Ping use WriteControl, which can be called concurrently with the data frames of WriteMessage
+func (t *webSocketTransport) WriteClose(code int, text string, deadline time.Time) error {
+	return t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+}
+
+func (t *webSocketTransport) Ping(deadline time.Time) error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+func (t *webSocketTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *webSocketTransport) Bidirectional() bool {
+	return true
+}
@@ -0,0 +1,607 @@
+package websocketclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// Message is a broadcast received from the server, decoded into T
+type Message[T any] struct {
+	// ID and Type are the ID and type of the websocket.Envelope of the broadcast, empty without WithEnvelope
+	ID   string
+	Type string
+	// Seq is the sequence number stamped by the server, 0 when the broadcast is not sequenced
+	Seq     uint64
+	Payload T
+	Raw     []byte
+}
+
+// Client is a WebSocket client of the routes served by httpserverwrapper. It reconnects with exponential backoff
+// when the connection is lost, resuming after the last received sequence number with the last_seq query parameter
+// and subscribing again to the additional keys. Frames stamped with an "ack_id" are acknowledged once delivered to
+// the Messages channel, and the reconnect hints of a draining server are followed
+type Client[T any] struct {
+	url      url.URL
+	cfg      ClientOptionalParams
+	messages chan Message[T]
+
+	mu        sync.Mutex
+	conn      *gorillaws.Conn // nil while disconnected
+	connected chan struct{}   // Closed once connected, replaced when the connection is lost
+	state     State
+	lastSeq   uint64
+	// subscriptions are the additional keys and their params, subscribed again on every reconnect
+	subscriptions map[string]map[string]string
+	replies       map[string][]chan error // Callers waiting for the reply to a subscription control frame, by key
+
+	// delivered are the IDs of the last delivered envelopes, only used by the goroutine reading the connection
+	delivered *recentIDs
+
+	writeMu   sync.Mutex // gorilla connections support one concurrent writer
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error // Why the client closed, set before done is closed
+}
+
+// Dial connects to the WebSocket route at rawURL, the first connection is not retried.
+// ctx only bounds the first handshake, the client runs until Close
+func Dial[T any](ctx context.Context, rawURL string, opts ...ClientOptions) (*Client[T], error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	optionalParam := defaultClientOptionalParams()
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+
+	c := &Client[T]{
+		url:           *u,
+		cfg:           optionalParam,
+		messages:      make(chan Message[T], optionalParam.MessageBufferSize),
+		connected:     make(chan struct{}),
+		lastSeq:       optionalParam.LastSeq,
+		subscriptions: map[string]map[string]string{},
+		replies:       map[string][]chan error{},
+		delivered:     newRecentIDs(deliveredIDsSize),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	c.setState(StateEvent{State: StateConnecting})
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go c.run(conn)
+	return c, nil
+}
+
+// Messages returns the broadcasts received from the server, it is closed once the client is closed
+func (c *Client[T]) Messages() <-chan Message[T] {
+	return c.messages
+}
+
+func (c *Client[T]) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+// LastSeq is the sequence number the client resumes after when reconnecting. Only the frames of the key the client
+// connected with carry a sequence number, additional keys are subscribed again without replay
+func (c *Client[T]) LastSeq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastSeq
+}
+
+// Done is closed once the client is closed, by Close or because it gave up reconnecting, see Err
+func (c *Client[T]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the client gave up reconnecting once Done is closed, nil after Close
+func (c *Client[T]) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Send sends a typed frame {"type": frameType, "payload": payload} to the inbound handlers of the route,
+// wrapped in a websocket.Envelope when it was negotiated.
+// While reconnecting it waits for the connection until ctx is done
+func (c *Client[T]) Send(ctx context.Context, frameType string, payload any) error {
+	for {
+		c.mu.Lock()
+		conn, connected := c.conn, c.connected
+		c.mu.Unlock()
+
+		if conn != nil {
+			return c.writeFrame(conn, frameType, payload)
+		}
+
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closing:
+			return ErrClientClosed
+		}
+	}
+}
+
+// Subscribe subscribes the connection to an additional key and waits for the reply of the server,
+// the key is subscribed again after every reconnect. Returns ErrSubscriptionRejected when the server refused it
+func (c *Client[T]) Subscribe(ctx context.Context, key string, params map[string]string) error {
+	c.mu.Lock()
+	c.subscriptions[key] = params
+	c.mu.Unlock()
+
+	err := c.sendSubscription(ctx, websocket.SubscribeFrameType, key, params)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.subscriptions, key)
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Unsubscribe unsubscribes the connection from an additional key and waits for the reply of the server
+func (c *Client[T]) Unsubscribe(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.subscriptions, key)
+	c.mu.Unlock()
+
+	return c.sendSubscription(ctx, websocket.UnsubscribeFrameType, key, nil)
+}
+
+// Close closes the connection with a normal closure, stops reconnecting and waits for the client to stop
+func (c *Client[T]) Close() error {
+	c.closeOnce.Do(
+		func() {
+			close(c.closing)
+
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			if conn != nil {
+				closeMessage := gorillaws.FormatCloseMessage(gorillaws.CloseNormalClosure, "")
+				_ = conn.WriteControl(gorillaws.CloseMessage, closeMessage, time.Now().Add(c.cfg.WriteWait))
+				_ = conn.Close()
+			}
+		},
+	)
+
+	<-c.done
+	return nil
+}
+
+func (c *Client[T]) dial(ctx context.Context) (*gorillaws.Conn, error) {
+	u := c.url
+	if lastSeq := c.LastSeq(); lastSeq > 0 {
+		query := u.Query()
+		query.Set("last_seq", strconv.FormatUint(lastSeq, 10))
+		u.RawQuery = query.Encode()
+	}
+
+	header := c.cfg.Header
+	if c.cfg.Envelope {
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Add("Sec-WebSocket-Protocol", websocket.EnvelopeSubprotocol)
+	}
+
+	conn, resp, err := c.cfg.Dialer.DialContext(ctx, u.String(), header)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		if resp != nil {
+			return nil, &HandshakeError{StatusCode: resp.StatusCode, Err: err}
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run reads from the connection and reconnects whenever it is lost, until the client is closed or gives up
+func (c *Client[T]) run(conn *gorillaws.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var err error
+	defer func() {
+		c.err = err
+		c.setState(StateEvent{State: StateClosed, Err: err})
+		close(c.messages)
+		close(c.done)
+	}()
+
+	for {
+		if !c.attach(conn) {
+			return
+		}
+		hinted := &atomic.Bool{}
+		err = c.readLoop(conn, hinted)
+		c.detach(conn)
+
+		if c.isClosing() {
+			err = nil
+			return
+		}
+		if c.isPermanent(err) {
+			return
+		}
+
+		// The server asked to reconnect, its reconnect hint already spread the clients
+		skipDelay := hinted.Load()
+		for attempt := 1; ; attempt++ {
+			if c.cfg.MaxReconnectAttempts > 0 && attempt > c.cfg.MaxReconnectAttempts {
+				err = fmt.Errorf("%w: %w", ErrReconnectAttemptsExhausted, err)
+				return
+			}
+
+			var delay time.Duration
+			if !skipDelay || attempt > 1 {
+				delay = c.cfg.Backoff.Delay(attempt)
+			}
+			c.setState(StateEvent{State: StateReconnecting, Attempt: attempt, Delay: delay, Err: err})
+
+			select {
+			case <-time.After(delay):
+			case <-c.closing:
+				err = nil
+				return
+			}
+
+			if conn, err = c.dial(ctx); err == nil {
+				break
+			}
+			if c.isClosing() {
+				err = nil
+				return
+			}
+			if c.isPermanent(err) {
+				return
+			}
+			slog.Warn("failed to reconnect WebSocket client", "error", err, "attempt", attempt)
+		}
+	}
+}
+
+// attach makes the connection the current one and subscribes again to the additional keys,
+// returns false when the client was closed in the meantime
+func (c *Client[T]) attach(conn *gorillaws.Conn) bool {
+	c.mu.Lock()
+	select {
+	case <-c.closing:
+		c.mu.Unlock()
+		_ = conn.Close()
+		return false
+	default:
+	}
+
+	c.conn = conn
+	close(c.connected)
+	subscriptions := maps.Clone(c.subscriptions)
+	// An unsubscribe frame lost along with the previous connection needs no reply, the new one never had the key
+	for key, waiting := range c.replies {
+		if _, ok := subscriptions[key]; !ok {
+			for _, replied := range waiting {
+				replied <- nil
+			}
+			delete(c.replies, key)
+		}
+	}
+	c.mu.Unlock()
+
+	c.setState(StateEvent{State: StateConnected})
+
+	for key, params := range subscriptions {
+		req := websocket.SubscriptionRequest{Key: key, Params: params}
+		if err := c.writeFrame(conn, websocket.SubscribeFrameType, req); err != nil {
+			slog.Warn("failed to subscribe again after reconnecting", "error", err, "key", key)
+		}
+	}
+	return true
+}
+
+func (c *Client[T]) detach(conn *gorillaws.Conn) {
+	_ = conn.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = nil
+	c.connected = make(chan struct{})
+}
+
+// readLoop reads the frames of the connection until it is lost. The read deadline is extended by every frame and
+// every ping of the server, a silent server is detected after ReadTimeout
+func (c *Client[T]) readLoop(conn *gorillaws.Conn, hinted *atomic.Bool) error {
+	_ = conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
+	conn.SetPingHandler(
+		func(appData string) error {
+			_ = conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
+			err := conn.WriteControl(gorillaws.PongMessage, []byte(appData), time.Now().Add(c.cfg.WriteWait))
+			if errors.Is(err, gorillaws.ErrCloseSent) {
+				return nil
+			}
+			return err
+		},
+	)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
+
+		if messageType != gorillaws.TextMessage {
+			continue
+		}
+		if !c.handleFrame(conn, data, hinted) {
+			return ErrClientClosed
+		}
+	}
+}
+
+// handleFrame handles the control frames and delivers the broadcasts, returns false when the client was closed
+// while waiting for room in the Messages channel
+func (c *Client[T]) handleFrame(conn *gorillaws.Conn, data []byte, hinted *atomic.Bool) bool {
+	enveloped := isEnveloped(conn)
+	frame := decodeFrame(enveloped, data)
+
+	switch frame.Type {
+	case websocket.SubscribedFrameType, websocket.UnsubscribedFrameType, websocket.SubscriptionErrorFrameType:
+		c.handleSubscriptionReply(frame.Type, frame.Payload)
+		return true
+	case websocket.ReconnectFrameType:
+		c.handleReconnectHint(conn, frame.Payload, hinted)
+		return true
+	}
+
+	msg := Message[T]{Seq: frame.Seq, Raw: data}
+	rawPayload := data
+	if enveloped {
+		msg.ID, msg.Type = frame.ID, frame.Type
+		rawPayload = frame.Payload
+	}
+
+	// A frame received twice is acknowledged again since the server did not get the previous ack
+	if msg.ID == "" || c.delivered.add(msg.ID) {
+		if err := json.Unmarshal(rawPayload, &msg.Payload); err != nil {
+			c.cfg.OnDecodeError(data, err)
+			return true
+		}
+
+		select {
+		case c.messages <- msg:
+		case <-c.closing:
+			return false
+		}
+
+		c.mu.Lock()
+		if frame.Seq > 0 {
+			c.lastSeq = frame.Seq
+		}
+		c.mu.Unlock()
+	}
+
+	if frame.AckID != "" {
+		if err := c.writeFrame(conn, websocket.AckFrameType, websocket.AckPayload{AckID: frame.AckID}); err != nil {
+			slog.Warn("failed to acknowledge WebSocket message", "error", err, "ack_id", frame.AckID)
+		}
+	}
+	return true
+}
+
+func (c *Client[T]) handleSubscriptionReply(frameType string, payload json.RawMessage) {
+	var reply websocket.SubscriptionReply
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		slog.Error("failed to decode subscription reply", "error", err, "payload", string(payload))
+		return
+	}
+
+	var err error
+	if frameType == websocket.SubscriptionErrorFrameType {
+		err = fmt.Errorf("%w: %s", ErrSubscriptionRejected, reply.Error)
+	}
+
+	c.mu.Lock()
+	waiting := c.replies[reply.Key]
+	delete(c.replies, reply.Key)
+	if err != nil && len(waiting) == 0 {
+		// A subscription made again after reconnecting was refused, e.g. the stream was closed in the meantime
+		delete(c.subscriptions, reply.Key)
+		slog.Warn("subscription refused after reconnecting", "error", err, "key", reply.Key)
+	}
+	c.mu.Unlock()
+
+	for _, replied := range waiting {
+		replied <- err
+	}
+}
+
+// handleReconnectHint closes the connection at a random time within the delay of the hint, the client then
+// reconnects right away and is routed to another pod
+func (c *Client[T]) handleReconnectHint(conn *gorillaws.Conn, payload json.RawMessage, hinted *atomic.Bool) {
+	var hint websocket.ReconnectPayload
+	if err := json.Unmarshal(payload, &hint); err != nil {
+		slog.Error("failed to decode reconnect hint", "error", err, "payload", string(payload))
+		return
+	}
+	if !hinted.CompareAndSwap(false, true) {
+		return
+	}
+
+	var delay time.Duration
+	if hint.WithinMs > 0 {
+		delay = rand.N(time.Duration(hint.WithinMs) * time.Millisecond)
+	}
+	slog.Info("server asked to reconnect", "reason", hint.Reason, "delay", delay)
+	time.AfterFunc(
+		delay, func() {
+			closeMessage := gorillaws.FormatCloseMessage(gorillaws.CloseGoingAway, hint.Reason)
+			_ = conn.WriteControl(gorillaws.CloseMessage, closeMessage, time.Now().Add(c.cfg.WriteWait))
+			_ = conn.Close()
+		},
+	)
+}
+
+// sendSubscription sends a subscription control frame and waits for its reply
+func (c *Client[T]) sendSubscription(ctx context.Context, frameType string, key string,
+	params map[string]string) error {
+	replied := make(chan error, 1)
+	c.mu.Lock()
+	c.replies[key] = append(c.replies[key], replied)
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.replies[key] = slices.DeleteFunc(c.replies[key], func(ch chan error) bool { return ch == replied })
+		if len(c.replies[key]) == 0 {
+			delete(c.replies, key)
+		}
+	}()
+
+	if err := c.Send(ctx, frameType, websocket.SubscriptionRequest{Key: key, Params: params}); err != nil {
+		return err
+	}
+
+	// A frame lost along with the connection is sent again after reconnecting for subscriptions,
+	// the reply then comes from the new connection
+	select {
+	case err := <-replied:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closing:
+		return ErrClientClosed
+	}
+}
+
+func (c *Client[T]) writeFrame(conn *gorillaws.Conn, frameType string, payload any) error {
+	data, err := encodeFrame(isEnveloped(conn), frameType, payload)
+	if err != nil {
+		return err
+	}
+	return c.write(conn, data)
+}
+
+func (c *Client[T]) write(conn *gorillaws.Conn, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteMessage(gorillaws.TextMessage, data)
+}
+
+func (c *Client[T]) setState(event StateEvent) {
+	c.mu.Lock()
+	c.state = event.State
+	c.mu.Unlock()
+
+	c.cfg.OnStateChange(event)
+}
+
+func (c *Client[T]) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPermanent reports whether reconnecting is pointless: the server refused the handshake for a reason that won't
+// change on retry, or closed the connection with one of the PermanentCloseCodes
+func (c *Client[T]) isPermanent(err error) bool {
+	var handshakeErr *HandshakeError
+	if errors.As(err, &handshakeErr) {
+		status := handshakeErr.StatusCode
+		return status >= 400 && status < 500 &&
+			status != http.StatusTooManyRequests && status != http.StatusRequestTimeout
+	}
+
+	var closeErr *gorillaws.CloseError
+	if errors.As(err, &closeErr) {
+		return slices.Contains(c.cfg.PermanentCloseCodes, closeErr.Code)
+	}
+	return false
+}
+
+// decodeFrame decodes the fields of a frame the client handles. Without envelope, broadcasts that are not JSON
+// objects are decoded as is and only the fields of the control frames and the fields stamped by the server are
+// decoded, so that the fields of the payloads don't fail it
+func decodeFrame(enveloped bool, data []byte) (frame websocket.Envelope) {
+	if enveloped {
+		_ = json.Unmarshal(data, &frame)
+		return frame
+	}
+
+	var bare struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+		Seq     uint64          `json:"seq"`
+		AckID   string          `json:"ack_id"`
+	}
+	_ = json.Unmarshal(data, &bare)
+	return websocket.Envelope{Type: bare.Type, Payload: bare.Payload, Seq: bare.Seq, AckID: bare.AckID}
+}
+
+// isEnveloped reports whether the server accepted the websocket.EnvelopeSubprotocol requested by WithEnvelope
+func isEnveloped(conn *gorillaws.Conn) bool {
+	return conn.Subprotocol() == websocket.EnvelopeSubprotocol
+}
+
+// encodeFrame encodes a frame in the format the inbound handlers of the server expect, see websocket.InboundFrame
+func encodeFrame(enveloped bool, frameType string, payload any) ([]byte, error) {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if enveloped {
+		return json.Marshal(websocket.NewEnvelope(uuid.NewString(), frameType, rawPayload))
+	}
+	return json.Marshal(websocket.InboundFrame{Type: frameType, Payload: rawPayload})
+}
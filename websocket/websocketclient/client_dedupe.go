@@ -0,0 +1,31 @@
+package websocketclient
+
+// deliveredIDsSize is the number of envelope IDs remembered to drop duplicates, it covers the redeliveries of
+// ack mode and the replay overlapping the frames received before a reconnect
+const deliveredIDsSize = 1024
+
+// recentIDs is a fixed size set of the last added IDs, the oldest ID is forgotten once full
+type recentIDs struct {
+	ids  []string
+	next int
+	seen map[string]struct{}
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{ids: make([]string, size), seen: make(map[string]struct{}, size)}
+}
+
+// add returns false when the ID is already in the set
+func (r *recentIDs) add(id string) bool {
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+
+	if oldest := r.ids[r.next]; oldest != "" {
+		delete(r.seen, oldest)
+	}
+	r.ids[r.next] = id
+	r.next = (r.next + 1) % len(r.ids)
+	r.seen[id] = struct{}{}
+	return true
+}
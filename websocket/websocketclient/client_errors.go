@@ -0,0 +1,27 @@
+package websocketclient
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrClientClosed               = errors.New("websocket client closed")
+	ErrSubscriptionRejected       = errors.New("subscription rejected by the server")
+	ErrReconnectAttemptsExhausted = errors.New("reconnect attempts exhausted")
+)
+
+// HandshakeError is returned when the server answered the upgrade request with an HTTP error,
+// e.g. 400 on invalid query parameters or 429 once the connection limit is reached
+type HandshakeError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("websocket handshake failed with status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,139 @@
+package websocketclient
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+type ClientOptionalParams struct {
+	Header               http.Header
+	Dialer               *gorillaws.Dialer
+	Backoff              Backoff
+	MaxReconnectAttempts int
+	ReadTimeout          time.Duration
+	WriteWait            time.Duration
+	MessageBufferSize    int
+	LastSeq              uint64
+	PermanentCloseCodes  []int
+	Envelope             bool
+	OnStateChange        func(event StateEvent)
+	OnDecodeError        func(raw []byte, err error)
+}
+
+type ClientOptions func(optionalParam *ClientOptionalParams)
+
+func defaultClientOptionalParams() ClientOptionalParams {
+	return ClientOptionalParams{
+		Dialer: &gorillaws.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 10 * time.Second,
+		},
+		Backoff: Backoff{
+			Initial:    500 * time.Millisecond,
+			Max:        30 * time.Second,
+			Multiplier: 2,
+			Jitter:     0.5,
+		},
+		// Twice the default PING_INTERVAL of the server
+		ReadTimeout:       60 * time.Second,
+		WriteWait:         10 * time.Second,
+		MessageBufferSize: 64,
+		OnStateChange:     func(StateEvent) {},
+		OnDecodeError: func(raw []byte, err error) {
+			slog.Error("failed to decode WebSocket message", "error", err, "message", string(raw))
+		},
+	}
+}
+
+// WithHeader sends the header with every upgrade request, e.g. to authenticate
+func WithHeader(header http.Header) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.Header = header
+	}
+}
+
+// WithDialer replaces the default dialer, e.g. to configure TLS or compression
+func WithDialer(dialer *gorillaws.Dialer) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.Dialer = dialer
+	}
+}
+
+// WithBackoff replaces the default backoff between reconnect attempts, 500ms doubling up to 30s with 50% jitter
+func WithBackoff(backoff Backoff) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.Backoff = backoff
+	}
+}
+
+// WithMaxReconnectAttempts closes the client after the given number of failed reconnect attempts in a row,
+// the client keeps reconnecting by default
+func WithMaxReconnectAttempts(attempts int) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.MaxReconnectAttempts = attempts
+	}
+}
+
+// WithReadTimeout reconnects when nothing, not even a ping, was received for the given duration.
+// It must be greater than the PING_INTERVAL of the server, 60s by default
+func WithReadTimeout(timeout time.Duration) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.ReadTimeout = timeout
+	}
+}
+
+// WithWriteWait is the time allowed to write a frame to the server, 10s by default
+func WithWriteWait(wait time.Duration) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.WriteWait = wait
+	}
+}
+
+// WithMessageBufferSize is the capacity of the Messages channel, reading from the server stops while it is full
+func WithMessageBufferSize(size int) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.MessageBufferSize = size
+	}
+}
+
+// WithLastSeq resumes after the given sequence number on the first connection, e.g. one persisted by a previous run
+func WithLastSeq(lastSeq uint64) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.LastSeq = lastSeq
+	}
+}
+
+// WithPermanentCloseCodes closes the client instead of reconnecting when the server closes the connection with one
+// of the given codes, e.g. the CONNECTION_EVICTED_CLOSE_CODE so that two clients don't keep evicting each other
+func WithPermanentCloseCodes(codes ...int) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.PermanentCloseCodes = codes
+	}
+}
+
+// WithOnStateChange calls the hook on every state change, from the goroutine of the client: it must not block
+func WithOnStateChange(hook func(event StateEvent)) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.OnStateChange = hook
+	}
+}
+
+// WithOnDecodeError calls the hook with the frames that could not be decoded into the message type, they are logged
+// and skipped by default
+func WithOnDecodeError(hook func(raw []byte, err error)) ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.OnDecodeError = hook
+	}
+}
+
+// WithEnvelope requests the websocket.EnvelopeSubprotocol, the broadcasts are then received with their ID and type
+// and the frames received twice, e.g. redelivered in ack mode, are dropped. Servers that don't support it keep
+// sending bare payloads
+func WithEnvelope() ClientOptions {
+	return func(optionalParam *ClientOptionalParams) {
+		optionalParam.Envelope = true
+	}
+}
@@ -0,0 +1,48 @@
+package websocketclient
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+type State string
+
+const (
+	StateConnecting   State = "connecting"
+	StateConnected    State = "connected"
+	StateReconnecting State = "reconnecting"
+	// StateClosed is final, the client closed or gave up reconnecting and the Messages channel is closed
+	StateClosed State = "closed"
+)
+
+// StateEvent reports a change of the connection state, see WithOnStateChange
+type StateEvent struct {
+	State State
+	// Attempt is the number of the next reconnect attempt, starting at 1, and Delay the wait before it (reconnecting)
+	Attempt int
+	Delay   time.Duration
+	// Err is why the connection was lost (reconnecting) or why the client gave up (closed, nil after Close)
+	Err error
+}
+
+// Backoff is the exponential backoff between reconnect attempts
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it, so that the clients of a restarting pod spread
+	// their reconnects instead of reconnecting together
+	Jitter float64
+}
+
+// Delay returns the wait before the given reconnect attempt, starting at 1:
+// Initial * Multiplier^(attempt-1) capped by Max, randomized by Jitter
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(max(attempt-1, 0)))
+	delay = min(delay, float64(b.Max))
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(max(delay, 0))
+}
@@ -0,0 +1,277 @@
+package websocketclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMessage struct {
+	Content string `json:"content"`
+}
+
+type testServer struct {
+	url        string
+	manager    websocket.WebSocketManager
+	registered chan *websocket.WebSocketConnection
+	inbound    chan testMessage
+	lastSeqs   chan string
+	failStatus atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		manager: websocket.ProvideDefaultWebSocketManager(
+			websocket.WebSocketConfig{
+				PingInterval:                  time.Minute,
+				PongWait:                      time.Minute,
+				WriteWait:                     time.Second,
+				SendQueueSize:                 8,
+				ReplayBufferSize:              10,
+				ReplayBufferTTL:               time.Minute,
+				MaxSubscriptionsPerConnection: 5,
+			},
+		),
+		registered: make(chan *websocket.WebSocketConnection, 4),
+		inbound:    make(chan testMessage, 4),
+		lastSeqs:   make(chan string, 4),
+	}
+
+	upgrader := gorillaws.Upgrader{Subprotocols: []string{websocket.EnvelopeSubprotocol}}
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if status := s.failStatus.Load(); status != 0 {
+					w.WriteHeader(int(status))
+					return
+				}
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("failed to upgrade: %v", err)
+					return
+				}
+
+				opts := []websocket.ConnectionOptions{
+					websocket.WithInboundHandlers(
+						websocket.InboundHandlers{
+							"message": websocket.NewInboundHandler(
+								func(_ context.Context, msg websocket.InboundMessage[testMessage]) error {
+									s.inbound <- msg.Payload
+									return nil
+								},
+							),
+						},
+					),
+					websocket.WithSubscriptionAuthorizer(
+						func(_ context.Context, _ *websocket.WebSocketConnection, req websocket.SubscriptionRequest) error {
+							if !strings.HasPrefix(req.Key, "allowed-") {
+								return errors.New("forbidden")
+							}
+							return nil
+						},
+					),
+				}
+				lastSeq := r.URL.Query().Get("last_seq")
+				s.lastSeqs <- lastSeq
+				if lastSeq != "" {
+					seq, _ := strconv.ParseUint(lastSeq, 10, 64)
+					opts = append(opts, websocket.WithResumeFrom(seq))
+				}
+				s.registered <- s.manager.RegisterConnection("key", websocket.Metadata{}, conn, opts...)
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+
+	s.url = "ws" + strings.TrimPrefix(srv.URL, "http")
+	return s
+}
+
+func (s *testServer) broadcast(t *testing.T, key string, payload string, opts ...websocket.BroadcastOptions) {
+	t.Helper()
+
+	_, err := s.manager.BroadcastPayloadToLocalSubscribers(context.Background(), key, []byte(payload), opts...)
+	require.NoError(t, err)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	fastBackoff := WithBackoff(Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2})
+
+	t.Run(
+		"reconnects and resumes after the last received message", func(t *testing.T) {
+			s := newTestServer(t)
+			states := make(chan StateEvent, 16)
+			client, err := Dial[testMessage](
+				ctx, s.url, fastBackoff, WithOnStateChange(func(event StateEvent) { states <- event }),
+			)
+			require.NoError(t, err)
+			defer client.Close()
+			c := <-s.registered
+			assert.Empty(t, <-s.lastSeqs)
+
+			s.broadcast(t, "key", `{"content":"hello"}`)
+			msg := <-client.Messages()
+			assert.Equal(t, "hello", msg.Payload.Content)
+			assert.Equal(t, msg.Seq, client.LastSeq())
+
+			// The connection is lost, the broadcast in the meantime is replayed after reconnecting
+			require.NoError(t, c.CloseWithCode(gorillaws.CloseGoingAway, "bye"))
+			require.Eventually(t, func() bool { return len(s.manager.ListKeys()) == 0 }, time.Second, 10*time.Millisecond)
+			s.broadcast(t, "key", `{"content":"missed"}`)
+
+			<-s.registered
+			assert.Equal(t, strconv.FormatUint(msg.Seq, 10), <-s.lastSeqs)
+			msg = <-client.Messages()
+			assert.Equal(t, "missed", msg.Payload.Content)
+
+			var seen []State
+			for len(states) > 0 {
+				seen = append(seen, (<-states).State)
+			}
+			assert.Equal(t, []State{StateConnecting, StateConnected, StateReconnecting, StateConnected}, seen)
+			assert.Equal(t, StateConnected, client.State())
+		},
+	)
+
+	t.Run(
+		"sends typed frames and subscribes again after reconnecting", func(t *testing.T) {
+			s := newTestServer(t)
+			client, err := Dial[testMessage](ctx, s.url, fastBackoff)
+			require.NoError(t, err)
+			defer client.Close()
+			c := <-s.registered
+
+			require.NoError(t, client.Send(ctx, "message", testMessage{Content: "hi"}))
+			assert.Equal(t, testMessage{Content: "hi"}, <-s.inbound)
+
+			require.NoError(t, client.Subscribe(ctx, "allowed-1", nil))
+			assert.ErrorIs(t, client.Subscribe(ctx, "denied", nil), ErrSubscriptionRejected)
+
+			require.NoError(t, c.CloseWithCode(gorillaws.CloseGoingAway, "bye"))
+			c = <-s.registered
+			require.Eventually(
+				t, func() bool { return len(c.Keys()) == 2 }, time.Second, 10*time.Millisecond,
+			)
+			assert.Equal(t, []string{"key", "allowed-1"}, c.Keys())
+
+			s.broadcast(t, "allowed-1", `{"content":"other key"}`)
+			assert.Equal(t, "other key", (<-client.Messages()).Payload.Content)
+
+			require.NoError(t, client.Unsubscribe(ctx, "allowed-1"))
+			assert.Equal(t, []string{"key"}, c.Keys())
+		},
+	)
+
+	t.Run(
+		"receives envelopes and drops the duplicates", func(t *testing.T) {
+			s := newTestServer(t)
+			client, err := Dial[testMessage](ctx, s.url, WithEnvelope())
+			require.NoError(t, err)
+			defer client.Close()
+			<-s.registered
+
+			s.broadcast(t, "key", `{"content":"hello"}`, websocket.WithMessageID("m1"), websocket.WithMessageType("greeting"))
+			s.broadcast(t, "key", `{"content":"hello"}`, websocket.WithMessageID("m1"), websocket.WithMessageType("greeting"))
+			s.broadcast(t, "key", `{"content":"bye"}`, websocket.WithMessageID("m2"))
+
+			msg := <-client.Messages()
+			assert.Equal(t, "m1", msg.ID)
+			assert.Equal(t, "greeting", msg.Type)
+			assert.Equal(t, "hello", msg.Payload.Content)
+			assert.NotZero(t, msg.Seq)
+
+			msg = <-client.Messages()
+			assert.Equal(t, "m2", msg.ID)
+			assert.Equal(t, websocket.DefaultMessageType, msg.Type)
+			assert.Equal(t, "bye", msg.Payload.Content)
+			assert.Equal(t, msg.Seq, client.LastSeq())
+
+			require.NoError(t, client.Send(ctx, "message", testMessage{Content: "hi"}))
+			assert.Equal(t, testMessage{Content: "hi"}, <-s.inbound)
+			require.NoError(t, client.Subscribe(ctx, "allowed-1", nil))
+		},
+	)
+
+	t.Run(
+		"decode failures are reported", func(t *testing.T) {
+			s := newTestServer(t)
+			decodeErrors := make(chan string, 1)
+			client, err := Dial[testMessage](
+				ctx, s.url, WithOnDecodeError(func(raw []byte, err error) { decodeErrors <- string(raw) }),
+			)
+			require.NoError(t, err)
+			defer client.Close()
+			<-s.registered
+
+			s.broadcast(t, "key", `"not an object"`)
+			assert.Equal(t, `"not an object"`, <-decodeErrors)
+		},
+	)
+
+	t.Run(
+		"gives up on permanent failures and closes cleanly", func(t *testing.T) {
+			s := newTestServer(t)
+			s.failStatus.Store(http.StatusBadRequest)
+			_, err := Dial[testMessage](ctx, s.url)
+			var handshakeErr *HandshakeError
+			require.ErrorAs(t, err, &handshakeErr)
+			assert.Equal(t, http.StatusBadRequest, handshakeErr.StatusCode)
+
+			s.failStatus.Store(0)
+			client, err := Dial[testMessage](ctx, s.url, fastBackoff, WithPermanentCloseCodes(4000))
+			require.NoError(t, err)
+			c := <-s.registered
+			require.NoError(t, c.CloseWithCode(4000, "evicted"))
+
+			<-client.Done()
+			var closeErr *gorillaws.CloseError
+			require.ErrorAs(t, client.Err(), &closeErr)
+			assert.Equal(t, 4000, closeErr.Code)
+			_, ok := <-client.Messages()
+			assert.False(t, ok)
+			assert.Equal(t, StateClosed, client.State())
+			require.NoError(t, client.Close())
+		},
+	)
+
+	t.Run(
+		"close stops the client", func(t *testing.T) {
+			s := newTestServer(t)
+			client, err := Dial[testMessage](ctx, s.url)
+			require.NoError(t, err)
+			c := <-s.registered
+
+			require.NoError(t, client.Close())
+			<-c.CloseChan
+			assert.NoError(t, client.Err())
+			assert.ErrorIs(t, client.Send(ctx, "message", testMessage{}), ErrClientClosed)
+		},
+	)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, backoff.Delay(1))
+	assert.Equal(t, 400*time.Millisecond, backoff.Delay(3))
+	assert.Equal(t, time.Second, backoff.Delay(10))
+
+	backoff.Jitter = 0.5
+	for range 100 {
+		delay := backoff.Delay(2)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.LessOrEqual(t, delay, 300*time.Millisecond)
+	}
+}
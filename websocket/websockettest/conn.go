@@ -0,0 +1,170 @@
+package websockettest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// Conn is the client side of a connection dialed with Server.Dial. Its frames are read in the background,
+// so that the expectations below can time out without breaking the connection
+type Conn struct {
+	*gorillaws.Conn
+	// Connection is the server side of the connection, as registered in the manager
+	Connection *websocket.WebSocketConnection
+
+	t        testing.TB
+	frames   chan []byte
+	closed   chan struct{}
+	closeErr error // Why the connection was closed, set before closed is closed
+}
+
+func newConn(t testing.TB, conn *gorillaws.Conn, registered *websocket.WebSocketConnection) *Conn {
+	c := &Conn{
+		Conn:       conn,
+		Connection: registered,
+		t:          t,
+		frames:     make(chan []byte, 256),
+		closed:     make(chan struct{}),
+	}
+	go c.readFrames()
+	return c
+}
+
+func (c *Conn) readFrames() {
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			c.closeErr = err
+			close(c.closed)
+			return
+		}
+		c.frames <- data
+	}
+}
+
+// Enveloped reports whether the server accepted the websocket.EnvelopeSubprotocol, see WithEnvelope
+func (c *Conn) Enveloped() bool {
+	return c.Subprotocol() == websocket.EnvelopeSubprotocol
+}
+
+// Send sends a frame to the inbound handlers of the route, wrapped in a websocket.Envelope when it was negotiated
+func (c *Conn) Send(frameType string, payload any) {
+	c.t.Helper()
+
+	rawPayload, err := json.Marshal(payload)
+	require.NoError(c.t, err)
+
+	var frame any = websocket.InboundFrame{Type: frameType, Payload: rawPayload}
+	if c.Enveloped() {
+		frame = websocket.NewEnvelope(uuid.NewString(), frameType, rawPayload)
+	}
+	data, err := json.Marshal(frame)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.WriteMessage(gorillaws.TextMessage, data))
+}
+
+// ExpectFrames waits for the next n frames within timeout and returns them, the test fails when fewer frames arrive
+func (c *Conn) ExpectFrames(n int, timeout time.Duration) [][]byte {
+	c.t.Helper()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	frames := make([][]byte, 0, n)
+	for len(frames) < n {
+		select {
+		case frame := <-c.frames:
+			frames = append(frames, frame)
+		case <-c.closed:
+			// The frames received before the close are still delivered
+			select {
+			case frame := <-c.frames:
+				frames = append(frames, frame)
+				continue
+			default:
+			}
+			c.t.Fatalf("expected %d frames, got %d before the connection closed: %v", n, len(frames), c.closeErr)
+		case <-timer.C:
+			c.t.Fatalf("expected %d frames within %s, got %d", n, timeout, len(frames))
+		}
+	}
+	return frames
+}
+
+// ExpectFrame waits for the next frame within timeout
+func (c *Conn) ExpectFrame(timeout time.Duration) []byte {
+	c.t.Helper()
+
+	return c.ExpectFrames(1, timeout)[0]
+}
+
+// ExpectNoFrame fails the test when a frame arrives within the given duration
+func (c *Conn) ExpectNoFrame(within time.Duration) {
+	c.t.Helper()
+
+	select {
+	case frame := <-c.frames:
+		c.t.Fatalf("expected no frame within %s, got %s", within, frame)
+	case <-time.After(within):
+	}
+}
+
+// ExpectClose waits for the server to close the connection with the close code within timeout,
+// the frames received in the meantime are discarded
+func (c *Conn) ExpectClose(code int, timeout time.Duration) {
+	c.t.Helper()
+
+	select {
+	case <-c.closed:
+	case <-time.After(timeout):
+		c.t.Fatalf("expected the connection to close with %d within %s", code, timeout)
+	}
+
+	var closeErr *gorillaws.CloseError
+	if !errors.As(c.closeErr, &closeErr) {
+		c.t.Fatalf("expected the connection to close with %d, got %v", code, c.closeErr)
+	}
+	if closeErr.Code != code {
+		c.t.Fatalf("expected the connection to close with %d, got %d (%s)", code, closeErr.Code, closeErr.Text)
+	}
+}
+
+// ExpectMessages waits for the next n frames within timeout and decodes them into T,
+// the payloads of the envelopes are decoded when the connection is enveloped
+func ExpectMessages[T any](c *Conn, n int, timeout time.Duration) []T {
+	c.t.Helper()
+
+	messages := make([]T, 0, n)
+	for _, frame := range c.ExpectFrames(n, timeout) {
+		if c.Enveloped() {
+			var envelope websocket.Envelope
+			require.NoError(c.t, json.Unmarshal(frame, &envelope))
+			frame = envelope.Payload
+		}
+
+		var message T
+		require.NoError(c.t, json.Unmarshal(frame, &message), "failed to decode frame %s", frame)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// ExpectEnvelopes waits for the next n frames within timeout and decodes them as envelopes, see WithEnvelope
+func ExpectEnvelopes(c *Conn, n int, timeout time.Duration) []websocket.Envelope {
+	c.t.Helper()
+
+	envelopes := make([]websocket.Envelope, 0, n)
+	for _, frame := range c.ExpectFrames(n, timeout) {
+		var envelope websocket.Envelope
+		require.NoError(c.t, json.Unmarshal(frame, &envelope), "failed to decode envelope %s", frame)
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes
+}
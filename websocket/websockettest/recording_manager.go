@@ -0,0 +1,97 @@
+package websockettest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/domesama/chat-and-notifications/websocket"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+var _ websocket.WebSocketManager = (*RecordingManager)(nil)
+
+// Broadcast is a broadcast recorded by the RecordingManager, along with its outcome
+type Broadcast struct {
+	Key     string
+	Payload []byte
+	Result  websocket.BroadcastResult
+	Err     error
+}
+
+// BroadcastFunc replaces the broadcasts of the RecordingManager, see WithFakeBroadcast
+type BroadcastFunc = websocket.BroadcastFunc
+
+// RecordingManager records the connections and broadcasts going through the WebSocketManager it wraps
+type RecordingManager struct {
+	websocket.WebSocketManager
+
+	mu         sync.Mutex
+	broadcasts []Broadcast
+	// connections are the registered WebSocket connections by the address of their client
+	connections   map[string]*websocket.WebSocketConnection
+	fakeBroadcast BroadcastFunc // nil delivers the broadcasts with the wrapped manager
+	// multicastParallelism bounds the broadcasts of a multicast, see websocket.WebSocketConfig.MulticastParallelism
+	multicastParallelism int
+}
+
+func NewRecordingManager(manager websocket.WebSocketManager) *RecordingManager {
+	return &RecordingManager{
+		WebSocketManager: manager,
+		connections:      map[string]*websocket.WebSocketConnection{},
+	}
+}
+
+func (m *RecordingManager) RegisterConnection(key string, metadata websocket.Metadata, conn *gorillaws.Conn,
+	opts ...websocket.ConnectionOptions) *websocket.WebSocketConnection {
+	c := m.WebSocketManager.RegisterConnection(key, metadata, conn, opts...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connections[conn.RemoteAddr().String()] = c
+	return c
+}
+
+func (m *RecordingManager) BroadcastPayloadToLocalSubscribers(ctx context.Context, key string, message []byte,
+	opts ...websocket.BroadcastOptions) (result websocket.BroadcastResult, err error) {
+	if m.fakeBroadcast != nil {
+		result, err = m.fakeBroadcast(ctx, key, message, opts...)
+	} else {
+		result, err = m.WebSocketManager.BroadcastPayloadToLocalSubscribers(ctx, key, message, opts...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.broadcasts = append(m.broadcasts, Broadcast{Key: key, Payload: message, Result: result, Err: err})
+	return result, err
+}
+
+// MulticastPayloadToLocalSubscribers goes through BroadcastPayloadToLocalSubscribers, so that the broadcast to each key
+// is recorded and faked like the others
+func (m *RecordingManager) MulticastPayloadToLocalSubscribers(ctx context.Context, keys []string, message []byte,
+	opts ...websocket.BroadcastOptions) (websocket.MulticastResult, error) {
+	return websocket.Multicast(ctx, m.BroadcastPayloadToLocalSubscribers, m.multicastParallelism, keys, message, opts...)
+}
+
+// Broadcasts returns the broadcasts to the key recorded so far, oldest first
+func (m *RecordingManager) Broadcasts(key string) []Broadcast {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var broadcasts []Broadcast
+	for _, broadcast := range m.broadcasts {
+		if broadcast.Key == key {
+			broadcasts = append(broadcasts, broadcast)
+		}
+	}
+	return broadcasts
+}
+
+// connectionOf returns the connection registered for the client at the given address, nil until it is registered
+func (m *RecordingManager) connectionOf(clientAddr string) *websocket.WebSocketConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.connections[clientAddr]
+}
@@ -0,0 +1,212 @@
+package websockettest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// registrationTimeout bounds how long Dial waits for the manager to register the upgraded connection
+const registrationTimeout = 5 * time.Second
+
+// Server is an HTTPWithWebSocketServer started in-process on an ephemeral port, it is shut down with the test.
+// Its manager records every connection and broadcast, see RecordingManager
+type Server struct {
+	Manager   *RecordingManager
+	addr      string
+	adminAddr string
+	t         testing.TB
+}
+
+// CustomizerFunc builds the routes served by the Server around its manager, e.g. a ChatWebSocketHandler that
+// broadcasts with it
+type CustomizerFunc func(manager websocket.WebSocketManager) httpserverwrapper.RouterWithWebSocketCustomizer
+
+// NewServer starts the routes of the customizer with a local manager by default
+func NewServer(t testing.TB, newCustomizer CustomizerFunc, opts ...ServerOptions) *Server {
+	t.Helper()
+
+	optionalParam := defaultServerOptionalParams()
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+
+	manager := optionalParam.Manager
+	if manager == nil {
+		manager = websocket.ProvideDefaultWebSocketManager(optionalParam.WebSocketConfig)
+	}
+	recording := NewRecordingManager(manager)
+	recording.fakeBroadcast = optionalParam.FakeBroadcast
+	recording.multicastParallelism = optionalParam.WebSocketConfig.MulticastParallelism
+
+	gin.SetMode(gin.TestMode)
+	httpCfg := httpserverwrapper.HTTPServerConfig{ListenAddr: "127.0.0.1:0", ShutdownTimeout: 5 * time.Second}
+	customizer := newCustomizer(recording)
+	srv, cleanUp, err := httpserverwrapper.NewHTTPWithWebSocketServer(
+		httpCfg,
+		customizer,
+		recording,
+		optionalParam.LongPollConfig,
+	)
+	require.NoError(t, err)
+	t.Cleanup(cleanUp)
+
+	// The admin routes are served on their own listener as in production, see PostAdminJSON
+	adminSrv, adminCleanUp, err := httpserverwrapper.ProvideWebSocketAdminServer(
+		httpserverwrapper.WebSocketAdminConfig{Enabled: true, ListenAddr: "127.0.0.1:0"},
+		httpCfg,
+		recording,
+		customizer,
+	)
+	require.NoError(t, err)
+	t.Cleanup(adminCleanUp)
+
+	return &Server{
+		Manager:   recording,
+		addr:      "127.0.0.1" + srv.GetRunningPort(),
+		adminAddr: "127.0.0.1" + adminSrv.GetRunningPort(),
+		t:         t,
+	}
+}
+
+// URL returns the HTTP URL of the path with the query
+func (s *Server) URL(path string, query url.Values) string {
+	u := url.URL{Scheme: "http", Host: s.addr, Path: path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// WebSocketURL returns the WebSocket URL of the path with the query
+func (s *Server) WebSocketURL(path string, query url.Values) string {
+	u := url.URL{Scheme: "ws", Host: s.addr, Path: path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// Dial connects to the WebSocket route at path and waits for the manager to register the connection,
+// the test fails when the handshake is refused
+func (s *Server) Dial(path string, query url.Values, opts ...DialOptions) *Conn {
+	s.t.Helper()
+
+	conn, resp, err := s.TryDial(path, query, opts...)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		s.t.Fatalf("failed to dial %s (status %d): %v", path, status, err)
+	}
+	return conn
+}
+
+// TryDial connects to the WebSocket route at path like Dial, returning the response of refused handshakes,
+// e.g. to assert the status of a request with missing query parameters
+func (s *Server) TryDial(path string, query url.Values, opts ...DialOptions) (*Conn, *http.Response, error) {
+	s.t.Helper()
+
+	optionalParam := DialOptionalParams{}
+	for _, opt := range opts {
+		opt(&optionalParam)
+	}
+
+	dialer := gorillaws.Dialer{HandshakeTimeout: registrationTimeout}
+	if optionalParam.Envelope {
+		dialer.Subprotocols = []string{websocket.EnvelopeSubprotocol}
+	}
+	conn, resp, err := dialer.Dial(s.WebSocketURL(path, query), optionalParam.Header)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, resp, err
+	}
+	s.t.Cleanup(func() { _ = conn.Close() })
+
+	// The connection is registered after the upgrade, broadcasts sent before would miss it
+	var registered *websocket.WebSocketConnection
+	if !waitUntil(registrationTimeout, func() bool {
+		registered = s.Manager.connectionOf(conn.LocalAddr().String())
+		return registered != nil
+	}) {
+		s.t.Fatalf("connection to %s was not registered within %s", path, registrationTimeout)
+	}
+
+	return newConn(s.t, conn, registered), resp, nil
+}
+
+// PostJSON posts the body encoded as JSON to the path, returns the status and body of the response
+func (s *Server) PostJSON(path string, query url.Values, body any) (status int, response []byte) {
+	s.t.Helper()
+	return s.postJSON(s.URL(path, query), body)
+}
+
+// PostAdminJSON posts the body encoded as JSON to the path of the internal admin listener,
+// returns the status and body of the response
+func (s *Server) PostAdminJSON(path string, body any) (status int, response []byte) {
+	s.t.Helper()
+
+	u := url.URL{Scheme: "http", Host: s.adminAddr, Path: path}
+	return s.postJSON(u.String(), body)
+}
+
+func (s *Server) postJSON(u string, body any) (status int, response []byte) {
+	s.t.Helper()
+
+	data, err := json.Marshal(body)
+	require.NoError(s.t, err)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u, bytes.NewReader(data))
+	require.NoError(s.t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(s.t, err)
+	defer resp.Body.Close()
+
+	response, err = io.ReadAll(resp.Body)
+	require.NoError(s.t, err)
+	return resp.StatusCode, response
+}
+
+// ExpectBroadcasts waits for n broadcasts to the key within timeout and returns them, the test fails when fewer
+// broadcasts were made. Broadcasts are recorded once they completed, delivered or not
+func (s *Server) ExpectBroadcasts(key string, n int, timeout time.Duration) []Broadcast {
+	s.t.Helper()
+
+	var broadcasts []Broadcast
+	if !waitUntil(timeout, func() bool { broadcasts = s.Manager.Broadcasts(key); return len(broadcasts) >= n }) {
+		s.t.Fatalf("expected %d broadcasts to key %q within %s, got %d", n, key, timeout, len(broadcasts))
+	}
+	return broadcasts
+}
+
+// ExpectConnections waits until n connections are registered under the key on the server,
+// e.g. 0 once the clients disconnected
+func (s *Server) ExpectConnections(key string, n int, timeout time.Duration) {
+	s.t.Helper()
+
+	var count int
+	if !waitUntil(timeout, func() bool { count = len(s.Manager.ListConnections(key)); return count == n }) {
+		s.t.Fatalf("expected %d connections under key %q within %s, got %d", n, key, timeout, count)
+	}
+}
+
+// waitUntil polls the condition until it holds or the timeout expires, it is checked at least once
+func waitUntil(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
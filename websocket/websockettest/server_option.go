@@ -0,0 +1,99 @@
+package websockettest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/websocket"
+)
+
+type ServerOptionalParams struct {
+	Manager         websocket.WebSocketManager
+	WebSocketConfig websocket.WebSocketConfig
+	LongPollConfig  httpserverwrapper.LongPollConfig
+	FakeBroadcast   BroadcastFunc
+}
+
+type ServerOptions func(optionalParam *ServerOptionalParams)
+
+func defaultServerOptionalParams() ServerOptionalParams {
+	return ServerOptionalParams{
+		// The defaults of the environment, except the drain delays so that the server shuts down right away
+		WebSocketConfig: websocket.WebSocketConfig{
+			PingInterval:                  30 * time.Second,
+			PongWait:                      40 * time.Second,
+			WriteWait:                     10 * time.Second,
+			SendQueueSize:                 256,
+			SendQueueOverflowPolicy:       websocket.OverflowPolicyDisconnect,
+			SendQueueOverflowCloseCode:    1013,
+			ReplayBufferTTL:               5 * time.Minute,
+			AckTimeout:                    500 * time.Millisecond,
+			AckMaxRedeliveries:            1,
+			ConnectionIdentityMetadataKey: "user_id",
+			ConnectionLimitPolicy:         websocket.ConnectionLimitPolicyReject,
+			ConnectionEvictedCloseCode:    4000,
+			MaxSubscriptionsPerConnection: 20,
+			MulticastParallelism:          16,
+			InboundQueueSize:              64,
+			InboundHandlerTimeout:         10 * time.Second,
+			DrainBatchSize:                100,
+		},
+		LongPollConfig: httpserverwrapper.LongPollConfig{
+			Wait:        time.Second,
+			IdleTimeout: 30 * time.Second,
+			BufferSize:  256,
+		},
+	}
+}
+
+// WithManager serves the connections with the given manager instead of a local one built from the WebSocketConfig,
+// e.g. a manager with the redis_pubsub backend
+func WithManager(manager websocket.WebSocketManager) ServerOptions {
+	return func(optionalParam *ServerOptionalParams) {
+		optionalParam.Manager = manager
+	}
+}
+
+// WithWebSocketConfig configures the local manager of the server
+func WithWebSocketConfig(cfg websocket.WebSocketConfig) ServerOptions {
+	return func(optionalParam *ServerOptionalParams) {
+		optionalParam.WebSocketConfig = cfg
+	}
+}
+
+// WithLongPollConfig configures the long-poll routes, polls wait 1s by default
+func WithLongPollConfig(cfg httpserverwrapper.LongPollConfig) ServerOptions {
+	return func(optionalParam *ServerOptionalParams) {
+		optionalParam.LongPollConfig = cfg
+	}
+}
+
+// WithFakeBroadcast replaces the broadcasts of the manager, they are still recorded but only delivered when fake
+// delivers them. E.g. to test how a handler answers partially delivered broadcasts
+func WithFakeBroadcast(fake BroadcastFunc) ServerOptions {
+	return func(optionalParam *ServerOptionalParams) {
+		optionalParam.FakeBroadcast = fake
+	}
+}
+
+type DialOptionalParams struct {
+	Header   http.Header
+	Envelope bool
+}
+
+type DialOptions func(optionalParam *DialOptionalParams)
+
+// WithDialHeader sends the header with the upgrade request, e.g. to authenticate
+func WithDialHeader(header http.Header) DialOptions {
+	return func(optionalParam *DialOptionalParams) {
+		optionalParam.Header = header
+	}
+}
+
+// WithEnvelope requests the websocket.EnvelopeSubprotocol, ExpectMessages then decodes the payloads of the envelopes
+func WithEnvelope() DialOptions {
+	return func(optionalParam *DialOptionalParams) {
+		optionalParam.Envelope = true
+	}
+}
@@ -0,0 +1,137 @@
+package websockettest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/domesama/chat-and-notifications/httpserverwrapper"
+	"github.com/domesama/chat-and-notifications/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMessage struct {
+	Content string `json:"content"`
+}
+
+type testCustomizer struct{}
+
+func (testCustomizer) Configure(*httpserverwrapper.HTTPServerBuilder) error {
+	return nil
+}
+
+func (testCustomizer) RegisterRoutes(*gin.Engine) error {
+	return nil
+}
+
+func newTestCustomizer(websocket.WebSocketManager) httpserverwrapper.RouterWithWebSocketCustomizer {
+	return testCustomizer{}
+}
+
+func (testCustomizer) RegisterWebSocketRoutes() httpserverwrapper.WebSocketRoutes {
+	return httpserverwrapper.WebSocketRoutes{
+		"/subscribe": {
+			Handler: func(gctx *gin.Context) (string, websocket.Metadata) {
+				key := gctx.Query("key")
+				if key == "" {
+					gctx.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+				}
+				return key, websocket.Metadata{}
+			},
+			InboundHandlers: websocket.InboundHandlers{
+				"echo": websocket.NewInboundHandler(
+					func(_ context.Context, msg websocket.InboundMessage[testMessage]) error {
+						return msg.Connection.Send([]byte(`{"content":"` + msg.Payload.Content + `"}`))
+					},
+				),
+			},
+		},
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	query := url.Values{"key": {"key"}}
+
+	t.Run(
+		"delivers broadcasts and echoes inbound frames", func(t *testing.T) {
+			s := NewServer(t, newTestCustomizer)
+			conn := s.Dial("/subscribe", query)
+			assert.Equal(t, "key", conn.Connection.Key)
+			s.ExpectConnections("key", 1, time.Second)
+
+			_, err := s.Manager.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{"content":"hello"}`))
+			require.NoError(t, err)
+			assert.Equal(t, []testMessage{{Content: "hello"}}, ExpectMessages[testMessage](conn, 1, time.Second))
+			broadcasts := s.ExpectBroadcasts("key", 1, time.Second)
+			assert.Equal(t, 1, broadcasts[0].Result.DeliveredCount)
+
+			conn.Send("echo", testMessage{Content: "hi"})
+			assert.Equal(t, []testMessage{{Content: "hi"}}, ExpectMessages[testMessage](conn, 1, time.Second))
+			conn.ExpectNoFrame(10 * time.Millisecond)
+		},
+	)
+
+	t.Run(
+		"enveloped connections", func(t *testing.T) {
+			s := NewServer(t, newTestCustomizer)
+			conn := s.Dial("/subscribe", query, WithEnvelope())
+			require.True(t, conn.Enveloped())
+
+			_, err := s.Manager.BroadcastPayloadToLocalSubscribers(
+				ctx, "key", []byte(`{"content":"hello"}`), websocket.WithMessageID("m1"),
+			)
+			require.NoError(t, err)
+			envelope := ExpectEnvelopes(conn, 1, time.Second)[0]
+			assert.Equal(t, "m1", envelope.ID)
+			assert.JSONEq(t, `{"content":"hello"}`, string(envelope.Payload))
+
+			// The envelope is decoded by the server, the handler sends its reply as it is
+			conn.Send("echo", testMessage{Content: "hi"})
+			assert.JSONEq(t, `{"content":"hi"}`, string(conn.ExpectFrame(time.Second)))
+		},
+	)
+
+	t.Run(
+		"close codes and refused handshakes", func(t *testing.T) {
+			s := NewServer(t, newTestCustomizer)
+			conn := s.Dial("/subscribe", query)
+
+			assert.Equal(t, 1, s.Manager.CloseConnections("key", func(*websocket.WebSocketConnection) bool { return true }, 4001, "bye"))
+			conn.ExpectClose(4001, time.Second)
+			s.ExpectConnections("key", 0, time.Second)
+
+			_, resp, err := s.TryDial("/subscribe", nil)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		},
+	)
+
+	t.Run(
+		"fake broadcasts are recorded", func(t *testing.T) {
+			errFake := errors.New("fake")
+			s := NewServer(
+				t, newTestCustomizer, WithFakeBroadcast(
+					func(context.Context, string, []byte, ...websocket.BroadcastOptions) (websocket.BroadcastResult, error) {
+						return websocket.BroadcastResult{DeliveredCount: 3}, errFake
+					},
+				),
+			)
+			conn := s.Dial("/subscribe", query)
+
+			result, err := s.Manager.BroadcastPayloadToLocalSubscribers(ctx, "key", []byte(`{}`))
+			assert.ErrorIs(t, err, errFake)
+			assert.Equal(t, 3, result.DeliveredCount)
+			conn.ExpectNoFrame(10 * time.Millisecond)
+
+			broadcasts := s.ExpectBroadcasts("key", 1, time.Second)
+			assert.Equal(t, `{}`, string(broadcasts[0].Payload))
+			assert.ErrorIs(t, broadcasts[0].Err, errFake)
+		},
+	)
+}